@@ -0,0 +1,176 @@
+package arcmon
+
+import (
+	"context"
+	"time"
+)
+
+// announceRetries is how many checks in a row an announcement that failed to
+// reach some notifiers is retried on before they are given up on
+const announceRetries = 5
+
+// queuedAnnouncement : An update still to be delivered to routes, only touched by the checker
+type queuedAnnouncement struct {
+	// update is the newest in digest, when a digest is what's queued
+	update   *Update
+	digest   *Digest
+	routes   []route
+	attempts int
+}
+
+// announce sends u to the notifiers unless it was recently announced. The
+// version is marked as announced as soon as one notifier succeeded, the ones
+// that failed are queued and retried on the following checks. If every one
+// failed it stays unannounced, so a restart during the outage announces it
+// again rather than losing it.
+func (s *Server) announce(ctx context.Context, u *Update) {
+	if !s.baseline.IsZero() && !u.LastModified.After(s.baseline) {
+		s.log.Infof("not announcing %s, released %s, at or before the baseline %s",
+			u.Checksum, u.LastModified.UTC().Format(time.RFC3339), s.baseline.UTC().Format(time.RFC3339))
+		// recorded as sent so a restart doesn't try again, nor a digest include it
+		s.markAnnounced(u)
+		return
+	}
+	// the version is already in the history, which is what the digest is built from
+	if s.digestInterval > 0 {
+		s.log.Infof("holding %s for the next digest", u.Checksum)
+		return
+	}
+	if s.recentlyAnnounced(u.Checksum) {
+		s.arcdps.RLock()
+		at := s.arcdps.LastAnnouncedAt
+		s.arcdps.RUnlock()
+		s.log.Warnf("suppressing duplicate announcement of %s, last announced at %s", u.Checksum, at.Format(time.RFC3339))
+		return
+	}
+
+	delivered, failed, err := s.notify(ctx, u, s.activeRoutes())
+	if err != nil {
+		s.log.Errorf("unable to announce update: (%v)", err)
+	}
+	s.queueRetry(u, nil, failed)
+	if delivered > 0 || len(failed) == 0 {
+		s.markAnnounced(u)
+	}
+}
+
+// markAnnounced records u as sent out
+func (s *Server) markAnnounced(u *Update) {
+	s.arcdps.Lock()
+	s.arcdps.LastAnnounced = u.Checksum
+	s.arcdps.LastAnnouncedAt = s.clock.Now()
+	s.arcdps.Unlock()
+	s.persist()
+}
+
+// queueRetry replaces the queued announcement with u, or the digest ending
+// with it, to the routes that failed to receive it, a newer version
+// superseding any older one still queued
+func (s *Server) queueRetry(u *Update, digest *Digest, failed []route) {
+	if s.retrying != nil && s.retrying.update.Checksum != u.Checksum {
+		s.log.Warnf("giving up on announcing %s to %d notifiers, superseded by %s", s.retrying.update.Checksum, len(s.retrying.routes), u.Checksum)
+	}
+	s.retrying = nil
+	if len(failed) > 0 {
+		s.retrying = &queuedAnnouncement{update: u, digest: digest, routes: failed}
+	}
+}
+
+// retryAnnouncement sends the queued announcement to the routes that still
+// haven't received it, marking the version as announced once any one has
+func (s *Server) retryAnnouncement(ctx context.Context) {
+	q := s.retrying
+	if q == nil {
+		return
+	}
+	routes := s.stillActive(q.routes)
+	if len(routes) == 0 {
+		// every one left was a webhook disabled since
+		s.retrying = nil
+		return
+	}
+	q.attempts++
+	var (
+		delivered int
+		failed    []route
+		err       error
+	)
+	if q.digest != nil {
+		delivered, failed, err = s.digestTo(ctx, q.digest.Updates, routes)
+	} else {
+		delivered, failed, err = s.notify(ctx, q.update, routes)
+	}
+	if delivered > 0 {
+		s.arcdps.RLock()
+		announced := s.arcdps.LastAnnounced == q.update.Checksum
+		s.arcdps.RUnlock()
+		if !announced {
+			s.markAnnounced(q.update)
+		}
+	}
+	switch {
+	case len(failed) == 0:
+		s.log.Infof("delivered the queued announcement of %s", q.update.Checksum)
+		s.retrying = nil
+	case q.attempts >= announceRetries:
+		s.log.Errorf("giving up on announcing %s after %d retries: (%v)", q.update.Checksum, q.attempts, err)
+		s.retrying = nil
+	default:
+		q.routes = failed
+	}
+}
+
+// recentlyAnnounced reports whether checksum was already sent out within the announce cooldown
+func (s *Server) recentlyAnnounced(checksum string) bool {
+	s.arcdps.RLock()
+	defer s.arcdps.RUnlock()
+	if s.arcdps.LastAnnounced != checksum {
+		return false
+	}
+	return s.since(s.arcdps.LastAnnouncedAt) < s.announceCooldown
+}
+
+// reconcile compares the last seen and last announced checksums on startup. If
+// a previous run saw a new version but stopped before announcing it, the
+// announcement is sent now instead of being lost.
+func (s *Server) reconcile(ctx context.Context) {
+	s.arcdps.RLock()
+	seen, announced := s.arcdps.CheckSum, s.arcdps.LastAnnounced
+	u := &Update{Checksum: s.arcdps.CheckSum, LastModified: s.arcdps.Timestamp, DetectedAt: s.clock.Now(), DownloadURL: s.dllURL(), Major: true}
+	if n := len(s.arcdps.History); n > 0 && s.arcdps.History[n-1].CheckSum == seen {
+		u.DetectedAt = s.arcdps.History[n-1].FirstSeen
+		if n > 1 {
+			u.Major = isMajor(s.arcdps.History[n-2].LastModified, u.LastModified, s.hotfixWindow)
+			u.Previous = s.arcdps.History[n-2].CheckSum
+		}
+	}
+	s.arcdps.RUnlock()
+
+	switch {
+	case seen == "" || seen == announced:
+		return
+	case announced == "":
+		// state written before announcements were tracked, assume it went out
+		s.arcdps.Lock()
+		s.arcdps.LastAnnounced = seen
+		s.arcdps.LastAnnouncedAt = s.clock.Now()
+		s.arcdps.Unlock()
+		s.persist()
+	default:
+		s.log.Infof("%s was detected by a previous run but never announced, announcing it now", seen)
+		s.announce(ctx, u)
+	}
+}
+
+// persist saves the tracked state, logging rather than failing so a full disk
+// doesn't stop monitoring
+func (s *Server) persist() {
+	if s.store == nil {
+		return
+	}
+	s.arcdps.RLock()
+	defer s.arcdps.RUnlock()
+	if err := s.store.Save(s.arcdps); err != nil {
+		s.log.Errorf("unable to save state: (%v)", err)
+	}
+}
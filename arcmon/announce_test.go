@@ -0,0 +1,69 @@
+package arcmon
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+// restart builds a new server from whatever the previous one saved, as if the process was restarted
+func restart(t *testing.T, up *upstream, store *memStore, opts ...Option) *Server {
+	t.Helper()
+	return newTestServer(up, append([]Option{WithState(store.load(t)), WithStore(store)}, opts...)...)
+}
+
+func TestRestartMidAnnounceAnnouncesOnce(t *testing.T) {
+	up := newUpstream(t)
+	store := &memStore{}
+	ctx := context.Background()
+
+	// the first run sees the new version but every notifier is down, as when
+	// the process is killed before the webhook goes out
+	down := &recordingNotifier{name: "recorder", err: errors.New("connection refused")}
+	s := newTestServer(up, WithStore(store), WithNotifier(down),
+		WithState(&ArcDPSVersion{CheckSum: testChecksum, LastAnnounced: testChecksum, Timestamp: testReleased}))
+	up.release(newChecksum, testReleased.Add(48*time.Hour))
+	if err := s.check(ctx); err != nil {
+		t.Fatalf("check() = %v", err)
+	}
+	if saved := store.load(t); saved.CheckSum != newChecksum || saved.LastAnnounced != testChecksum {
+		t.Fatalf("saved seen %q announced %q, want the new version seen but not announced", saved.CheckSum, saved.LastAnnounced)
+	}
+
+	// the restart announces what the first run missed
+	n := &recordingNotifier{name: "recorder"}
+	s = restart(t, up, store, WithNotifier(n))
+	s.reconcile(ctx)
+	if err := s.check(ctx); err != nil {
+		t.Fatalf("check() = %v", err)
+	}
+	if got := n.received(); len(got) != 1 || got[0] != newChecksum {
+		t.Fatalf("restart announced %v, want [%s]", got, newChecksum)
+	}
+
+	// and another restart after it went out has nothing to send
+	n = &recordingNotifier{name: "recorder"}
+	s = restart(t, up, store, WithNotifier(n))
+	s.reconcile(ctx)
+	if err := s.check(ctx); err != nil {
+		t.Fatalf("check() = %v", err)
+	}
+	if got := n.received(); len(got) != 0 {
+		t.Fatalf("second restart announced %v again", got)
+	}
+}
+
+func TestReconcileAdoptsStateFromBeforeAnnouncementsWereTracked(t *testing.T) {
+	up := newUpstream(t)
+	n := &recordingNotifier{name: "recorder"}
+	s := newTestServer(up, WithNotifier(n), WithState(&ArcDPSVersion{CheckSum: testChecksum, Timestamp: testReleased}))
+
+	s.reconcile(context.Background())
+	if got := n.received(); len(got) != 0 {
+		t.Fatalf("announced %v from a legacy state file", got)
+	}
+	if s.arcdps.LastAnnounced != testChecksum {
+		t.Fatalf("last announced %q, want the seen version %q", s.arcdps.LastAnnounced, testChecksum)
+	}
+}
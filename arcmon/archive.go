@@ -0,0 +1,41 @@
+package arcmon
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+)
+
+// archiveHistory appends entries trimmed from the history to the archive file,
+// one JSON object per line. They are written in a single append so readers
+// never see a partial line, even if we crash part way.
+func (s *Server) archiveHistory(entries []HistoryEntry) {
+	if s.historyArchive == "" || len(entries) == 0 {
+		return
+	}
+
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	for _, e := range entries {
+		if err := enc.Encode(e); err != nil {
+			s.log.Errorf("unable to archive history entry %s: (%v)", e.CheckSum, err)
+			return
+		}
+	}
+
+	f, err := os.OpenFile(s.historyArchive, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0644)
+	if err != nil {
+		s.log.Errorf("unable to open history archive %s: (%v)", s.historyArchive, err)
+		return
+	}
+	defer f.Close()
+	if _, err := f.Write(buf.Bytes()); err != nil {
+		s.log.Errorf("unable to write history archive %s: (%v)", s.historyArchive, err)
+		return
+	}
+	if err := f.Sync(); err != nil {
+		s.log.Errorf("unable to sync history archive %s: (%v)", s.historyArchive, err)
+		return
+	}
+	s.log.Debugf("archived %d history entries to %s", len(entries), s.historyArchive)
+}
@@ -0,0 +1,58 @@
+package arcmon
+
+import (
+	"errors"
+	"math"
+	"math/rand"
+	"sync"
+	"time"
+)
+
+// DefaultRetryMaxDelay caps the exponential growth of retry delays
+const DefaultRetryMaxDelay = 5 * time.Minute
+
+// jitterRand is seeded per process, every instance drawing the same sequence would defeat the point
+var (
+	jitterMu   sync.Mutex
+	jitterRand = rand.New(rand.NewSource(time.Now().UnixNano()))
+)
+
+// backoff returns the delay before retry attempt (counting from 1), doubling
+// base each attempt up to limit, or without a cap when limit is zero. With
+// jitter the delay is drawn uniformly from zero up to that value ("full
+// jitter"), so instances that failed together don't all retry together.
+func backoff(base, limit time.Duration, attempt int, jitter bool) time.Duration {
+	d := base
+	capped := limit > 0
+	for i := 1; i < attempt && (!capped || d < limit) && d <= math.MaxInt64/2; i++ {
+		d *= 2
+	}
+	if capped && d > limit {
+		d = limit
+	}
+	if !jitter || d <= 0 {
+		return d
+	}
+	jitterMu.Lock()
+	defer jitterMu.Unlock()
+	return time.Duration(jitterRand.Int63n(int64(d) + 1))
+}
+
+// DefaultRetryableStatus are the responses to the checksum fetch worth retrying,
+// anything else from upstream won't change by trying again straight away
+var DefaultRetryableStatus = []int{429, 500, 502, 503, 504}
+
+// retryable reports whether a failed check is worth retrying. Errors that
+// never got a response, like timeouts or refused connections, always are.
+func (s *Server) retryable(err error) bool {
+	var se *statusError
+	if !errors.As(err, &se) {
+		return true
+	}
+	for _, code := range s.retryableStatus {
+		if se.StatusCode == code {
+			return true
+		}
+	}
+	return false
+}
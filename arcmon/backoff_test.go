@@ -0,0 +1,129 @@
+package arcmon
+
+import (
+	"context"
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestBackoff(t *testing.T) {
+	for _, tc := range []struct {
+		attempt int
+		want    time.Duration
+	}{
+		{1, time.Second},
+		{2, 2 * time.Second},
+		{3, 4 * time.Second},
+		{4, 5 * time.Second},
+		{10, 5 * time.Second},
+	} {
+		if got := backoff(time.Second, 5*time.Second, tc.attempt, false); got != tc.want {
+			t.Errorf("backoff(1s, 5s, %d) = %s, want %s", tc.attempt, got, tc.want)
+		}
+	}
+}
+
+func TestBackoffJitterStaysWithinTheDelay(t *testing.T) {
+	for i := 0; i < 100; i++ {
+		if got := backoff(time.Second, time.Minute, 3, true); got < 0 || got > 4*time.Second {
+			t.Fatalf("jittered backoff %s outside [0, 4s]", got)
+		}
+	}
+}
+
+// runSeed starts the startup check in the background, returning a channel
+// closed once it gives up or succeeds
+func runSeed(s *Server) <-chan struct{} {
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		s.seed(context.Background())
+	}()
+	return done
+}
+
+func TestSeedBacksOffOnTheClock(t *testing.T) {
+	up := newUpstream(t)
+	up.fail(http.StatusServiceUnavailable)
+	clock := newFakeClock(testReleased)
+	s := newTestServer(up, WithClock(clock), WithStartupRetries(3, 10*time.Second))
+
+	done := runSeed(s)
+	clock.waitForTimers(t, 1)
+	clock.Advance(10 * time.Second)
+	clock.waitForTimers(t, 1)
+	// the second delay is doubled, so nearly all of it passing isn't enough
+	up.fail(0)
+	clock.Advance(19 * time.Second)
+	if n := up.count(); n != 2 {
+		t.Fatalf("%d requests before the second delay passed, want 2", n)
+	}
+	clock.Advance(time.Second)
+	<-done
+
+	if s.arcdps.CheckSum != testChecksum {
+		t.Fatalf("seeded %q, want %q", s.arcdps.CheckSum, testChecksum)
+	}
+	if n := up.count(); n != 3 {
+		t.Fatalf("%d requests, want 3", n)
+	}
+}
+
+func TestBackoffWithoutLimit(t *testing.T) {
+	if got := backoff(time.Second, 0, 10, false); got != 512*time.Second {
+		t.Fatalf("backoff(1s, 0, 10) = %s, want 8m32s with no cap", got)
+	}
+	if got := backoff(time.Second, 0, 1000, false); got <= 0 {
+		t.Fatalf("backoff(1s, 0, 1000) = %s, doubling overflowed", got)
+	}
+}
+
+func TestSeedStopsAfterAttempts(t *testing.T) {
+	up := newUpstream(t)
+	up.fail(http.StatusServiceUnavailable)
+	clock := newFakeClock(testReleased)
+	s := newTestServer(up, WithClock(clock), WithStartupRetries(2, 10*time.Second))
+
+	done := runSeed(s)
+	clock.waitForTimers(t, 1)
+	clock.Advance(10 * time.Second)
+	<-done
+	if n := up.count(); n != 2 {
+		t.Fatalf("%d requests, want 2 with two attempts allowed", n)
+	}
+}
+
+func TestSeedCapsDelayAtMaxDelay(t *testing.T) {
+	up := newUpstream(t)
+	up.fail(http.StatusServiceUnavailable)
+	clock := newFakeClock(testReleased)
+	s := newTestServer(up, WithClock(clock), WithStartupRetries(3, 10*time.Second), WithRetryLimits(15*time.Second, 0))
+
+	done := runSeed(s)
+	clock.waitForTimers(t, 1)
+	clock.Advance(10 * time.Second)
+	clock.waitForTimers(t, 1)
+	// doubled to 20s, capped to 15s
+	clock.Advance(15 * time.Second)
+	<-done
+	if n := up.count(); n != 3 {
+		t.Fatalf("%d requests, want 3 with the second delay capped at 15s", n)
+	}
+}
+
+func TestSeedStopsAtMaxElapsed(t *testing.T) {
+	up := newUpstream(t)
+	up.fail(http.StatusServiceUnavailable)
+	clock := newFakeClock(testReleased)
+	s := newTestServer(up, WithClock(clock), WithStartupRetries(5, 10*time.Second), WithRetryLimits(0, 25*time.Second))
+
+	done := runSeed(s)
+	clock.waitForTimers(t, 1)
+	// 10s in, waiting another 20s would go past 25s
+	clock.Advance(10 * time.Second)
+	<-done
+	if n := up.count(); n != 2 {
+		t.Fatalf("%d requests, want 2 before retrying would take over 25s", n)
+	}
+}
@@ -0,0 +1,88 @@
+package arcmon
+
+import (
+	"context"
+	"fmt"
+)
+
+// DiscordAPIURL is the REST API bot messages are posted through
+const DiscordAPIURL = "https://discord.com/api/v10"
+
+// DiscordBot : A bot token and the channel it posts updates to, used instead of
+// or alongside webhooks
+type DiscordBot struct {
+	Token     string
+	ChannelID string
+	// Events filters what is posted, see ParseEventFilter
+	Events string
+}
+
+// discordBotNotifier announces updates by posting to a channel as a bot, using
+// the same rendering as embed webhooks
+type discordBotNotifier struct {
+	instance
+	s   *Server
+	bot DiscordBot
+}
+
+func (d *discordBotNotifier) Name() string { return d.named("discord-bot") }
+
+func (d *discordBotNotifier) Notify(ctx context.Context, u *Update) error {
+	payload, err := d.s.RenderWebhook(Webhook{Format: WebhookFormatEmbed}, u)
+	if err != nil {
+		return err
+	}
+	return d.s.postDiscord(ctx, d.url(), "Bot "+d.bot.Token, payload)
+}
+
+func (d *discordBotNotifier) NotifyFailure(ctx context.Context, f *Failure) error {
+	payload, err := d.s.marshalDiscord(d.s.buildFailurePayload(WebhookFormatEmbed, f), "failure alert")
+	if err != nil {
+		return err
+	}
+	return d.s.postDiscord(ctx, d.url(), "Bot "+d.bot.Token, payload)
+}
+
+func (d *discordBotNotifier) NotifyHeartbeat(ctx context.Context, h *Heartbeat) error {
+	payload, err := d.s.marshalDiscord(d.s.buildHeartbeatPayload(WebhookFormatEmbed, h), "heartbeat")
+	if err != nil {
+		return err
+	}
+	return d.s.postDiscord(ctx, d.url(), "Bot "+d.bot.Token, payload)
+}
+
+func (d *discordBotNotifier) NotifyDirectoryChange(ctx context.Context, c *DirectoryChange) error {
+	payload, err := d.s.marshalDiscord(&discordPayload{Content: c.Summary()}, "directory change")
+	if err != nil {
+		return err
+	}
+	return d.s.postDiscord(ctx, d.url(), "Bot "+d.bot.Token, payload)
+}
+
+func (d *discordBotNotifier) NotifyMonitorUpgrade(ctx context.Context, m *MonitorUpgrade) error {
+	payload, err := d.s.marshalDiscord(&discordPayload{Content: m.Summary()}, "monitor upgrade")
+	if err != nil {
+		return err
+	}
+	return d.s.postDiscord(ctx, d.url(), "Bot "+d.bot.Token, payload)
+}
+
+func (d *discordBotNotifier) NotifyUnavailable(ctx context.Context, u *Unavailable) error {
+	payload, err := d.s.marshalDiscord(d.s.buildUnavailablePayload(WebhookFormatEmbed, u), "unavailable notice")
+	if err != nil {
+		return err
+	}
+	return d.s.postDiscord(ctx, d.url(), "Bot "+d.bot.Token, payload)
+}
+
+func (d *discordBotNotifier) NotifyDigest(ctx context.Context, digest *Digest) error {
+	payload, err := d.s.marshalDiscord(d.s.buildDigestPayload(WebhookFormatEmbed, digest), "digest")
+	if err != nil {
+		return err
+	}
+	return d.s.postDiscord(ctx, d.url(), "Bot "+d.bot.Token, payload)
+}
+
+func (d *discordBotNotifier) url() string {
+	return fmt.Sprintf("%s/channels/%s/messages", DiscordAPIURL, d.bot.ChannelID)
+}
@@ -0,0 +1,101 @@
+package arcmon
+
+import (
+	"bytes"
+	"fmt"
+	"strconv"
+	"strings"
+	"text/template"
+	"time"
+)
+
+// Branding : Overrides for the embed footer and author, empty fields keep the defaults
+type Branding struct {
+	// Footer is a text/template rendered with .Interval, the time between checks
+	Footer     string
+	AuthorName string
+	AuthorIcon string
+	Colors     Colors
+}
+
+// Colors : Embed colors for each kind of message as 0xRRGGBB, zero keeps the default
+type Colors struct {
+	Update      int
+	Failure     int
+	Heartbeat   int
+	Unavailable int
+}
+
+func (c Colors) update() int      { return colorOr(c.Update, embedColor) }
+func (c Colors) failure() int     { return colorOr(c.Failure, failureEmbedColor) }
+func (c Colors) heartbeat() int   { return colorOr(c.Heartbeat, heartbeatColor) }
+func (c Colors) unavailable() int { return colorOr(c.Unavailable, unavailableColor) }
+
+func colorOr(c, def int) int {
+	if c == 0 {
+		return def
+	}
+	return c
+}
+
+// ParseColor reads an embed color written as #RRGGBB, 0xRRGGBB or a decimal number
+func ParseColor(raw string) (int, error) {
+	digits, base := strings.TrimSpace(raw), 10
+	for _, prefix := range []string{"#", "0x", "0X"} {
+		if strings.HasPrefix(digits, prefix) {
+			digits, base = digits[len(prefix):], 16
+			break
+		}
+	}
+	c, err := strconv.ParseInt(digits, base, 32)
+	if err != nil || c < 0 || c > 0xFFFFFF {
+		return 0, fmt.Errorf("invalid color %q, must be #RRGGBB", raw)
+	}
+	return int(c), nil
+}
+
+// defaultFooter is the footer used when Branding.Footer is empty
+const defaultFooter = "This bot checks every {{.Interval}}"
+
+// Validate checks that the footer template parses
+func (b Branding) Validate() error {
+	if b.Footer == "" {
+		return nil
+	}
+	_, err := template.New("footer").Parse(b.Footer)
+	return err
+}
+
+// renderFooter executes the footer template, falling back to the default footer if it fails
+func (b Branding) renderFooter(interval time.Duration) string {
+	for _, text := range []string{b.Footer, defaultFooter} {
+		if text == "" {
+			continue
+		}
+		tmpl, err := template.New("footer").Parse(text)
+		if err != nil {
+			continue
+		}
+		var buf bytes.Buffer
+		if err := tmpl.Execute(&buf, struct{ Interval time.Duration }{interval}); err != nil {
+			continue
+		}
+		return buf.String()
+	}
+	return ""
+}
+
+// apply overrides the matching parts of an embed
+func (b Branding) apply(e *discordEmbed, interval time.Duration) {
+	if e.Footer != nil {
+		e.Footer.Text = b.renderFooter(interval)
+	}
+	if e.Author != nil {
+		if b.AuthorName != "" {
+			e.Author.Name = b.AuthorName
+		}
+		if b.AuthorIcon != "" {
+			e.Author.IconURL = b.AuthorIcon
+		}
+	}
+}
@@ -0,0 +1,103 @@
+package arcmon
+
+import (
+	"fmt"
+	"time"
+)
+
+// Circuit breaker defaults, after DefaultBreakerThreshold failed checks in a
+// row no requests are made for DefaultBreakerCooldown
+const (
+	DefaultBreakerThreshold = 5
+	DefaultBreakerCooldown  = 30 * time.Minute
+)
+
+// Circuit states as reported on /healthz
+const (
+	CircuitClosed   = "closed"
+	CircuitOpen     = "open"
+	CircuitHalfOpen = "half-open"
+)
+
+// breaker stops checks from hitting an upstream that is clearly down. Once
+// threshold checks in a row have failed it opens, and checks are skipped until
+// cooldown has passed. The next check is then a probe: success closes it again,
+// failure opens it for another cooldown. It is guarded by Server.mu.
+type breaker struct {
+	threshold int
+	cooldown  time.Duration
+	failures  int
+	openUntil time.Time
+}
+
+// allow reports whether a check may be made at now
+func (b *breaker) allow(now time.Time) bool {
+	return b.threshold <= 0 || !now.Before(b.openUntil)
+}
+
+// record counts the result of a check made at now, reporting whether it
+// opened the circuit
+func (b *breaker) record(err error, now time.Time) bool {
+	if err == nil {
+		b.failures, b.openUntil = 0, time.Time{}
+		return false
+	}
+	b.failures++
+	if b.threshold <= 0 || b.failures < b.threshold {
+		return false
+	}
+	b.openUntil = now.Add(b.cooldown)
+	return true
+}
+
+func (b *breaker) state(now time.Time) string {
+	switch {
+	case b.threshold <= 0 || b.failures < b.threshold:
+		return CircuitClosed
+	case now.Before(b.openUntil):
+		return CircuitOpen
+	}
+	return CircuitHalfOpen
+}
+
+// circuitOpen is returned instead of checking while the circuit is open
+type circuitOpen struct {
+	until time.Time
+}
+
+func (e *circuitOpen) Error() string {
+	return fmt.Sprintf("circuit open after repeated failures, skipping checks until %s", e.until.Format(time.RFC3339))
+}
+
+// allowCheck reports whether the breaker lets a check through. Skipped checks
+// still count as the ticker being alive for the watchdog, but leave the last
+// error alone.
+func (s *Server) allowCheck() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	now := s.clock.Now()
+	if s.breaker.allow(now) {
+		return nil
+	}
+	s.lastChecked = now
+	return &circuitOpen{until: s.breaker.openUntil}
+}
+
+// recordBreaker feeds the result of a check into the breaker
+func (s *Server) recordBreaker(err error) {
+	s.mu.Lock()
+	opened := s.breaker.record(err, s.clock.Now())
+	failures, cooldown := s.breaker.failures, s.breaker.cooldown
+	s.mu.Unlock()
+	if opened {
+		s.log.Warnf("%d checks in a row failed, pausing checks for %s", failures, cooldown)
+	}
+}
+
+// CircuitState returns whether checks are currently being made: closed,
+// open while they are skipped, or half-open when the next one is a probe
+func (s *Server) CircuitState() string {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.breaker.state(s.clock.Now())
+}
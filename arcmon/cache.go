@@ -0,0 +1,57 @@
+package arcmon
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// cacheTTL returns how long a response may be cached according to its
+// Cache-Control max-age, falling back to Expires. Zero means no usable hint.
+func cacheTTL(h http.Header, now time.Time) time.Duration {
+	for _, directive := range strings.Split(h.Get("Cache-Control"), ",") {
+		directive = strings.TrimSpace(directive)
+		if !strings.HasPrefix(strings.ToLower(directive), "max-age=") {
+			continue
+		}
+		secs, err := strconv.Atoi(strings.Trim(directive[len("max-age="):], `"`))
+		if err != nil || secs <= 0 {
+			return 0
+		}
+		return time.Duration(secs) * time.Second
+	}
+
+	if v := h.Get("Expires"); v != "" {
+		expires, err := http.ParseTime(v)
+		if err != nil || !expires.After(now) {
+			return 0
+		}
+		return expires.Sub(now)
+	}
+	return 0
+}
+
+// warnIfPollingTooOften logs once if the interval is shorter than upstream's
+// cache lifetime, since checks in between can only ever see the cached copy
+func (s *Server) warnIfPollingTooOften(ttl time.Duration) {
+	if ttl <= s.interval {
+		return
+	}
+	s.cacheWarning.Do(func() {
+		s.log.Warnf("checking every %s but upstream caches the checksum for %s, consider a longer interval",
+			s.interval, ttl.Round(time.Second))
+	})
+}
+
+// recordETag keeps the validator upstream sent for the current version, so
+// restarts still make conditional requests. It is saved only when it changes.
+func (s *Server) recordETag(etag string) {
+	s.arcdps.Lock()
+	changed := s.arcdps.ETag != etag
+	s.arcdps.ETag = etag
+	s.arcdps.Unlock()
+	if changed {
+		s.persist()
+	}
+}
@@ -0,0 +1,45 @@
+package arcmon
+
+import (
+	"context"
+	"time"
+)
+
+// Clock is where a Server gets the time from. Everything time dependent,
+// scheduling checks, backoff, heartbeats, the watchdog and alert throttling,
+// goes through it, so a fake can step through hours of monitoring without
+// real sleeps. See WithClock.
+type Clock interface {
+	Now() time.Time
+	// After sends the time on the returned channel once d has passed. Like
+	// time.After it must count elapsed time, so that setting the wall clock
+	// doesn't move it.
+	After(d time.Duration) <-chan time.Time
+}
+
+// realClock is the wall clock, used unless WithClock says otherwise
+type realClock struct{}
+
+func (realClock) Now() time.Time                         { return time.Now() }
+func (realClock) After(d time.Duration) <-chan time.Time { return time.After(d) }
+
+// clocked is implemented by notifiers that wait on their own, for rate limits
+// and the like, so NewServer can hand them its clock
+type clocked interface {
+	useClock(c Clock)
+}
+
+// since is how long ago t was by the server's clock
+func (s *Server) since(t time.Time) time.Duration {
+	return s.clock.Now().Sub(t)
+}
+
+// sleep waits for d on c or until ctx is done, whichever comes first
+func sleep(ctx context.Context, c Clock, d time.Duration) error {
+	select {
+	case <-c.After(d):
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
@@ -0,0 +1,110 @@
+package arcmon
+
+import (
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeClock : A Clock that only moves when a test moves it. Advance lets time
+// pass, firing timers as they come due, while Step only sets the wall clock,
+// the way NTP correcting it does, which timers must not notice.
+type fakeClock struct {
+	mu      sync.Mutex
+	now     time.Time
+	elapsed time.Duration
+	timers  []fakeTimer
+}
+
+type fakeTimer struct {
+	due time.Duration
+	c   chan time.Time
+}
+
+func newFakeClock(now time.Time) *fakeClock {
+	return &fakeClock{now: now}
+}
+
+func (c *fakeClock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.now
+}
+
+func (c *fakeClock) After(d time.Duration) <-chan time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	ch := make(chan time.Time, 1)
+	if d <= 0 {
+		ch <- c.now
+		return ch
+	}
+	c.timers = append(c.timers, fakeTimer{due: c.elapsed + d, c: ch})
+	return ch
+}
+
+// Advance lets d pass, firing every timer due by then
+func (c *fakeClock) Advance(d time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.now = c.now.Add(d)
+	c.elapsed += d
+	pending := c.timers[:0]
+	for _, t := range c.timers {
+		if t.due <= c.elapsed {
+			t.c <- c.now
+			continue
+		}
+		pending = append(pending, t)
+	}
+	c.timers = pending
+}
+
+// Step moves the wall clock by d without any time passing
+func (c *fakeClock) Step(d time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.now = c.now.Add(d)
+}
+
+// pending is how many timers haven't fired yet
+func (c *fakeClock) pending() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return len(c.timers)
+}
+
+// waitForTimers blocks until n timers are pending, which is how a test knows
+// the goroutine it drives has got as far as waiting
+func (c *fakeClock) waitForTimers(t *testing.T, n int) {
+	t.Helper()
+	waitFor(t, "timers to be set", func() bool { return c.pending() >= n })
+}
+
+func TestFakeClockStepDoesNotFireTimers(t *testing.T) {
+	c := newFakeClock(testReleased)
+	fired := c.After(time.Minute)
+
+	c.Step(time.Hour)
+	select {
+	case <-fired:
+		t.Fatalf("timer fired when only the wall clock moved")
+	default:
+	}
+	if got := c.Now(); !got.Equal(testReleased.Add(time.Hour)) {
+		t.Fatalf("Now() = %s after stepping, want %s", got, testReleased.Add(time.Hour))
+	}
+
+	c.Advance(59 * time.Second)
+	select {
+	case <-fired:
+		t.Fatalf("timer fired early")
+	default:
+	}
+	c.Advance(time.Second)
+	select {
+	case <-fired:
+	default:
+		t.Fatalf("timer didn't fire once its duration passed")
+	}
+}
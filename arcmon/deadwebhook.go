@@ -0,0 +1,75 @@
+package arcmon
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+)
+
+// discordError : A response from Discord that wasn't a success
+type discordError struct {
+	StatusCode int
+	Detail     string
+}
+
+func (e *discordError) Error() string {
+	return fmt.Sprintf("bad response from Discord: %d (%s)", e.StatusCode, e.Detail)
+}
+
+// post sends a rendered message to the notifier's webhook. A 404 means the
+// webhook was deleted, which no amount of retrying fixes, so with
+// WithAutoDisableDeadWebhooks it's left out of activeRoutes for the rest of the run.
+func (d *discordNotifier) post(ctx context.Context, payload []byte) error {
+	err := d.s.postDiscord(ctx, d.webhook.URL, "", payload)
+	var de *discordError
+	if !errors.As(err, &de) || de.StatusCode != http.StatusNotFound {
+		return err
+	}
+	if !d.s.disableDeadWebhooks {
+		d.s.log.Errorf("%s: webhook no longer exists", d.name)
+		return err
+	}
+	d.s.log.Errorf("%s: webhook no longer exists, disabling it until restarted", d.name)
+	d.s.mu.Lock()
+	d.s.disabledWebhooks[d.name] = true
+	d.s.mu.Unlock()
+	return err
+}
+
+// activeRoutes are the notifiers events are sent to, every one but the disabled webhooks
+func (s *Server) activeRoutes() []route {
+	s.mu.RLock()
+	none := len(s.disabledWebhooks) == 0
+	s.mu.RUnlock()
+	if none {
+		return s.notifiers
+	}
+	return s.stillActive(s.notifiers)
+}
+
+// stillActive filters the disabled webhooks out of routes
+func (s *Server) stillActive(routes []route) []route {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	active := make([]route, 0, len(routes))
+	for _, r := range routes {
+		if d, ok := r.n.(*discordNotifier); ok && s.disabledWebhooks[d.name] {
+			continue
+		}
+		active = append(active, r)
+	}
+	return active
+}
+
+// disabledWebhookNames lists the webhooks disabled for no longer existing,
+// sorted. The caller must hold mu.
+func (s *Server) disabledWebhookNames() []string {
+	names := make([]string, 0, len(s.disabledWebhooks))
+	for name := range s.disabledWebhooks {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
@@ -0,0 +1,137 @@
+package arcmon
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// Digest : Every update detected since the previous digest, oldest first
+type Digest struct {
+	Updates []*Update
+}
+
+// DigestNotifier is implemented by notifiers that can post a digest as a single
+// message. Others receive each update in it separately.
+type DigestNotifier interface {
+	NotifyDigest(ctx context.Context, d *Digest) error
+}
+
+// Summary renders the digest as one line per update
+func (d *Digest) Summary() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "ArcDPS updated %d times:", len(d.Updates))
+	for _, u := range d.Updates {
+		fmt.Fprintf(&b, "\n%s: %s, released %s", u.DetectedAt.UTC().Format(time.RFC1123), u.Checksum, u.LastModified.UTC().Format(time.RFC1123))
+	}
+	return b.String()
+}
+
+// nextDigest returns when the digest after now is due. Digests are aligned to
+// multiples of the interval since the Unix epoch, so a 24h digest goes out at
+// midnight UTC whenever the monitor was started.
+func nextDigest(now time.Time, interval time.Duration) time.Time {
+	return now.Truncate(interval).Add(interval)
+}
+
+// pendingUpdates returns the versions first seen since the last announcement,
+// which in digest mode are waiting for the next digest. They're picked by time
+// rather than by finding the announced checksum, which a rollback to it would
+// make reappear after the versions that still need reporting.
+func (s *Server) pendingUpdates() []*Update {
+	s.arcdps.RLock()
+	defer s.arcdps.RUnlock()
+
+	history := s.arcdps.History
+	start := 0
+	if s.arcdps.LastAnnouncedAt.IsZero() {
+		// a state file from before announcement times were kept, only the checksum is known
+		for i := len(history) - 1; i >= 0; i-- {
+			if history[i].CheckSum == s.arcdps.LastAnnounced {
+				start = i + 1
+				break
+			}
+		}
+	} else {
+		for start < len(history) && !history[start].FirstSeen.After(s.arcdps.LastAnnouncedAt) {
+			start++
+		}
+	}
+
+	var updates []*Update
+	for i := start; i < len(history); i++ {
+		updates = append(updates, s.historyUpdate(history, i))
+	}
+	return updates
+}
+
+// sendDigest posts every pending update, marking the newest as announced and
+// queueing the notifiers that failed by the same rule as announce. Nothing is
+// sent when there were no updates.
+func (s *Server) sendDigest(ctx context.Context) {
+	updates := s.pendingUpdates()
+	if len(updates) == 0 {
+		s.log.Infof("no updates since the last digest")
+		return
+	}
+
+	newest := updates[len(updates)-1]
+	delivered, failed, err := s.digestTo(ctx, updates, s.activeRoutes())
+	if err != nil {
+		s.log.Errorf("unable to send digest: (%v)", err)
+	}
+	s.queueRetry(newest, &Digest{Updates: updates}, failed)
+	if delivered > 0 || len(failed) == 0 {
+		s.markAnnounced(newest)
+	}
+}
+
+// digestTo sends each of routes the updates it wants, as one message where the
+// notifier supports digests, returning how many received theirs and the ones
+// that failed
+func (s *Server) digestTo(ctx context.Context, updates []*Update, routes []route) (int, []route, error) {
+	var (
+		failed    []string
+		failedTo  []route
+		delivered int
+	)
+	sent := 0
+	for _, r := range routes {
+		var wanted []*Update
+		for _, u := range updates {
+			if r.wantsUpdate(u) {
+				wanted = append(wanted, u)
+			}
+		}
+		if len(wanted) == 0 {
+			continue
+		}
+		sent++
+
+		var err error
+		if dn, ok := r.n.(DigestNotifier); ok {
+			err = dn.NotifyDigest(ctx, &Digest{Updates: wanted})
+		} else {
+			for _, u := range wanted {
+				if err = r.n.Notify(ctx, u); err != nil {
+					break
+				}
+			}
+		}
+		s.metrics.countNotification(r.n.Name(), "digest", err)
+		if err != nil {
+			s.log.Errorf("unable to send digest to %s: (%v)", r.n.Name(), err)
+			failed = append(failed, fmt.Sprintf("%s: (%v)", r.n.Name(), err))
+			failedTo = append(failedTo, r)
+			continue
+		}
+		delivered++
+		s.log.Infof("sent digest of %d updates to %s", len(wanted), r.n.Name())
+	}
+	var err error
+	if len(failed) > 0 {
+		err = fmt.Errorf("%d of %d notifiers failed: %s", len(failed), sent, strings.Join(failed, ", "))
+	}
+	return delivered, failedTo, err
+}
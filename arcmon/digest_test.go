@@ -0,0 +1,130 @@
+package arcmon
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+// startTick runs s.Tick until the test ends
+func startTick(t *testing.T, s *Server) {
+	t.Helper()
+	ctx, cncl := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		s.Tick(ctx)
+	}()
+	t.Cleanup(func() {
+		cncl()
+		<-done
+	})
+}
+
+func TestNextDigest(t *testing.T) {
+	at := nextDigest(time.Date(2024, 3, 1, 10, 30, 0, 0, time.UTC), 24*time.Hour)
+	if want := time.Date(2024, 3, 2, 0, 0, 0, 0, time.UTC); !at.Equal(want) {
+		t.Fatalf("next daily digest at %s, want %s", at, want)
+	}
+	at = nextDigest(time.Date(2024, 3, 1, 10, 30, 0, 0, time.UTC), 6*time.Hour)
+	if want := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC); !at.Equal(want) {
+		t.Fatalf("next 6h digest at %s, want %s", at, want)
+	}
+}
+
+func TestDigestHoldsUpdatesUntilTheBoundary(t *testing.T) {
+	up := newUpstream(t)
+	up.release(newChecksum, testReleased.Add(time.Hour))
+	clock := newFakeClock(time.Date(2024, 3, 1, 10, 0, 0, 0, time.UTC))
+	n := &recordingNotifier{name: "recorder"}
+	s := newTestServer(up, WithClock(clock), WithDigest(24*time.Hour), WithNotifier(n),
+		WithState(&ArcDPSVersion{CheckSum: testChecksum, LastAnnounced: testChecksum, Timestamp: testReleased}))
+
+	startTick(t, s)
+	// the next check and the digest
+	clock.waitForTimers(t, 2)
+	if got := n.received(); len(got) != 0 {
+		t.Fatalf("announced %v straight away in digest mode", got)
+	}
+
+	clock.Advance(14*time.Hour - time.Minute)
+	clock.waitForTimers(t, 2)
+	if got := n.received(); len(got) != 0 {
+		t.Fatalf("announced %v before the digest was due", got)
+	}
+	clock.Advance(time.Minute)
+	waitFor(t, "the digest", func() bool { return len(n.received()) == 1 })
+	if got := n.received(); got[0] != newChecksum {
+		t.Fatalf("digest held %v, want [%s]", got, newChecksum)
+	}
+	clock.waitForTimers(t, 2)
+	s.arcdps.RLock()
+	announced := s.arcdps.LastAnnounced
+	s.arcdps.RUnlock()
+	if announced != newChecksum {
+		t.Fatalf("last announced %q after the digest, want %q", announced, newChecksum)
+	}
+}
+
+func TestDigestRetriesNotifiersThatFailed(t *testing.T) {
+	up := newUpstream(t)
+	up.release(newChecksum, testReleased.Add(time.Hour))
+	ok := &recordingNotifier{name: "ok"}
+	down := &recordingNotifier{name: "down", err: errors.New("connection refused")}
+	s := newTestServer(up, WithClock(newFakeClock(testReleased.Add(2*time.Hour))), WithDigest(24*time.Hour),
+		WithNotifier(ok), WithNotifier(down),
+		WithState(&ArcDPSVersion{CheckSum: testChecksum, LastAnnounced: testChecksum, Timestamp: testReleased}))
+	ctx := context.Background()
+
+	if err := s.check(ctx); err != nil {
+		t.Fatalf("check() = %v", err)
+	}
+	s.sendDigest(ctx)
+	// one notifier got it, so it counts as announced like a single update would
+	s.arcdps.RLock()
+	announced := s.arcdps.LastAnnounced
+	s.arcdps.RUnlock()
+	if announced != newChecksum {
+		t.Fatalf("last announced %q after a partly delivered digest, want %q", announced, newChecksum)
+	}
+	if got := ok.received(); len(got) != 1 {
+		t.Fatalf("digest delivered %v, want [%s]", got, newChecksum)
+	}
+
+	// and the one that failed receives it on the next check
+	down.setErr(nil)
+	s.tick(ctx)
+	if got := down.received(); len(got) != 1 || got[0] != newChecksum {
+		t.Fatalf("retry delivered %v, want [%s]", got, newChecksum)
+	}
+	if got := ok.received(); len(got) != 1 {
+		t.Fatalf("retry sent the digest again to a notifier that already had it: %v", got)
+	}
+	if s.retrying != nil {
+		t.Fatalf("digest still queued after every notifier received it")
+	}
+}
+
+func TestPendingUpdatesIncludesARollback(t *testing.T) {
+	announcedAt := testReleased.Add(time.Hour)
+	// the announced version, then a new one, then a rollback to the first
+	s := newTestServer(newUpstream(t), WithDigest(24*time.Hour), WithState(&ArcDPSVersion{
+		CheckSum:        testChecksum,
+		LastAnnounced:   testChecksum,
+		LastAnnouncedAt: announcedAt,
+		History: []HistoryEntry{
+			{CheckSum: testChecksum, LastModified: testReleased, FirstSeen: testReleased},
+			{CheckSum: newChecksum, LastModified: testReleased.Add(2 * time.Hour), FirstSeen: testReleased.Add(2 * time.Hour)},
+			{CheckSum: testChecksum, LastModified: testReleased.Add(3 * time.Hour), FirstSeen: testReleased.Add(3 * time.Hour)},
+		},
+	}))
+
+	var got []string
+	for _, u := range s.pendingUpdates() {
+		got = append(got, u.Checksum)
+	}
+	if len(got) != 2 || got[0] != newChecksum || got[1] != testChecksum {
+		t.Fatalf("digest holds %v, want [%s %s] with the rollback after the release it undid", got, newChecksum, testChecksum)
+	}
+}
@@ -0,0 +1,19 @@
+package arcmon
+
+import (
+	"compress/gzip"
+	"io"
+	"net/http"
+	"strings"
+)
+
+// decodedBody returns resp's body with any gzip content encoding removed. The
+// standard transport already does this for responses to requests it asked to
+// be compressed, but servers can gzip unprompted and Doers needn't decompress.
+func decodedBody(resp *http.Response) (io.Reader, error) {
+	switch strings.ToLower(strings.TrimSpace(resp.Header.Get("Content-Encoding"))) {
+	case "gzip", "x-gzip":
+		return gzip.NewReader(resp.Body)
+	}
+	return resp.Body, nil
+}
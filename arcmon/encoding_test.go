@@ -0,0 +1,97 @@
+package arcmon
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"runtime"
+	"strings"
+	"testing"
+)
+
+// gzipped compresses s
+func gzipped(t *testing.T, s string) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	gz := gzip.NewWriter(&buf)
+	gz.Write([]byte(s))
+	if err := gz.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+// gzipServer answers with status and body, always claiming a gzip encoding
+func gzipServer(t *testing.T, status int, body []byte) *Server {
+	t.Helper()
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Encoding", "gzip")
+		w.Header().Set("Content-Type", "text/plain")
+		w.Header().Set("Last-Modified", testReleased.Format(http.TimeFormat))
+		w.WriteHeader(status)
+		w.Write(body)
+	}))
+	t.Cleanup(srv.Close)
+	// the transport would otherwise decompress it before we see it
+	client := &http.Client{Transport: &http.Transport{DisableCompression: true}}
+	return NewServer(WithLogger(quietLogger()), WithDoer(client), WithBaseURL(srv.URL),
+		WithState(&ArcDPSVersion{CheckSum: testChecksum, Timestamp: testReleased, ETag: `"v1"`}))
+}
+
+func TestGetChecksumGzipBody(t *testing.T) {
+	s := gzipServer(t, http.StatusOK, gzipped(t, fmt.Sprintf("%s  d3d9.dll\n", newChecksum)))
+
+	check, err := s.GetChecksum(context.Background())
+	if err != nil {
+		t.Fatalf("GetChecksum() = %v", err)
+	}
+	if check.Checksum != newChecksum {
+		t.Fatalf("parsed %q, want %q", check.Checksum, newChecksum)
+	}
+}
+
+func TestGetChecksumGzipNotModifiedWithoutBody(t *testing.T) {
+	s := gzipServer(t, http.StatusNotModified, nil)
+
+	check, err := s.GetChecksum(context.Background())
+	if err != nil {
+		t.Fatalf("GetChecksum() = %v for an empty 304", err)
+	}
+	if !check.NotModified || check.Checksum != testChecksum {
+		t.Fatalf("got %+v, want the known version marked not modified", check)
+	}
+}
+
+func TestGetChecksumGzipErrorWithoutBody(t *testing.T) {
+	s := gzipServer(t, http.StatusServiceUnavailable, nil)
+
+	_, err := s.GetChecksum(context.Background())
+	var se *statusError
+	if !errors.As(err, &se) || se.StatusCode != http.StatusServiceUnavailable {
+		t.Fatalf("GetChecksum() = %v, want the 503", err)
+	}
+}
+
+func TestGetChecksumGzipBombIsCapped(t *testing.T) {
+	const padding = 64 << 20
+	s := gzipServer(t, http.StatusOK, gzipped(t, fmt.Sprintf("%s  d3d9.dll\n%s", newChecksum, strings.Repeat(" ", padding))))
+
+	var before, after runtime.MemStats
+	runtime.GC()
+	runtime.ReadMemStats(&before)
+	check, err := s.GetChecksum(context.Background())
+	runtime.ReadMemStats(&after)
+	if err != nil {
+		t.Fatalf("GetChecksum() = %v", err)
+	}
+	if check.Checksum != newChecksum {
+		t.Fatalf("parsed %q, want %q", check.Checksum, newChecksum)
+	}
+	if grew := after.TotalAlloc - before.TotalAlloc; grew > padding/8 {
+		t.Fatalf("reading a body that decompresses to %d bytes allocated %d", padding, grew)
+	}
+}
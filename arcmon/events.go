@@ -0,0 +1,117 @@
+package arcmon
+
+import (
+	"encoding/json"
+	"fmt"
+	"net"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// UpdateEvent : Written as a single JSON line to every event socket client when a new version is detected
+type UpdateEvent struct {
+	Type         string    `json:"type"`
+	Checksum     string    `json:"checksum"`
+	LastModified time.Time `json:"last_modified"`
+	DetectedAt   time.Time `json:"detected_at"`
+}
+
+// EventSocket is a local unix socket that desktop integrations can connect to
+// in order to receive update events without going through Discord.
+type EventSocket struct {
+	path     string
+	listener net.Listener
+
+	mu    sync.Mutex
+	conns map[net.Conn]struct{}
+}
+
+func NewEventSocket(path string) (*EventSocket, error) {
+	// a previous unclean shutdown may have left the socket behind, but never
+	// remove something that isn't a socket
+	if fi, err := os.Lstat(path); err == nil {
+		if fi.Mode()&os.ModeSocket == 0 {
+			return nil, fmt.Errorf("%s exists and is not a socket", path)
+		}
+		if err := os.Remove(path); err != nil {
+			return nil, fmt.Errorf("unable to remove stale socket: (%v)", err)
+		}
+	}
+
+	l, err := net.Listen("unix", path)
+	if err != nil {
+		return nil, err
+	}
+	if err := os.Chmod(path, 0600); err != nil {
+		l.Close()
+		return nil, err
+	}
+
+	es := &EventSocket{
+		path:     path,
+		listener: l,
+		conns:    make(map[net.Conn]struct{}),
+	}
+	go es.accept()
+	return es, nil
+}
+
+func (es *EventSocket) accept() {
+	for {
+		conn, err := es.listener.Accept()
+		if err != nil {
+			// listener was closed on shutdown
+			return
+		}
+		es.mu.Lock()
+		es.conns[conn] = struct{}{}
+		es.mu.Unlock()
+	}
+}
+
+// Publish writes the event to all connected clients, dropping any client that can't keep up
+func (es *EventSocket) Publish(ev UpdateEvent) {
+	if es == nil {
+		return
+	}
+
+	b, err := json.Marshal(ev)
+	if err != nil {
+		logrus.Errorf("unable to encode event: (%v)", err)
+		return
+	}
+	b = append(b, '\n')
+
+	es.mu.Lock()
+	defer es.mu.Unlock()
+	for conn := range es.conns {
+		conn.SetWriteDeadline(time.Now().Add(time.Second))
+		if _, err := conn.Write(b); err != nil {
+			logrus.Debugf("dropping event socket client: (%v)", err)
+			conn.Close()
+			delete(es.conns, conn)
+		}
+	}
+}
+
+func (es *EventSocket) Close() error {
+	if es == nil {
+		return nil
+	}
+
+	err := es.listener.Close()
+	es.mu.Lock()
+	for conn := range es.conns {
+		conn.Close()
+		delete(es.conns, conn)
+	}
+	es.mu.Unlock()
+
+	if rerr := os.Remove(es.path); rerr != nil && !os.IsNotExist(rerr) && err == nil {
+		err = rerr
+	}
+	return err
+}
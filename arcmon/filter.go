@@ -0,0 +1,79 @@
+package arcmon
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// Event filters select which events a notifier receives
+const (
+	EventsAll      = "all"
+	EventsUpdates  = "updates"
+	EventsMajor    = "major"
+	EventsFailures = "failures"
+)
+
+// DefaultHotfixWindow is how soon after the previous release a new one counts
+// as a hotfix rather than a major update
+const DefaultHotfixWindow = 24 * time.Hour
+
+// ParseEventFilter validates an event filter, defaulting to EventsUpdates when empty
+func ParseEventFilter(raw string) (string, error) {
+	switch f := strings.ToLower(strings.TrimSpace(raw)); f {
+	case "":
+		return EventsUpdates, nil
+	case EventsAll, EventsUpdates, EventsMajor, EventsFailures:
+		return f, nil
+	default:
+		return "", fmt.Errorf("unknown events %q, must be all, updates, major or failures", raw)
+	}
+}
+
+// Failure : Describes checks that have started failing
+type Failure struct {
+	Err   string
+	Since time.Time
+}
+
+// FailureNotifier is implemented by notifiers that can also announce failing checks
+type FailureNotifier interface {
+	NotifyFailure(ctx context.Context, f *Failure) error
+}
+
+// route is a notifier and the events it receives
+type route struct {
+	n      Notifier
+	events string
+}
+
+func (r route) wantsUpdate(u *Update) bool {
+	switch r.events {
+	case EventsAll, EventsUpdates, "":
+		return true
+	case EventsMajor:
+		return u.Major
+	}
+	return false
+}
+
+// wantsNotices is true for everything that receives every update, which also
+// gets heartbeats and directory changes
+func (r route) wantsNotices() bool {
+	switch r.events {
+	case EventsAll, EventsUpdates, "":
+		return true
+	}
+	return false
+}
+
+func (r route) wantsFailure() bool {
+	return r.events == EventsAll || r.events == EventsFailures
+}
+
+// isMajor reports whether a release made at lastModified is more than a hotfix
+// for the one previously released at previous
+func isMajor(previous, lastModified time.Time, hotfixWindow time.Duration) bool {
+	return previous.IsZero() || lastModified.Sub(previous) >= hotfixWindow
+}
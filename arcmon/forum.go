@@ -0,0 +1,69 @@
+package arcmon
+
+import (
+	"bytes"
+	"fmt"
+	"net/url"
+	"text/template"
+	"time"
+)
+
+// DefaultForumThreadName names the forum post each update is announced in
+const DefaultForumThreadName = "arcdps {{.ShortChecksum}}"
+
+// discordThreadNameLimit is the longest name Discord accepts for a thread
+const discordThreadNameLimit = 100
+
+// ValidateThreadName checks that text parses as a forum thread name template
+func ValidateThreadName(text string) error {
+	_, err := template.New("thread").Parse(text)
+	return err
+}
+
+// ValidateForumWebhook rejects a webhook URL that already posts into a thread,
+// which Discord doesn't allow together with creating a forum post
+func ValidateForumWebhook(raw string) error {
+	u, err := url.Parse(raw)
+	if err != nil {
+		return err
+	}
+	if u.Query().Get("thread_id") != "" {
+		return fmt.Errorf("posts to an existing thread with thread_id, which can't be combined with forum posts")
+	}
+	return nil
+}
+
+// renderThreadName executes the forum thread name template for u, falling back
+// to DefaultForumThreadName if it fails
+func (s *Server) renderThreadName(u *Update) string {
+	short := u.Checksum
+	if len(short) > 8 {
+		short = short[:8]
+	}
+	data := struct {
+		Checksum, ShortChecksum, Released string
+	}{u.Checksum, short, u.LastModified.UTC().Format(time.RFC1123)}
+
+	for _, text := range []string{s.forumThread, DefaultForumThreadName} {
+		tmpl, err := template.New("thread").Parse(text)
+		if err != nil {
+			continue
+		}
+		var buf bytes.Buffer
+		if err := tmpl.Execute(&buf, data); err != nil || buf.Len() == 0 {
+			continue
+		}
+		name, _ := truncate(buf.String(), discordThreadNameLimit)
+		return name
+	}
+	return u.Checksum
+}
+
+// inForum names the forum post p creates when posting to forum channels, which
+// reject webhook messages without one
+func (s *Server) inForum(p *discordPayload, threadName string) *discordPayload {
+	if s.forumThread != "" {
+		p.ThreadName, _ = truncate(threadName, discordThreadNameLimit)
+	}
+	return p
+}
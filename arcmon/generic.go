@@ -0,0 +1,188 @@
+package arcmon
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+)
+
+// GenericWebhookConfig : Settings for a webhook receiving updates as plain JSON rather than a Discord message
+type GenericWebhookConfig struct {
+	URL string
+	// Method defaults to POST
+	Method string
+	// Headers are added to every request, e.g. Authorization
+	Headers map[string]string
+	// Secret signs every request body when set, see SignatureHeader
+	Secret string
+	// Events filters what is sent, see ParseEventFilter
+	Events string
+}
+
+// Validate checks the settings without contacting the endpoint
+func (c GenericWebhookConfig) Validate() error {
+	if err := validateWebhookURL(c.URL); err != nil {
+		return err
+	}
+	switch strings.ToUpper(c.Method) {
+	case "", http.MethodPost, http.MethodPut, http.MethodPatch:
+	default:
+		return fmt.Errorf("unsupported method %q, must be POST, PUT or PATCH", c.Method)
+	}
+	for name, value := range c.Headers {
+		if err := ValidateHeader(name, value); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// validHeaderName reports whether name is an RFC 7230 token
+func validHeaderName(name string) bool {
+	if name == "" {
+		return false
+	}
+	for _, c := range name {
+		if c > 0x7e || c <= ' ' || strings.ContainsRune("\"(),/:;<=>?@[\\]{}", c) {
+			return false
+		}
+	}
+	return true
+}
+
+// SignatureHeader carries the signature of a generic webhook request body,
+// GitHub style: "sha256=" followed by the hex encoded HMAC-SHA256 of the exact
+// body bytes, keyed with the webhook's secret. Receivers should compute the
+// same over the raw body and compare with hmac.Equal before parsing it.
+const SignatureHeader = "X-Signature-256"
+
+// signature computes the SignatureHeader value of body
+func signature(secret string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// GenericWebhookNotifier sends each event as a JSON document to an arbitrary endpoint
+type GenericWebhookNotifier struct {
+	instance
+	http    Doer
+	url     string
+	method  string
+	headers map[string]string
+	secret  string
+}
+
+func NewGenericWebhookNotifier(client Doer, cfg GenericWebhookConfig) (*GenericWebhookNotifier, error) {
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+	method := strings.ToUpper(cfg.Method)
+	if method == "" {
+		method = http.MethodPost
+	}
+	return &GenericWebhookNotifier{http: client, url: cfg.URL, method: method, headers: cfg.Headers, secret: cfg.Secret}, nil
+}
+
+func (g *GenericWebhookNotifier) Name() string { return g.named("webhook") }
+
+// genericEvent : Body of every generic webhook request, only the fields for its type are set
+type genericEvent struct {
+	Type         string     `json:"type"`
+	Checksum     string     `json:"checksum,omitempty"`
+	LastModified *time.Time `json:"last_modified,omitempty"`
+	DetectedAt   *time.Time `json:"detected_at,omitempty"`
+	Previous     string     `json:"previous_checksum,omitempty"`
+	DownloadURL  string     `json:"download_url,omitempty"`
+	BuiltAt      *time.Time `json:"built_at,omitempty"`
+	Signature    string     `json:"signature,omitempty"`
+	Major        bool       `json:"major,omitempty"`
+	Error        string     `json:"error,omitempty"`
+	Since        *time.Time `json:"since,omitempty"`
+	URL          string     `json:"url,omitempty"`
+}
+
+func updateEvent(u *Update) genericEvent {
+	var built *time.Time
+	if !u.BuiltAt.IsZero() {
+		built = &u.BuiltAt
+	}
+	return genericEvent{
+		Type:         "update",
+		Checksum:     u.Checksum,
+		LastModified: &u.LastModified,
+		DetectedAt:   &u.DetectedAt,
+		Previous:     u.Previous,
+		DownloadURL:  u.DownloadURL,
+		BuiltAt:      built,
+		Signature:    u.Signature,
+		Major:        u.Major,
+	}
+}
+
+func failureEvent(f *Failure) genericEvent {
+	return genericEvent{Type: "failure", Error: f.Err, Since: &f.Since}
+}
+
+func unavailableEvent(u *Unavailable) genericEvent {
+	return genericEvent{Type: "unavailable", Checksum: u.Checksum, URL: u.URL, Since: &u.Since}
+}
+
+func (g *GenericWebhookNotifier) Notify(ctx context.Context, u *Update) error {
+	return g.send(ctx, updateEvent(u))
+}
+
+func (g *GenericWebhookNotifier) NotifyFailure(ctx context.Context, f *Failure) error {
+	return g.send(ctx, failureEvent(f))
+}
+
+func (g *GenericWebhookNotifier) NotifyUnavailable(ctx context.Context, u *Unavailable) error {
+	return g.send(ctx, unavailableEvent(u))
+}
+
+func (g *GenericWebhookNotifier) send(ctx context.Context, event genericEvent) error {
+	body, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, g.method, g.url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "arc-monitor")
+	// sorted so names differing only in case resolve the same way every time
+	names := make([]string, 0, len(g.headers))
+	for name := range g.headers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		req.Header.Set(name, g.headers[name])
+	}
+	if g.secret != "" {
+		req.Header.Set(SignatureHeader, signature(g.secret, body))
+	}
+
+	resp, err := g.http.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode > 299 {
+		respBody, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return fmt.Errorf("bad response from webhook: %d (%s)", resp.StatusCode, string(respBody))
+	}
+	return nil
+}
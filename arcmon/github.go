@@ -0,0 +1,338 @@
+package arcmon
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	GitHubAPIURL = "https://api.github.com"
+	// githubMaxRateLimitWait is the longest we'll block a notification waiting out a rate limit
+	githubMaxRateLimitWait = time.Minute
+	githubMaxAttempts      = 3
+	// githubConflictDelay is the base delay before retrying a conflicting file update
+	githubConflictDelay = time.Second
+)
+
+// GitHubConfig : Settings for the optional GitHub notifier, enabled when Token is set
+type GitHubConfig struct {
+	Token  string
+	Repo   string
+	Issue  int
+	File   string
+	Branch string
+	// Events filters what is recorded, see ParseEventFilter
+	Events string
+}
+
+func (c GitHubConfig) Enabled() bool { return c.Token != "" }
+
+// Validate checks the settings without contacting GitHub
+func (c GitHubConfig) Validate() error {
+	if parts := strings.Split(c.Repo, "/"); len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+		return fmt.Errorf("repo must be in the form owner/name, got %q", c.Repo)
+	}
+	if c.Issue <= 0 && c.File == "" {
+		return fmt.Errorf("an issue number or file path is required")
+	}
+	return nil
+}
+
+// GitHubNotifier records updates in a GitHub repository, either as a comment on
+// an issue, as a row appended to a tracked file, or both.
+type GitHubNotifier struct {
+	instance
+	http   Doer
+	token  string
+	repo   string
+	issue  int
+	file   string
+	branch string
+	// clock times waits for rate limits and conflicts, the server's once added to one
+	clock Clock
+	// mu serialises Notify, since digests and announcements can overlap
+	mu sync.Mutex
+	// commented and appended are the checksums last recorded each way, so
+	// retrying an update that only half went out doesn't repeat the other half
+	commented string
+	appended  string
+}
+
+func NewGitHubNotifier(client Doer, cfg GitHubConfig) (*GitHubNotifier, error) {
+	if cfg.Token == "" {
+		return nil, fmt.Errorf("missing GitHub token")
+	}
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+	return &GitHubNotifier{
+		http:   client,
+		token:  cfg.Token,
+		repo:   cfg.Repo,
+		issue:  cfg.Issue,
+		file:   strings.TrimPrefix(cfg.File, "/"),
+		branch: cfg.Branch,
+		clock:  realClock{},
+	}, nil
+}
+
+func (g *GitHubNotifier) useClock(c Clock) { g.clock = c }
+
+func (g *GitHubNotifier) Name() string { return g.named("github") }
+
+// Notify comments on the issue and appends to the file, each at most once per
+// version. When one fails the update is retried as usual, and only the one
+// that failed is tried again.
+func (g *GitHubNotifier) Notify(ctx context.Context, u *Update) error {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	var failed []string
+	if g.issue > 0 && g.commented != u.Checksum {
+		if err := g.comment(ctx, u); err != nil {
+			failed = append(failed, fmt.Sprintf("unable to comment on issue #%d: (%v)", g.issue, err))
+		} else {
+			g.commented = u.Checksum
+		}
+	}
+	if g.file != "" && g.appended != u.Checksum {
+		if err := g.appendRow(ctx, u); err != nil {
+			failed = append(failed, fmt.Sprintf("unable to update %s: (%v)", g.file, err))
+		} else {
+			g.appended = u.Checksum
+		}
+	}
+	if len(failed) > 0 {
+		return fmt.Errorf("%s", strings.Join(failed, ", "))
+	}
+	return nil
+}
+
+// NotifyFailure comments on the issue, failures aren't recorded in the tracked file
+func (g *GitHubNotifier) NotifyFailure(ctx context.Context, f *Failure) error {
+	if g.issue <= 0 {
+		return nil
+	}
+	err := g.postComment(ctx, fmt.Sprintf("ArcDPS Monitor checks are failing since `%s`:\n\n```\n%s\n```",
+		f.Since.UTC().Format(time.RFC1123), f.Err))
+	if err != nil {
+		return fmt.Errorf("unable to comment on issue #%d: (%v)", g.issue, err)
+	}
+	return nil
+}
+
+func (g *GitHubNotifier) comment(ctx context.Context, u *Update) error {
+	return g.postComment(ctx, fmt.Sprintf("ArcDPS has updated!\n\n**Checksum:** `%s`\n**Timestamp Version:** `%s`\n\n%s",
+		u.Checksum, u.LastModified.UTC().Format(time.RFC1123), u.DownloadURL))
+}
+
+func (g *GitHubNotifier) postComment(ctx context.Context, text string) error {
+	body, err := json.Marshal(map[string]string{"body": text})
+	if err != nil {
+		return err
+	}
+
+	resp, err := g.do(ctx, "POST", fmt.Sprintf("%s/repos/%s/issues/%d/comments", GitHubAPIURL, g.repo, g.issue), body)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	return nil
+}
+
+type githubContent struct {
+	SHA     string `json:"sha"`
+	Content string `json:"content"`
+}
+
+const githubFileHeader = "| Checksum | Timestamp Version | Detected |\n| --- | --- | --- |\n"
+
+// appendRow adds the update to the tracked file through the Contents API. A
+// 409 means someone else changed the file between our read and write, so the
+// file is re-read and the append retried.
+func (g *GitHubNotifier) appendRow(ctx context.Context, u *Update) error {
+	row := fmt.Sprintf("| `%s` | %s | %s |\n",
+		u.Checksum, u.LastModified.UTC().Format(time.RFC3339), u.DetectedAt.UTC().Format(time.RFC3339))
+
+	var err error
+	for attempt := 1; attempt <= githubMaxAttempts; attempt++ {
+		var current *githubContent
+		current, err = g.getFile(ctx)
+		if err != nil {
+			return err
+		}
+
+		var content []byte
+		if current == nil {
+			content = []byte(githubFileHeader)
+		} else {
+			content, err = base64.StdEncoding.DecodeString(strings.ReplaceAll(current.Content, "\n", ""))
+			if err != nil {
+				return fmt.Errorf("unable to decode file content: (%v)", err)
+			}
+			if len(content) > 0 && content[len(content)-1] != '\n' {
+				content = append(content, '\n')
+			}
+		}
+		content = append(content, row...)
+
+		put := map[string]string{
+			"message": fmt.Sprintf("arcdps updated to %s", u.Checksum),
+			"content": base64.StdEncoding.EncodeToString(content),
+		}
+		if current != nil {
+			put["sha"] = current.SHA
+		}
+		if g.branch != "" {
+			put["branch"] = g.branch
+		}
+		body, merr := json.Marshal(put)
+		if merr != nil {
+			return merr
+		}
+
+		var resp *http.Response
+		resp, err = g.do(ctx, "PUT", g.contentsURL(), body)
+		if err == nil {
+			resp.Body.Close()
+			return nil
+		}
+		if !isGitHubStatus(err, http.StatusConflict) {
+			return err
+		}
+		logrus.Warnf("conflict updating %s on attempt %d, retrying", g.file, attempt)
+		if serr := sleep(ctx, g.clock, backoff(githubConflictDelay, DefaultRetryMaxDelay, attempt, true)); serr != nil {
+			return serr
+		}
+	}
+	return err
+}
+
+// getFile returns the tracked file, or nil if it doesn't exist yet
+func (g *GitHubNotifier) getFile(ctx context.Context) (*githubContent, error) {
+	u := g.contentsURL()
+	if g.branch != "" {
+		u += "?ref=" + url.QueryEscape(g.branch)
+	}
+
+	resp, err := g.do(ctx, "GET", u, nil)
+	if err != nil {
+		if isGitHubStatus(err, http.StatusNotFound) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	c := &githubContent{}
+	if err := json.NewDecoder(resp.Body).Decode(c); err != nil {
+		return nil, fmt.Errorf("unable to decode file metadata: (%v)", err)
+	}
+	return c, nil
+}
+
+func (g *GitHubNotifier) contentsURL() string {
+	return fmt.Sprintf("%s/repos/%s/contents/%s", GitHubAPIURL, g.repo, g.file)
+}
+
+// githubError : Non-2xx response from the GitHub API
+type githubError struct {
+	StatusCode int
+	Body       string
+}
+
+func (e *githubError) Error() string {
+	return fmt.Sprintf("bad response from GitHub: %d (%s)", e.StatusCode, e.Body)
+}
+
+func isGitHubStatus(err error, code int) bool {
+	ge, ok := err.(*githubError)
+	return ok && ge.StatusCode == code
+}
+
+// do performs an authenticated API request, waiting out short rate limits. On
+// success the caller owns the response body.
+func (g *GitHubNotifier) do(ctx context.Context, method, endpoint string, body []byte) (*http.Response, error) {
+	for attempt := 1; ; attempt++ {
+		var payload io.Reader
+		if body != nil {
+			payload = bytes.NewReader(body)
+		}
+		req, err := http.NewRequestWithContext(ctx, method, endpoint, payload)
+		if err != nil {
+			return nil, err
+		}
+		req.Header.Set("Authorization", "Bearer "+g.token)
+		req.Header.Set("Accept", "application/vnd.github+json")
+		req.Header.Set("X-GitHub-Api-Version", "2022-11-28")
+		req.Header.Set("User-Agent", "arc-monitor")
+		if body != nil {
+			req.Header.Set("Content-Type", "application/json")
+		}
+
+		resp, err := g.http.Do(req)
+		if err != nil {
+			return nil, err
+		}
+		if resp.StatusCode <= 299 {
+			return resp, nil
+		}
+
+		respBody, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		resp.Body.Close()
+
+		wait, limited := githubRateLimitWait(resp, g.clock.Now())
+		if !limited {
+			return nil, &githubError{StatusCode: resp.StatusCode, Body: string(respBody)}
+		}
+		if wait > githubMaxRateLimitWait || attempt >= githubMaxAttempts {
+			return nil, fmt.Errorf("rate limited by GitHub, retry in %s", wait.Round(time.Second))
+		}
+
+		logrus.Warnf("rate limited by GitHub, waiting %s", wait.Round(time.Second))
+		if err := sleep(ctx, g.clock, wait); err != nil {
+			return nil, err
+		}
+	}
+}
+
+// githubRateLimitWait reports whether resp is a rate limit response and how
+// long after now GitHub asked us to wait before trying again.
+func githubRateLimitWait(resp *http.Response, now time.Time) (time.Duration, bool) {
+	if resp.StatusCode != http.StatusForbidden && resp.StatusCode != http.StatusTooManyRequests {
+		return 0, false
+	}
+
+	if after := resp.Header.Get("Retry-After"); after != "" {
+		if secs, err := strconv.Atoi(after); err == nil {
+			return time.Duration(secs) * time.Second, true
+		}
+	}
+	if resp.Header.Get("X-RateLimit-Remaining") == "0" {
+		if reset, err := strconv.ParseInt(resp.Header.Get("X-RateLimit-Reset"), 10, 64); err == nil {
+			wait := time.Unix(reset, 0).Sub(now)
+			if wait < 0 {
+				wait = 0
+			}
+			return wait, true
+		}
+		return githubMaxRateLimitWait, true
+	}
+
+	// a 403 without rate limit headers is a permissions problem, not a limit
+	if resp.StatusCode == http.StatusTooManyRequests {
+		return githubMaxRateLimitWait, true
+	}
+	return 0, false
+}
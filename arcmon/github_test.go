@@ -0,0 +1,94 @@
+package arcmon
+
+import (
+	"context"
+	"net/http"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestGitHubRateLimitWaitsOnTheServerClock(t *testing.T) {
+	var calls int32
+	doer := doerFunc(func(req *http.Request) (*http.Response, error) {
+		if atomic.AddInt32(&calls, 1) == 1 {
+			resp := response(req, http.StatusTooManyRequests, "")
+			resp.Header.Set("Retry-After", "30")
+			return resp, nil
+		}
+		return response(req, http.StatusCreated, "{}"), nil
+	})
+	gh, err := NewGitHubNotifier(doer, GitHubConfig{Token: "token", Repo: "owner/repo", Issue: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	clock := newFakeClock(testReleased)
+	NewServer(WithLogger(quietLogger()), WithClock(clock), WithNotifier(gh))
+
+	done := make(chan error, 1)
+	go func() {
+		done <- gh.Notify(context.Background(), &Update{Checksum: testChecksum, LastModified: testReleased})
+	}()
+	clock.waitForTimers(t, 1)
+	select {
+	case err := <-done:
+		t.Fatalf("returned (%v) without waiting out the rate limit", err)
+	default:
+	}
+	clock.Advance(30 * time.Second)
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatalf("Notify() = %v after the rate limit passed", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatalf("still waiting after the rate limit passed on the server's clock")
+	}
+	if n := atomic.LoadInt32(&calls); n != 2 {
+		t.Fatalf("%d requests, want 2", n)
+	}
+}
+
+func TestGitHubRetryOnlyRepeatsTheFailedHalf(t *testing.T) {
+	var comments, puts int32
+	doer := doerFunc(func(req *http.Request) (*http.Response, error) {
+		switch {
+		case req.Method == "POST":
+			atomic.AddInt32(&comments, 1)
+			return response(req, http.StatusCreated, "{}"), nil
+		case req.Method == "GET":
+			return response(req, http.StatusNotFound, `{"message": "Not Found"}`), nil
+		}
+		// the file update is rejected the first time
+		if atomic.AddInt32(&puts, 1) == 1 {
+			return response(req, http.StatusUnprocessableEntity, `{"message": "Invalid request"}`), nil
+		}
+		return response(req, http.StatusCreated, "{}"), nil
+	})
+	gh, err := NewGitHubNotifier(doer, GitHubConfig{Token: "token", Repo: "owner/repo", Issue: 1, File: "RELEASES.md"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	u := &Update{Checksum: testChecksum, LastModified: testReleased}
+
+	if err := gh.Notify(context.Background(), u); err == nil {
+		t.Fatalf("Notify() succeeded though the file update failed")
+	}
+	if err := gh.Notify(context.Background(), u); err != nil {
+		t.Fatalf("retried Notify() = %v", err)
+	}
+	if n := atomic.LoadInt32(&comments); n != 1 {
+		t.Fatalf("commented %d times, the retry should only have updated the file", n)
+	}
+	if n := atomic.LoadInt32(&puts); n != 2 {
+		t.Fatalf("%d file updates, want 2", n)
+	}
+
+	// a new version gets both again
+	if err := gh.Notify(context.Background(), &Update{Checksum: newChecksum, LastModified: testReleased}); err != nil {
+		t.Fatalf("Notify() = %v", err)
+	}
+	if n := atomic.LoadInt32(&comments); n != 2 {
+		t.Fatalf("commented %d times after a new version, want 2", n)
+	}
+}
@@ -0,0 +1,70 @@
+package arcmon
+
+import (
+	"crypto/md5"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/sha512"
+	"fmt"
+	"hash"
+	"strings"
+)
+
+// Hash algorithms a checksum file can be published with, deltaconnected
+// currently only publishes HashMD5
+const (
+	HashMD5    = "md5"
+	HashSHA1   = "sha1"
+	HashSHA256 = "sha256"
+	HashSHA512 = "sha512"
+)
+
+var hashes = map[string]func() hash.Hash{
+	HashMD5:    md5.New,
+	HashSHA1:   sha1.New,
+	HashSHA256: sha256.New,
+	HashSHA512: sha512.New,
+}
+
+// digestSizes are how many bytes each algorithm's digest is, so checking a
+// digest doesn't need to construct a hash
+var digestSizes = map[string]int{
+	HashMD5:    md5.Size,
+	HashSHA1:   sha1.Size,
+	HashSHA256: sha256.Size,
+	HashSHA512: sha512.Size,
+}
+
+// ParseHashAlgorithm validates a hash algorithm name, defaulting to HashMD5 when empty
+func ParseHashAlgorithm(raw string) (string, error) {
+	alg := strings.ToLower(strings.TrimSpace(raw))
+	if alg == "" {
+		return HashMD5, nil
+	}
+	if _, ok := hashes[alg]; !ok {
+		return "", fmt.Errorf("unknown hash algorithm %q, must be md5, sha1, sha256 or sha512", raw)
+	}
+	return alg, nil
+}
+
+// ChecksumURL is where deltaconnected would publish the checksum of the DLL
+// made with algorithm, following the md5sum file's naming
+func ChecksumURL(algorithm string) string {
+	return ArcDpsURL + "d3d9.dll." + algorithm + "sum"
+}
+
+// validDigest reports whether digest is hex of the length algorithm produces,
+// so an error page or a file for another algorithm isn't taken for a checksum
+func validDigest(algorithm, digest string) bool {
+	if len(digest) != 2*digestSizes[algorithm] {
+		return false
+	}
+	for i := 0; i < len(digest); i++ {
+		switch c := digest[i]; {
+		case '0' <= c && c <= '9', 'a' <= c && c <= 'f', 'A' <= c && c <= 'F':
+		default:
+			return false
+		}
+	}
+	return true
+}
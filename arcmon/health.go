@@ -0,0 +1,140 @@
+package arcmon
+
+import (
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"time"
+)
+
+type healthStatus struct {
+	Status      string     `json:"status"`
+	CheckSum    string     `json:"check_sum"`
+	Timestamp   time.Time  `json:"timestamp"`
+	LastChecked *time.Time `json:"last_checked,omitempty"`
+	NextCheck   *time.Time `json:"next_check,omitempty"`
+	LastError   string     `json:"last_error,omitempty"`
+	Circuit     string     `json:"circuit"`
+	// DisabledWebhooks are the Discord webhooks skipped for no longer existing
+	DisabledWebhooks []string `json:"disabled_webhooks,omitempty"`
+	// LastPayload is the most recent Discord message, to see exactly what was sent
+	LastPayload *sentPayload `json:"last_payload,omitempty"`
+}
+
+type sentPayload struct {
+	SentAt time.Time       `json:"sent_at"`
+	Body   json.RawMessage `json:"body"`
+}
+
+// Handler serves the health and event endpoints, plus any added with WithRoute,
+// all under the WithPathPrefix prefix when one is set
+func (s *Server) Handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/healthz", s.handleHealth)
+	mux.HandleFunc("/status", s.handleStatus)
+	mux.HandleFunc("/events", s.handleEvents)
+	mux.HandleFunc("/history", s.handleHistory)
+	mux.HandleFunc("/stats", s.handleStats)
+	mux.HandleFunc("/metrics", s.handleMetrics)
+	for pattern, h := range s.routes {
+		mux.Handle(pattern, h)
+	}
+	if s.pathPrefix == "" {
+		return mux
+	}
+
+	prefixed := http.NewServeMux()
+	prefixed.Handle(s.pathPrefix+"/", http.StripPrefix(s.pathPrefix, mux))
+	return prefixed
+}
+
+// ListenHealth binds addr and serves Handler on it in the background. Binding
+// happens up front so a bad address fails startup instead of being logged later.
+func (s *Server) ListenHealth(addr string) (*http.Server, error) {
+	l, err := net.Listen("tcp", addr)
+	if err != nil {
+		return nil, err
+	}
+
+	// no write timeout, /events responses are long lived
+	srv := &http.Server{Handler: s.Handler(), ReadHeaderTimeout: 5 * time.Second}
+	srv.RegisterOnShutdown(s.broadcaster.Close)
+	go func() {
+		if err := srv.Serve(l); err != nil && err != http.ErrServerClosed {
+			s.log.Errorf("health server stopped: (%v)", err)
+		}
+	}()
+	return srv, nil
+}
+
+func (s *Server) handleHealth(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	s.arcdps.RLock()
+	status := healthStatus{
+		Status:    "ok",
+		CheckSum:  s.arcdps.CheckSum,
+		Timestamp: s.arcdps.Timestamp,
+	}
+	s.arcdps.RUnlock()
+
+	s.mu.RLock()
+	if !s.lastChecked.IsZero() {
+		lastChecked := s.lastChecked
+		status.LastChecked = &lastChecked
+	}
+	if !s.nextCheck.IsZero() {
+		nextCheck := s.nextCheck
+		status.NextCheck = &nextCheck
+	}
+	if s.lastErr != nil {
+		status.Status = "degraded"
+		status.LastError = s.lastErr.Error()
+	}
+	status.Circuit = s.breaker.state(s.clock.Now())
+	if len(s.disabledWebhooks) > 0 {
+		status.Status = "degraded"
+		status.DisabledWebhooks = s.disabledWebhookNames()
+	}
+	if s.lastPayload != nil {
+		status.LastPayload = &sentPayload{SentAt: s.lastPayloadAt, Body: s.lastPayload}
+	}
+	s.mu.RUnlock()
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(status)
+}
+
+// handleStatus answers with a single word for uptime checkers that can only
+// match on the body: OK, or with a 503 STALE when no check completed within
+// the status window and FAIL when the last one failed
+func (s *Server) handleStatus(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	window := s.statusWindow
+	if window <= 0 {
+		window = 3 * s.interval
+	}
+
+	s.mu.RLock()
+	lastChecked, lastErr := s.lastChecked, s.lastErr
+	s.mu.RUnlock()
+
+	code, status := http.StatusOK, "OK"
+	switch {
+	case lastChecked.IsZero() || s.since(lastChecked) > window:
+		code, status = http.StatusServiceUnavailable, "STALE"
+	case lastErr != nil:
+		code, status = http.StatusServiceUnavailable, "FAIL"
+	}
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(code)
+	fmt.Fprintln(w, status)
+}
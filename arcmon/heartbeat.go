@@ -0,0 +1,72 @@
+package arcmon
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+// DefaultHeartbeatAfter is a quiet stretch long enough to be unusual for arcdps
+const DefaultHeartbeatAfter = 14 * 24 * time.Hour
+
+// Heartbeat : Reassurance that the monitor is still running through a long stretch without updates
+type Heartbeat struct {
+	Checksum     string
+	LastModified time.Time
+	// Quiet is how long it's been since the current version was released
+	Quiet time.Duration
+}
+
+// HeartbeatNotifier is implemented by notifiers that can post heartbeats
+type HeartbeatNotifier interface {
+	NotifyHeartbeat(ctx context.Context, h *Heartbeat) error
+}
+
+// quietFor renders d in days, or hours when it's shorter than that
+func quietFor(d time.Duration) string {
+	if days := int(d / (24 * time.Hour)); days >= 1 {
+		if days == 1 {
+			return "1 day"
+		}
+		return fmt.Sprintf("%d days", days)
+	}
+	return d.Round(time.Hour).String()
+}
+
+// heartbeat posts a Heartbeat once heartbeatAfter has passed since both the
+// current release and the previous heartbeat. The previous heartbeat starts out
+// as startup, so a restart loop can't repeat it.
+func (s *Server) heartbeat(ctx context.Context, now time.Time) {
+	s.arcdps.RLock()
+	h := &Heartbeat{Checksum: s.arcdps.CheckSum, LastModified: s.arcdps.Timestamp, Quiet: now.Sub(s.arcdps.Timestamp)}
+	s.arcdps.RUnlock()
+	if h.Checksum == "" {
+		return
+	}
+
+	since := h.LastModified
+	if s.lastHeartbeat.After(since) {
+		since = s.lastHeartbeat
+	}
+	if now.Sub(since) < s.heartbeatAfter {
+		return
+	}
+	s.lastHeartbeat = now
+
+	for _, r := range s.activeRoutes() {
+		if !r.wantsNotices() {
+			continue
+		}
+		hn, ok := r.n.(HeartbeatNotifier)
+		if !ok {
+			continue
+		}
+		err := hn.NotifyHeartbeat(ctx, h)
+		s.metrics.countNotification(r.n.Name(), "heartbeat", err)
+		if err != nil {
+			s.log.Errorf("unable to send heartbeat to %s: (%v)", r.n.Name(), err)
+			continue
+		}
+		s.log.Infof("sent heartbeat to %s", r.n.Name())
+	}
+}
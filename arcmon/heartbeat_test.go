@@ -0,0 +1,45 @@
+package arcmon
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestHeartbeatAfterQuietStretch(t *testing.T) {
+	up := newUpstream(t)
+	clock := newFakeClock(testReleased.Add(time.Hour))
+	n := &recordingNotifier{name: "recorder"}
+	s := newTestServer(up, WithClock(clock), WithHeartbeat(DefaultHeartbeatAfter), WithNotifier(n),
+		WithState(&ArcDPSVersion{CheckSum: testChecksum, LastAnnounced: testChecksum, Timestamp: testReleased}))
+	s.lastHeartbeat = clock.Now()
+	ctx := context.Background()
+
+	ticks := func(d time.Duration) {
+		for end := clock.Now().Add(d); clock.Now().Before(end); {
+			clock.Advance(DefaultTickDuration)
+			s.tick(ctx)
+		}
+	}
+	ticks(DefaultHeartbeatAfter - 2*DefaultTickDuration)
+	if len(n.heartbeats) != 0 {
+		t.Fatalf("heartbeat sent before %s without an update", DefaultHeartbeatAfter)
+	}
+	ticks(2 * DefaultTickDuration)
+	if len(n.heartbeats) != 1 {
+		t.Fatalf("%d heartbeats after %s without an update, want 1", len(n.heartbeats), DefaultHeartbeatAfter)
+	}
+	if got := n.heartbeats[0].Quiet; got < DefaultHeartbeatAfter {
+		t.Fatalf("heartbeat says quiet for %s, want at least %s", got, DefaultHeartbeatAfter)
+	}
+
+	// counted from the previous heartbeat, not the release, from then on
+	ticks(DefaultHeartbeatAfter - 2*DefaultTickDuration)
+	if len(n.heartbeats) != 1 {
+		t.Fatalf("second heartbeat sent too soon")
+	}
+	ticks(2 * DefaultTickDuration)
+	if len(n.heartbeats) != 2 {
+		t.Fatalf("%d heartbeats after two quiet stretches, want 2", len(n.heartbeats))
+	}
+}
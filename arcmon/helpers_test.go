@@ -0,0 +1,205 @@
+package arcmon
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"gopkg.in/yaml.v2"
+)
+
+// testChecksum and testReleased are the version upstream serves unless a test
+// releases another, newChecksum is the one tests release
+const (
+	testChecksum = "0123456789abcdef0123456789abcdef"
+	newChecksum  = "fedcba9876543210fedcba9876543210"
+)
+
+var testReleased = time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+
+// quietLogger discards everything, so failing paths under test don't flood the output
+func quietLogger() *logrus.Logger {
+	l := logrus.New()
+	l.SetOutput(io.Discard)
+	return l
+}
+
+// upstream : A stand in for deltaconnected serving the checksum file of whatever version it's set to
+type upstream struct {
+	*httptest.Server
+	mu           sync.Mutex
+	checksum     string
+	lastModified time.Time
+	// status, when set, is answered instead of the checksum
+	status   int
+	requests int
+}
+
+func newUpstream(t *testing.T) *upstream {
+	t.Helper()
+	u := &upstream{checksum: testChecksum, lastModified: testReleased}
+	u.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		u.mu.Lock()
+		u.requests++
+		checksum, lastModified, status := u.checksum, u.lastModified, u.status
+		u.mu.Unlock()
+		if status != 0 {
+			http.Error(w, http.StatusText(status), status)
+			return
+		}
+		w.Header().Set("Content-Type", "text/plain")
+		w.Header().Set("Last-Modified", lastModified.Format(http.TimeFormat))
+		fmt.Fprintf(w, "%s  d3d9.dll\n", checksum)
+	}))
+	t.Cleanup(u.Close)
+	return u
+}
+
+// release publishes a new version
+func (u *upstream) release(checksum string, lastModified time.Time) {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	u.checksum, u.lastModified = checksum, lastModified
+}
+
+// fail answers every request with status, zero to recover
+func (u *upstream) fail(status int) {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	u.status = status
+}
+
+func (u *upstream) count() int {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	return u.requests
+}
+
+// newTestServer returns a Server checking up, with jitter off so delays are exact
+func newTestServer(up *upstream, opts ...Option) *Server {
+	return NewServer(append([]Option{
+		WithLogger(quietLogger()),
+		WithDoer(up.Client()),
+		WithBaseURL(up.URL),
+		WithRetryJitter(false),
+		WithAlertGracePeriod(0),
+	}, opts...)...)
+}
+
+// doerFunc is a Doer answering every request itself, for APIs a test can't point elsewhere
+type doerFunc func(req *http.Request) (*http.Response, error)
+
+func (f doerFunc) Do(req *http.Request) (*http.Response, error) { return f(req) }
+
+// response builds a response to req with status and body
+func response(req *http.Request, status int, body string) *http.Response {
+	return &http.Response{
+		StatusCode: status,
+		Header:     make(http.Header),
+		Body:       io.NopCloser(strings.NewReader(body)),
+		Request:    req,
+	}
+}
+
+// recordingNotifier remembers everything it's sent, failing with err when it's set
+type recordingNotifier struct {
+	name       string
+	mu         sync.Mutex
+	err        error
+	attempts   int
+	updates    []*Update
+	failures   []*Failure
+	heartbeats []*Heartbeat
+}
+
+func (n *recordingNotifier) Name() string { return n.name }
+
+func (n *recordingNotifier) Notify(ctx context.Context, u *Update) error {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	n.attempts++
+	if n.err != nil {
+		return n.err
+	}
+	n.updates = append(n.updates, u)
+	return nil
+}
+
+func (n *recordingNotifier) NotifyFailure(ctx context.Context, f *Failure) error {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	n.failures = append(n.failures, f)
+	return n.err
+}
+
+func (n *recordingNotifier) NotifyHeartbeat(ctx context.Context, h *Heartbeat) error {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	n.heartbeats = append(n.heartbeats, h)
+	return n.err
+}
+
+func (n *recordingNotifier) setErr(err error) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	n.err = err
+}
+
+// received lists the checksums of the updates delivered
+func (n *recordingNotifier) received() []string {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	var checksums []string
+	for _, u := range n.updates {
+		checksums = append(checksums, u.Checksum)
+	}
+	return checksums
+}
+
+// memStore is a Store keeping the last state saved as the YAML a state file would hold
+type memStore struct {
+	mu    sync.Mutex
+	saved []byte
+}
+
+func (m *memStore) Save(arcdps *ArcDPSVersion) error {
+	out, err := yaml.Marshal(arcdps)
+	if err != nil {
+		return err
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.saved = out
+	return nil
+}
+
+// load decodes the saved state, as a restarted monitor would
+func (m *memStore) load(t *testing.T) *ArcDPSVersion {
+	t.Helper()
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	arcdps := &ArcDPSVersion{}
+	if err := yaml.Unmarshal(m.saved, arcdps); err != nil {
+		t.Fatalf("unable to decode saved state: %v", err)
+	}
+	return arcdps
+}
+
+// waitFor polls cond until it holds, failing the test after a few seconds
+func waitFor(t *testing.T, what string, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting for %s", what)
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
@@ -0,0 +1,65 @@
+package arcmon
+
+import (
+	"encoding/json"
+	"net/http"
+	"time"
+)
+
+// DefaultHistorySize is how many versions are kept in the state file
+const DefaultHistorySize = 50
+
+// HistoryEntry : A version we've tracked and the window it was live for. LastSeen
+// is when it was superseded and stays unset for the current version.
+type HistoryEntry struct {
+	CheckSum     string     `yaml:"check_sum" json:"check_sum"`
+	LastModified time.Time  `yaml:"last_modified" json:"last_modified"`
+	FirstSeen    time.Time  `yaml:"first_seen" json:"first_seen"`
+	LastSeen     *time.Time `yaml:"last_seen,omitempty" json:"last_seen,omitempty"`
+}
+
+// recordVersion closes off the current history entry and starts a new one for
+// checksum, keeping at most limit entries and returning any it trimmed, oldest
+// first. The caller must hold the write lock.
+func (a *ArcDPSVersion) recordVersion(checksum string, lastModified, now time.Time, limit int) []HistoryEntry {
+	if n := len(a.History); n > 0 && a.History[n-1].LastSeen == nil {
+		a.History[n-1].LastSeen = &now
+	}
+	a.History = append(a.History, HistoryEntry{
+		CheckSum:     checksum,
+		LastModified: lastModified,
+		FirstSeen:    now,
+	})
+	if limit <= 0 || len(a.History) <= limit {
+		return nil
+	}
+	trimmed := append([]HistoryEntry(nil), a.History[:len(a.History)-limit]...)
+	a.History = append([]HistoryEntry(nil), a.History[len(a.History)-limit:]...)
+	return trimmed
+}
+
+func (s *Server) handleHistory(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	s.arcdps.RLock()
+	history := append([]HistoryEntry{}, s.arcdps.History...)
+	s.arcdps.RUnlock()
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(history)
+}
+
+// historyUpdate rebuilds the update history[i] was announced as, with the
+// entry before it as the previous version
+func (s *Server) historyUpdate(history []HistoryEntry, i int) *Update {
+	e := history[i]
+	u := &Update{Checksum: e.CheckSum, LastModified: e.LastModified, DetectedAt: e.FirstSeen, DownloadURL: s.dllURL(), Major: true}
+	if i > 0 {
+		u.Previous = history[i-1].CheckSum
+		u.Major = isMajor(history[i-1].LastModified, e.LastModified, s.hotfixWindow)
+	}
+	return u
+}
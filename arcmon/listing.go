@@ -0,0 +1,171 @@
+package arcmon
+
+import (
+	"context"
+	"fmt"
+	"html"
+	"io"
+	"net/http"
+	"net/url"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// maxListingSize caps how much of the directory index is read
+const maxListingSize = 1 << 20
+
+// listingRow matches a link followed, possibly across table cells, by the
+// modification time an Apache or nginx style index prints next to it. Sort
+// links and absolute paths are skipped by requiring a relative href.
+var listingRow = regexp.MustCompile(`(?is)<a\s[^>]*href="([^"?/#][^"]*)"[^>]*>[^<]*</a>(?:\s|</?td[^>]*>)*` +
+	`(\d{4}-\d{2}-\d{2}\s+\d{2}:\d{2}(?::\d{2})?|\d{2}-[A-Za-z]{3}-\d{4}\s+\d{2}:\d{2})`)
+
+// ListedFile : An entry in the deltaconnected directory index
+type ListedFile struct {
+	Name string
+	// Modified is the timestamp as printed by the index, compared as text since its zone isn't stated
+	Modified string
+}
+
+// DirectoryChange : Describes how the directory index differs from the last time it was fetched
+type DirectoryChange struct {
+	URL     string
+	Added   []ListedFile
+	Changed []ListedFile
+	Removed []ListedFile
+}
+
+// Summary renders the change as a few lines of plain text
+func (c *DirectoryChange) Summary() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "The arcdps directory listing changed: %s", c.URL)
+	for _, group := range []struct {
+		label string
+		files []ListedFile
+	}{{"New", c.Added}, {"Updated", c.Changed}, {"Removed", c.Removed}} {
+		for _, f := range group.files {
+			fmt.Fprintf(&b, "\n%s: %s (%s)", group.label, f.Name, f.Modified)
+		}
+	}
+	return b.String()
+}
+
+// DirectoryNotifier is implemented by notifiers that can announce directory listing changes
+type DirectoryNotifier interface {
+	NotifyDirectoryChange(ctx context.Context, c *DirectoryChange) error
+}
+
+// parseListing extracts every file and timestamp from a directory index page
+func parseListing(page []byte) map[string]string {
+	files := make(map[string]string)
+	for _, m := range listingRow.FindAllSubmatch(page, -1) {
+		name := html.UnescapeString(string(m[1]))
+		if unescaped, err := url.PathUnescape(name); err == nil {
+			name = unescaped
+		}
+		if name == "../" || name == "./" {
+			continue
+		}
+		files[name] = strings.Join(strings.Fields(string(m[2])), " ")
+	}
+	return files
+}
+
+// fetchListing downloads and parses the directory index. A page that parses to
+// nothing is an error, so a layout change can't look like every file vanished.
+func (s *Server) fetchListing(ctx context.Context) (map[string]string, error) {
+	req, err := http.NewRequestWithContext(ctx, "GET", s.baseURL, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Accept", "text/html")
+	s.setUpstreamHeaders(req)
+
+	resp, err := s.http.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode > 299 {
+		return nil, fmt.Errorf("bad response from server: %d", resp.StatusCode)
+	}
+	r, err := decodedBody(resp)
+	if err != nil {
+		return nil, fmt.Errorf("unable to decompress directory listing: (%v)", err)
+	}
+	page, err := io.ReadAll(io.LimitReader(r, maxListingSize))
+	if err != nil {
+		return nil, err
+	}
+
+	files := parseListing(page)
+	if len(files) == 0 {
+		return nil, fmt.Errorf("no files found in the directory listing")
+	}
+	return files, nil
+}
+
+// diffListing compares two listings, with each group sorted by name
+func diffListing(old, current map[string]string) *DirectoryChange {
+	c := &DirectoryChange{}
+	for name, modified := range current {
+		prev, ok := old[name]
+		switch {
+		case !ok:
+			c.Added = append(c.Added, ListedFile{Name: name, Modified: modified})
+		case prev != modified:
+			c.Changed = append(c.Changed, ListedFile{Name: name, Modified: modified})
+		}
+	}
+	for name, modified := range old {
+		if _, ok := current[name]; !ok {
+			c.Removed = append(c.Removed, ListedFile{Name: name, Modified: modified})
+		}
+	}
+	for _, files := range [][]ListedFile{c.Added, c.Changed, c.Removed} {
+		sort.Slice(files, func(i, j int) bool { return files[i].Name < files[j].Name })
+	}
+	return c
+}
+
+// checkListing fetches the directory index and announces any difference from
+// the previous fetch. The first fetch only records the listing.
+func (s *Server) checkListing(ctx context.Context) {
+	current, err := s.fetchListing(ctx)
+	if err != nil {
+		s.log.Warnf("unable to check the directory listing: (%v)", err)
+		return
+	}
+	if s.listing == nil {
+		s.listing = current
+		s.log.Infof("tracking %d files in the directory listing", len(current))
+		return
+	}
+
+	c := diffListing(s.listing, current)
+	s.listing = current
+	if len(c.Added)+len(c.Changed)+len(c.Removed) == 0 {
+		return
+	}
+	c.URL = s.baseURL
+	s.log.Infof("directory listing changed: %d new, %d updated, %d removed", len(c.Added), len(c.Changed), len(c.Removed))
+
+	for _, r := range s.activeRoutes() {
+		if !r.wantsNotices() {
+			continue
+		}
+		dn, ok := r.n.(DirectoryNotifier)
+		if !ok {
+			continue
+		}
+		err := dn.NotifyDirectoryChange(ctx, c)
+		s.metrics.countNotification(r.n.Name(), "directory", err)
+		if err != nil {
+			s.log.Errorf("unable to send directory change to %s: (%v)", r.n.Name(), err)
+			continue
+		}
+		s.log.Infof("sent directory change to %s", r.n.Name())
+	}
+}
@@ -0,0 +1,78 @@
+package arcmon
+
+import (
+	"bytes"
+	"text/template"
+)
+
+// Locale : The text of update announcements in one language, empty fields fall back to DefaultLocale
+type Locale struct {
+	Title     string `yaml:"title"`
+	Checksum  string `yaml:"checksum"`
+	Timestamp string `yaml:"timestamp"`
+	Download  string `yaml:"download"`
+	Previous  string `yaml:"previous"`
+	Built     string `yaml:"built"`
+	Signature string `yaml:"signature"`
+	// Plain is a text/template for the plain format, rendered with .Checksum, .Released and .DownloadURL
+	Plain string `yaml:"plain"`
+}
+
+// DefaultLocale is the English text used unless WithLocales says otherwise
+var DefaultLocale = Locale{
+	Title:     embedTitle,
+	Checksum:  "Checksum",
+	Timestamp: "Timestamp Version",
+	Download:  "Direct Download Link",
+	Previous:  "Previous",
+	Built:     "Build Date",
+	Signature: "Signature",
+	Plain:     "ArcDPS has updated! Checksum {{.Checksum}}, released {{.Released}}. Download: {{.DownloadURL}}",
+}
+
+// Validate checks that the plain template parses
+func (l Locale) Validate() error {
+	if l.Plain == "" {
+		return nil
+	}
+	_, err := template.New("plain").Parse(l.Plain)
+	return err
+}
+
+// withDefaults fills every empty field from DefaultLocale
+func (l Locale) withDefaults() Locale {
+	for _, f := range []struct {
+		dst *string
+		def string
+	}{
+		{&l.Title, DefaultLocale.Title},
+		{&l.Checksum, DefaultLocale.Checksum},
+		{&l.Timestamp, DefaultLocale.Timestamp},
+		{&l.Download, DefaultLocale.Download},
+		{&l.Previous, DefaultLocale.Previous},
+		{&l.Built, DefaultLocale.Built},
+		{&l.Signature, DefaultLocale.Signature},
+		{&l.Plain, DefaultLocale.Plain},
+	} {
+		if *f.dst == "" {
+			*f.dst = f.def
+		}
+	}
+	return l
+}
+
+// renderPlain executes the plain template, falling back to the English one if it fails
+func (l Locale) renderPlain(data interface{}) string {
+	for _, text := range []string{l.Plain, DefaultLocale.Plain} {
+		tmpl, err := template.New("plain").Parse(text)
+		if err != nil {
+			continue
+		}
+		var buf bytes.Buffer
+		if err := tmpl.Execute(&buf, data); err != nil {
+			continue
+		}
+		return buf.String()
+	}
+	return ""
+}
@@ -0,0 +1,157 @@
+package arcmon
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// metrics holds the counters served on /metrics in the Prometheus text format
+type metrics struct {
+	mu            sync.Mutex
+	checks        map[string]uint64
+	checkFailures map[string]uint64
+	notifications map[notificationKey]uint64
+	panics        uint64
+}
+
+type notificationKey struct {
+	notifier, event, result string
+}
+
+func newMetrics() *metrics {
+	return &metrics{
+		checks:        make(map[string]uint64),
+		checkFailures: make(map[string]uint64),
+		notifications: make(map[notificationKey]uint64),
+	}
+}
+
+func result(err error) string {
+	if err != nil {
+		return "failure"
+	}
+	return "success"
+}
+
+func (m *metrics) countCheck(err error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.checks[result(err)]++
+	if err != nil {
+		m.checkFailures[failureReason(err)]++
+	}
+}
+
+// countSkipped counts a check the circuit breaker didn't let through
+func (m *metrics) countSkipped() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.checks["skipped"]++
+}
+
+func (m *metrics) countNotification(notifier, event string, err error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.notifications[notificationKey{notifier, event, result(err)}]++
+}
+
+func (m *metrics) countPanic() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.panics++
+}
+
+// write renders every metric, with series sorted so the output is stable
+func (m *metrics) write(w io.Writer) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	fmt.Fprintln(w, "# HELP arcmon_checks_total Checksum checks performed, by result, or skipped by the circuit breaker.")
+	fmt.Fprintln(w, "# TYPE arcmon_checks_total counter")
+	results := make([]string, 0, len(m.checks))
+	for r := range m.checks {
+		results = append(results, r)
+	}
+	sort.Strings(results)
+	for _, r := range results {
+		fmt.Fprintf(w, "arcmon_checks_total{result=%s} %d\n", quoteLabel(r), m.checks[r])
+	}
+
+	fmt.Fprintln(w, "# HELP arcmon_check_failures_total Failed checksum checks, by reason: dns, timeout, connection, status or other.")
+	fmt.Fprintln(w, "# TYPE arcmon_check_failures_total counter")
+	reasons := make([]string, 0, len(m.checkFailures))
+	for r := range m.checkFailures {
+		reasons = append(reasons, r)
+	}
+	sort.Strings(reasons)
+	for _, r := range reasons {
+		fmt.Fprintf(w, "arcmon_check_failures_total{reason=%s} %d\n", quoteLabel(r), m.checkFailures[r])
+	}
+
+	fmt.Fprintln(w, "# HELP arcmon_notifications_total Notifications sent, by notifier, event and result.")
+	fmt.Fprintln(w, "# TYPE arcmon_notifications_total counter")
+	keys := make([]notificationKey, 0, len(m.notifications))
+	for k := range m.notifications {
+		keys = append(keys, k)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		a, b := keys[i], keys[j]
+		if a.notifier != b.notifier {
+			return a.notifier < b.notifier
+		}
+		if a.event != b.event {
+			return a.event < b.event
+		}
+		return a.result < b.result
+	})
+	for _, k := range keys {
+		fmt.Fprintf(w, "arcmon_notifications_total{notifier=%s,event=%s,result=%s} %d\n",
+			quoteLabel(k.notifier), quoteLabel(k.event), quoteLabel(k.result), m.notifications[k])
+	}
+
+	fmt.Fprintln(w, "# HELP arcmon_panics_total Panics recovered from while checking or sending digests.")
+	fmt.Fprintln(w, "# TYPE arcmon_panics_total counter")
+	fmt.Fprintf(w, "arcmon_panics_total %d\n", m.panics)
+}
+
+// writeCurrentVersion renders a gauge with the tracked checksum as its label,
+// so alert rules can fire on the series changing. Only the current checksum is
+// ever exposed, nothing before seeding.
+func writeCurrentVersion(w io.Writer, checksum string) {
+	fmt.Fprintln(w, "# HELP arcmon_current_version The arcdps checksum currently tracked, always 1.")
+	fmt.Fprintln(w, "# TYPE arcmon_current_version gauge")
+	if checksum != "" {
+		fmt.Fprintf(w, "arcmon_current_version{checksum=%s} 1\n", quoteLabel(checksum))
+	}
+}
+
+// quoteLabel escapes a label value as the text exposition format requires
+func quoteLabel(v string) string {
+	return `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`).Replace(v) + `"`
+}
+
+func (s *Server) handleMetrics(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	s.metrics.write(w)
+
+	s.arcdps.RLock()
+	checksum := s.arcdps.CheckSum
+	s.arcdps.RUnlock()
+	writeCurrentVersion(w, checksum)
+
+	open := 0
+	if s.CircuitState() == CircuitOpen {
+		open = 1
+	}
+	fmt.Fprintln(w, "# HELP arcmon_circuit_open Whether checks are being skipped after repeated failures.")
+	fmt.Fprintln(w, "# TYPE arcmon_circuit_open gauge")
+	fmt.Fprintf(w, "arcmon_circuit_open %d\n", open)
+}
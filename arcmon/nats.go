@@ -0,0 +1,363 @@
+package arcmon
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// DefaultNATSSubject is the subject events are published on unless configured otherwise
+const DefaultNATSSubject = "arcdps.events"
+
+const (
+	// natsMaxPending caps the events held while NATS is unreachable, the oldest are dropped past it
+	natsMaxPending = 100
+	natsTimeout    = 5 * time.Second
+	natsPort       = "4222"
+)
+
+// NATSConfig : Settings for publishing events to a NATS subject, for consumers
+// that handle delivery themselves
+type NATSConfig struct {
+	// URL is nats://host[:port], with user:password@ or token@ to authenticate
+	URL     string
+	Subject string
+	// Events filters what is sent, see ParseEventFilter
+	Events string
+}
+
+// Validate checks the settings without connecting
+func (c NATSConfig) Validate() error {
+	u, err := url.Parse(c.URL)
+	if err != nil || u.Scheme != "nats" || u.Hostname() == "" {
+		return fmt.Errorf("invalid URL %q, must be nats://host:port", c.URL)
+	}
+	if !validSubject(c.Subject) {
+		return fmt.Errorf("invalid subject %q", c.Subject)
+	}
+	return nil
+}
+
+// validSubject reports whether s can be published to: dot separated tokens
+// without whitespace or the wildcards only subscribers may use
+func validSubject(s string) bool {
+	for _, token := range strings.Split(s, ".") {
+		if token == "" || strings.ContainsAny(token, " \t\r\n*>") {
+			return false
+		}
+	}
+	return true
+}
+
+// natsConnect : The CONNECT message sent after the server's INFO
+type natsConnect struct {
+	Verbose   bool   `json:"verbose"`
+	Pedantic  bool   `json:"pedantic"`
+	Name      string `json:"name"`
+	Lang      string `json:"lang"`
+	User      string `json:"user,omitempty"`
+	Pass      string `json:"pass,omitempty"`
+	AuthToken string `json:"auth_token,omitempty"`
+}
+
+// NATSNotifier publishes every event as the same JSON the generic webhook
+// receives. It speaks the NATS text protocol directly, keeping one connection
+// open and answering the server's pings on it. Events are held, up to
+// natsMaxPending, while NATS is unreachable and delivered in order once a
+// background reconnect succeeds, so they count as sent. Close makes a last
+// attempt at delivering any still held.
+type NATSNotifier struct {
+	instance
+	addr    string
+	subject string
+	connect []byte
+	clock   Clock
+	log     logrus.FieldLogger
+
+	// ctx is cancelled by Close, stopping the reconnect
+	ctx  context.Context
+	stop context.CancelFunc
+	// reconnect is the running reconnect, if there is one
+	reconnect sync.WaitGroup
+
+	mu           sync.Mutex
+	conn         net.Conn
+	pending      [][]byte
+	reconnecting bool
+}
+
+func NewNATSNotifier(cfg NATSConfig) (*NATSNotifier, error) {
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+	u, _ := url.Parse(cfg.URL)
+	port := u.Port()
+	if port == "" {
+		port = natsPort
+	}
+
+	c := natsConnect{Name: "arc-monitor", Lang: "go"}
+	if u.User != nil {
+		if pass, ok := u.User.Password(); ok {
+			c.User, c.Pass = u.User.Username(), pass
+		} else {
+			c.AuthToken = u.User.Username()
+		}
+	}
+	connect, err := json.Marshal(c)
+	if err != nil {
+		return nil, err
+	}
+	ctx, stop := context.WithCancel(context.Background())
+	return &NATSNotifier{
+		addr:    net.JoinHostPort(u.Hostname(), port),
+		subject: cfg.Subject,
+		connect: connect,
+		clock:   realClock{},
+		log:     logrus.StandardLogger(),
+		ctx:     ctx,
+		stop:    stop,
+	}, nil
+}
+
+func (n *NATSNotifier) Name() string { return n.named("nats") }
+
+func (n *NATSNotifier) useClock(c Clock) { n.clock = c }
+
+func (n *NATSNotifier) useLogger(l logrus.FieldLogger) { n.log = l }
+
+func (n *NATSNotifier) Notify(ctx context.Context, u *Update) error {
+	return n.publish(updateEvent(u))
+}
+
+func (n *NATSNotifier) NotifyFailure(ctx context.Context, f *Failure) error {
+	return n.publish(failureEvent(f))
+}
+
+func (n *NATSNotifier) NotifyUnavailable(ctx context.Context, u *Unavailable) error {
+	return n.publish(unavailableEvent(u))
+}
+
+// publish holds event and writes everything held if there's a connection.
+// Connecting is left to the background reconnect, so a slow or unreachable
+// server never holds up the check that sent the event.
+func (n *NATSNotifier) publish(event genericEvent) error {
+	body, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	if n.ctx.Err() != nil {
+		return fmt.Errorf("NATS notifier is closed")
+	}
+	// queued first so that a failed write leaves it to the reconnect
+	n.pending = append(n.pending, body)
+	if len(n.pending) > natsMaxPending {
+		n.log.Warnf("NATS has been unreachable for %d events, dropping the oldest", natsMaxPending)
+		n.pending = n.pending[1:]
+	}
+	if n.conn != nil {
+		err := n.flushLocked()
+		if err == nil {
+			return nil
+		}
+		n.log.Warnf("unable to publish to NATS, holding %d events until it's back: (%v)", len(n.pending), err)
+	}
+	n.reconnectLocked()
+	return nil
+}
+
+// flushLocked publishes every pending event on the open connection, stopping
+// at the first that fails. The caller must hold mu.
+func (n *NATSNotifier) flushLocked() error {
+	for len(n.pending) > 0 {
+		body := n.pending[0]
+		msg := fmt.Sprintf("PUB %s %d\r\n%s\r\n", n.subject, len(body), body)
+		n.conn.SetWriteDeadline(time.Now().Add(natsTimeout))
+		if _, err := n.conn.Write([]byte(msg)); err != nil {
+			n.conn.Close()
+			n.conn = nil
+			return err
+		}
+		n.pending = n.pending[1:]
+	}
+	return nil
+}
+
+// dial opens a connection and completes the handshake, a PING answered with
+// PONG confirming the server accepted CONNECT. It doesn't touch the notifier's
+// state, so it's called without holding mu.
+func (n *NATSNotifier) dial(ctx context.Context) (net.Conn, *bufio.Reader, error) {
+	d := net.Dialer{Timeout: natsTimeout}
+	conn, err := d.DialContext(ctx, "tcp", n.addr)
+	if err != nil {
+		return nil, nil, err
+	}
+	conn.SetDeadline(time.Now().Add(natsTimeout))
+	r := bufio.NewReader(conn)
+
+	line, err := r.ReadString('\n')
+	if err != nil {
+		conn.Close()
+		return nil, nil, err
+	}
+	var info struct {
+		TLSRequired bool `json:"tls_required"`
+	}
+	if !strings.HasPrefix(line, "INFO ") || json.Unmarshal([]byte(strings.TrimPrefix(line, "INFO ")), &info) != nil {
+		conn.Close()
+		return nil, nil, fmt.Errorf("unexpected greeting from NATS: %q", strings.TrimSpace(line))
+	}
+	if info.TLSRequired {
+		conn.Close()
+		return nil, nil, fmt.Errorf("NATS server requires TLS, which isn't supported")
+	}
+
+	if _, err := fmt.Fprintf(conn, "CONNECT %s\r\nPING\r\n", n.connect); err != nil {
+		conn.Close()
+		return nil, nil, err
+	}
+	line, err = r.ReadString('\n')
+	if err != nil {
+		conn.Close()
+		return nil, nil, err
+	}
+	if strings.TrimSpace(line) != "PONG" {
+		conn.Close()
+		return nil, nil, fmt.Errorf("NATS refused the connection: %s", strings.TrimSpace(line))
+	}
+
+	conn.SetDeadline(time.Time{})
+	return conn, r, nil
+}
+
+// connectAndFlush dials and publishes everything held on the new connection
+func (n *NATSNotifier) connectAndFlush(ctx context.Context) (int, error) {
+	conn, r, err := n.dial(ctx)
+	if err != nil {
+		return 0, err
+	}
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	if n.conn != nil {
+		n.conn.Close()
+	}
+	n.conn = conn
+	go n.read(conn, r)
+	held := len(n.pending)
+	return held, n.flushLocked()
+}
+
+// read answers pings on conn until it fails, then drops it so the next
+// publish reconnects
+func (n *NATSNotifier) read(conn net.Conn, r *bufio.Reader) {
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			n.mu.Lock()
+			if n.conn == conn {
+				n.conn = nil
+				conn.Close()
+			}
+			n.mu.Unlock()
+			return
+		}
+		switch line = strings.TrimSpace(line); {
+		case line == "PING":
+			n.mu.Lock()
+			conn.SetWriteDeadline(time.Now().Add(natsTimeout))
+			conn.Write([]byte("PONG\r\n"))
+			n.mu.Unlock()
+		case strings.HasPrefix(line, "-ERR"):
+			n.log.Warnf("NATS reported an error: %s", line)
+		}
+	}
+}
+
+// reconnectLocked starts connecting in the background, retrying with backoff
+// on the clock until the held events are delivered or Close stops it. The
+// caller must hold mu.
+func (n *NATSNotifier) reconnectLocked() {
+	if n.reconnecting || n.ctx.Err() != nil {
+		return
+	}
+	n.reconnecting = true
+	n.reconnect.Add(1)
+	go func() {
+		defer n.reconnect.Done()
+		for attempt := 1; ; attempt++ {
+			held, err := n.connectAndFlush(n.ctx)
+			if err == nil {
+				n.mu.Lock()
+				n.reconnecting = false
+				n.mu.Unlock()
+				if attempt > 1 {
+					n.log.Infof("reconnected to NATS, published %d held events", held)
+				}
+				return
+			}
+			if sleep(n.ctx, n.clock, backoff(time.Second, DefaultRetryMaxDelay, attempt, true)) != nil {
+				n.mu.Lock()
+				n.reconnecting = false
+				n.mu.Unlock()
+				return
+			}
+		}
+	}()
+}
+
+// Close stops reconnecting and, if events are still held, makes one last
+// attempt at publishing them before ctx expires. Events it couldn't deliver
+// make it return an error, as they're lost with the process.
+func (n *NATSNotifier) Close(ctx context.Context) error {
+	// under mu, so no reconnect can start once waiting for it begins
+	n.mu.Lock()
+	n.stop()
+	n.mu.Unlock()
+	stopped := make(chan struct{})
+	go func() {
+		n.reconnect.Wait()
+		close(stopped)
+	}()
+	select {
+	case <-stopped:
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+
+	n.mu.Lock()
+	held, connected := len(n.pending), n.conn != nil
+	n.mu.Unlock()
+	var err error
+	if held > 0 {
+		if connected {
+			n.mu.Lock()
+			err = n.flushLocked()
+			n.mu.Unlock()
+		} else {
+			_, err = n.connectAndFlush(ctx)
+		}
+	}
+
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	if n.conn != nil {
+		n.conn.Close()
+		n.conn = nil
+	}
+	if dropped := len(n.pending); dropped > 0 {
+		n.pending = nil
+		return fmt.Errorf("dropped %d events NATS never received: (%v)", dropped, err)
+	}
+	return nil
+}
@@ -0,0 +1,181 @@
+package arcmon
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// natsServer : A stand in for NATS that hangs up on clients while down and
+// otherwise records the payload of everything published
+type natsServer struct {
+	net.Listener
+	mu        sync.Mutex
+	down      bool
+	published []string
+}
+
+func newNATSServer(t *testing.T) *natsServer {
+	t.Helper()
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	srv := &natsServer{Listener: l}
+	t.Cleanup(func() { l.Close() })
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			go srv.serve(conn)
+		}
+	}()
+	return srv
+}
+
+func (srv *natsServer) serve(conn net.Conn) {
+	defer conn.Close()
+	srv.mu.Lock()
+	down := srv.down
+	srv.mu.Unlock()
+	if down {
+		return
+	}
+	fmt.Fprint(conn, "INFO {\"server_id\":\"test\"}\r\n")
+	r := bufio.NewReader(conn)
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			return
+		}
+		switch fields := strings.Fields(line); {
+		case len(fields) == 0:
+		case fields[0] == "PING":
+			fmt.Fprint(conn, "PONG\r\n")
+		case fields[0] == "PUB":
+			payload, err := r.ReadString('\n')
+			if err != nil {
+				return
+			}
+			srv.mu.Lock()
+			srv.published = append(srv.published, strings.TrimSpace(payload))
+			srv.mu.Unlock()
+		}
+	}
+}
+
+func (srv *natsServer) setDown(down bool) {
+	srv.mu.Lock()
+	defer srv.mu.Unlock()
+	srv.down = down
+}
+
+// checksums lists the checksums of the update events published
+func (srv *natsServer) checksums(t *testing.T) []string {
+	t.Helper()
+	srv.mu.Lock()
+	defer srv.mu.Unlock()
+	var checksums []string
+	for _, p := range srv.published {
+		var ev struct {
+			Checksum string `json:"checksum"`
+		}
+		if err := json.Unmarshal([]byte(p), &ev); err != nil {
+			t.Fatalf("published %q, not JSON: %v", p, err)
+		}
+		checksums = append(checksums, ev.Checksum)
+	}
+	return checksums
+}
+
+func newTestNATSNotifier(t *testing.T, srv *natsServer, clock Clock) *NATSNotifier {
+	t.Helper()
+	n, err := NewNATSNotifier(NATSConfig{URL: "nats://" + srv.Addr().String(), Subject: DefaultNATSSubject})
+	if err != nil {
+		t.Fatal(err)
+	}
+	n.useClock(clock)
+	n.useLogger(quietLogger())
+	t.Cleanup(func() { n.Close(context.Background()) })
+	return n
+}
+
+func TestNATSHoldsEventsUntilReconnected(t *testing.T) {
+	srv := newNATSServer(t)
+	srv.setDown(true)
+	clock := newFakeClock(testReleased)
+	n := newTestNATSNotifier(t, srv, clock)
+	ctx := context.Background()
+
+	for _, checksum := range []string{testChecksum, newChecksum} {
+		if err := n.Notify(ctx, &Update{Checksum: checksum, LastModified: testReleased}); err != nil {
+			t.Fatalf("Notify() = %v while NATS is down, want it held", err)
+		}
+	}
+	// the first connect failed and the reconnect is backing off
+	clock.waitForTimers(t, 1)
+	if got := srv.checksums(t); len(got) != 0 {
+		t.Fatalf("published %v while down", got)
+	}
+
+	srv.setDown(false)
+	clock.Advance(DefaultRetryMaxDelay)
+	waitFor(t, "the held events", func() bool { return len(srv.checksums(t)) == 2 })
+	if got := srv.checksums(t); got[0] != testChecksum || got[1] != newChecksum {
+		t.Fatalf("published %v, want the held events in order", got)
+	}
+
+	// and later events go straight out on the new connection
+	if err := n.Notify(ctx, &Update{Checksum: testChecksum, LastModified: testReleased}); err != nil {
+		t.Fatalf("Notify() = %v", err)
+	}
+	waitFor(t, "the next event", func() bool { return len(srv.checksums(t)) == 3 })
+}
+
+func TestNATSCloseDeliversHeldEvents(t *testing.T) {
+	srv := newNATSServer(t)
+	srv.setDown(true)
+	clock := newFakeClock(testReleased)
+	n := newTestNATSNotifier(t, srv, clock)
+
+	if err := n.Notify(context.Background(), &Update{Checksum: testChecksum, LastModified: testReleased}); err != nil {
+		t.Fatalf("Notify() = %v", err)
+	}
+	clock.waitForTimers(t, 1)
+
+	// back up by the time the monitor shuts down, well before the backoff ends
+	srv.setDown(false)
+	ctx, cncl := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cncl()
+	if err := n.Close(ctx); err != nil {
+		t.Fatalf("Close() = %v", err)
+	}
+	waitFor(t, "the held event", func() bool { return len(srv.checksums(t)) == 1 })
+	if err := n.Notify(context.Background(), &Update{Checksum: newChecksum}); err == nil {
+		t.Fatalf("Notify() succeeded after Close")
+	}
+}
+
+func TestNATSCloseReportsDroppedEvents(t *testing.T) {
+	srv := newNATSServer(t)
+	srv.setDown(true)
+	clock := newFakeClock(testReleased)
+	n := newTestNATSNotifier(t, srv, clock)
+
+	if err := n.Notify(context.Background(), &Update{Checksum: testChecksum, LastModified: testReleased}); err != nil {
+		t.Fatalf("Notify() = %v", err)
+	}
+	clock.waitForTimers(t, 1)
+	err := n.Close(context.Background())
+	if err == nil || !strings.Contains(err.Error(), "dropped 1 events") {
+		t.Fatalf("Close() = %v with NATS still down, want the dropped event reported", err)
+	}
+}
@@ -0,0 +1,61 @@
+package arcmon
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+)
+
+// Reasons a check failed, counted separately on /metrics
+const (
+	failureDNS        = "dns"
+	failureTimeout    = "timeout"
+	failureConnection = "connection"
+	failureStatus     = "status"
+	failureOther      = "other"
+)
+
+// dnsFailure : A check that couldn't resolve the host it fetches from, which
+// is usually local network configuration rather than deltaconnected being down
+type dnsFailure struct {
+	Host string
+	Err  error
+}
+
+func (e *dnsFailure) Error() string {
+	return fmt.Sprintf("DNS resolution failed for %s: (%v)", e.Host, e.Err)
+}
+
+func (e *dnsFailure) Unwrap() error { return e.Err }
+
+// explainDNS wraps err in a dnsFailure when it comes from resolving a host, so
+// it isn't mistaken for connectivity problems in the logs
+func explainDNS(err error) error {
+	var dnsErr *net.DNSError
+	if err == nil || !errors.As(err, &dnsErr) {
+		return err
+	}
+	return &dnsFailure{Host: dnsErr.Name, Err: err}
+}
+
+// failureReason classifies a failed check for the metrics
+func failureReason(err error) string {
+	var (
+		dnsErr *net.DNSError
+		se     *statusError
+		netErr net.Error
+		opErr  *net.OpError
+	)
+	switch {
+	case errors.As(err, &dnsErr):
+		return failureDNS
+	case errors.As(err, &se):
+		return failureStatus
+	case errors.Is(err, context.DeadlineExceeded), errors.As(err, &netErr) && netErr.Timeout():
+		return failureTimeout
+	case errors.As(err, &opErr):
+		return failureConnection
+	}
+	return failureOther
+}
@@ -0,0 +1,50 @@
+package arcmon
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestCheckReportsDNSFailure(t *testing.T) {
+	// .invalid is reserved and never resolves
+	s := NewServer(WithLogger(quietLogger()), WithBaseURL("http://arcmon-test.invalid/arcdps/"),
+		WithHTTPClient(&http.Client{Timeout: 5 * time.Second}))
+
+	err := s.check(context.Background())
+	var dns *dnsFailure
+	if !errors.As(err, &dns) {
+		t.Fatalf("check() = %v, want a DNS failure", err)
+	}
+	if dns.Host != "arcmon-test.invalid" {
+		t.Fatalf("DNS failure for %q, want arcmon-test.invalid", dns.Host)
+	}
+	if !strings.Contains(err.Error(), "DNS resolution failed for arcmon-test.invalid") {
+		t.Fatalf("error %q doesn't say resolving the host failed", err)
+	}
+
+	// counted apart from timeouts and refused connections
+	var metrics strings.Builder
+	s.metrics.write(&metrics)
+	if !strings.Contains(metrics.String(), `arcmon_check_failures_total{reason="dns"} 1`) {
+		t.Fatalf("DNS failure not counted as one:\n%s", metrics.String())
+	}
+}
+
+func TestFailureReason(t *testing.T) {
+	for _, tc := range []struct {
+		err  error
+		want string
+	}{
+		{&statusError{StatusCode: http.StatusBadGateway}, failureStatus},
+		{context.DeadlineExceeded, failureTimeout},
+		{errors.New("something else"), failureOther},
+	} {
+		if got := failureReason(tc.err); got != tc.want {
+			t.Errorf("failureReason(%v) = %q, want %q", tc.err, got, tc.want)
+		}
+	}
+}
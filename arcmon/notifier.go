@@ -0,0 +1,236 @@
+package arcmon
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// Update : Describes a newly detected arcdps release
+type Update struct {
+	Checksum     string
+	LastModified time.Time
+	DetectedAt   time.Time
+	// Previous is the checksum this release replaces, empty for the first version seen
+	Previous string
+	// DownloadURL links to the released DLL
+	DownloadURL string
+	// BuiltAt is the link time from the DLL's PE header, zero unless it was downloaded for verification
+	BuiltAt time.Time
+	// Signature is SignatureSigned or SignatureUnsigned, empty unless WithSignatureCheck looked
+	Signature string
+	// ClockSkew is set when LastModified is so far ahead of local time that our clock is suspect
+	ClockSkew bool
+	// Major is false for hotfixes released shortly after the previous version
+	Major bool
+	// Replayed marks a past release re-sent by Replay rather than a new one
+	Replayed bool
+}
+
+// Notifier is implemented by every destination an update can be announced to
+type Notifier interface {
+	Name() string
+	Notify(ctx context.Context, u *Update) error
+}
+
+// instance tells a notifier apart from others of its kind in logs and metrics,
+// NewServer numbers them when there are several
+type instance struct {
+	number int
+}
+
+func (i *instance) setNumber(n int) { i.number = n }
+
+// named returns kind, followed by the instance's number if it has one
+func (i *instance) named(kind string) string {
+	if i.number == 0 {
+		return kind
+	}
+	return fmt.Sprintf("%s#%d", kind, i.number)
+}
+
+// numbered is implemented by notifiers embedding an instance
+type numbered interface {
+	setNumber(n int)
+}
+
+// logged is implemented by notifiers that log on their own, rather than only
+// returning errors, so NewServer can hand them its logger
+type logged interface {
+	useLogger(l logrus.FieldLogger)
+}
+
+// closer is implemented by notifiers that hold something open, such as a
+// connection or events still to be delivered, until CloseNotifiers
+type closer interface {
+	Close(ctx context.Context) error
+}
+
+// CloseNotifiers releases every notifier that holds a connection or events
+// still to be delivered, giving each a last chance to send them before ctx
+// expires. Errors are joined in one.
+func (s *Server) CloseNotifiers(ctx context.Context) error {
+	var failed []string
+	for _, r := range s.notifiers {
+		c, ok := r.n.(closer)
+		if !ok {
+			continue
+		}
+		if err := c.Close(ctx); err != nil {
+			failed = append(failed, fmt.Sprintf("%s: (%v)", r.n.Name(), err))
+		}
+	}
+	if len(failed) > 0 {
+		return fmt.Errorf("%d notifiers didn't close cleanly: %s", len(failed), strings.Join(failed, ", "))
+	}
+	return nil
+}
+
+// numberNotifiers numbers the notifiers in routes that share a name, in the
+// order they were added, e.g. telegram#1 and telegram#2
+func numberNotifiers(routes []route) {
+	kinds := make(map[string]int)
+	for _, r := range routes {
+		if n, ok := r.n.(numbered); ok {
+			n.setNumber(0)
+			kinds[r.n.Name()]++
+		}
+	}
+	seen := make(map[string]int)
+	for _, r := range routes {
+		n, ok := r.n.(numbered)
+		if !ok || kinds[r.n.Name()] < 2 {
+			continue
+		}
+		kind := r.n.Name()
+		seen[kind]++
+		n.setNumber(seen[kind])
+	}
+}
+
+// discordNotifier announces updates through one of the configured Discord webhooks
+type discordNotifier struct {
+	s       *Server
+	name    string
+	webhook Webhook
+}
+
+func (d *discordNotifier) Name() string { return d.name }
+
+func (d *discordNotifier) Notify(ctx context.Context, u *Update) error {
+	payload, err := d.s.RenderWebhook(d.webhook, u)
+	if err != nil {
+		return err
+	}
+	return d.post(ctx, payload)
+}
+
+func (d *discordNotifier) NotifyFailure(ctx context.Context, f *Failure) error {
+	payload, err := d.s.marshalDiscord(d.s.inForum(d.s.buildFailurePayload(d.webhook.Format, f), failureEmbedTitle), "failure alert")
+	if err != nil {
+		return err
+	}
+	return d.post(ctx, payload)
+}
+
+func (d *discordNotifier) NotifyHeartbeat(ctx context.Context, h *Heartbeat) error {
+	payload, err := d.s.marshalDiscord(d.s.inForum(d.s.buildHeartbeatPayload(d.webhook.Format, h), heartbeatTitle), "heartbeat")
+	if err != nil {
+		return err
+	}
+	return d.post(ctx, payload)
+}
+
+func (d *discordNotifier) NotifyDirectoryChange(ctx context.Context, c *DirectoryChange) error {
+	payload, err := d.s.marshalDiscord(d.s.inForum(&discordPayload{Content: c.Summary()}, directoryChangeTitle), "directory change")
+	if err != nil {
+		return err
+	}
+	return d.post(ctx, payload)
+}
+
+func (d *discordNotifier) NotifyMonitorUpgrade(ctx context.Context, m *MonitorUpgrade) error {
+	payload, err := d.s.marshalDiscord(d.s.inForum(&discordPayload{Content: m.Summary()}, monitorUpgradeTitle), "monitor upgrade")
+	if err != nil {
+		return err
+	}
+	return d.post(ctx, payload)
+}
+
+func (d *discordNotifier) NotifyUnavailable(ctx context.Context, u *Unavailable) error {
+	payload, err := d.s.marshalDiscord(d.s.inForum(d.s.buildUnavailablePayload(d.webhook.Format, u), unavailableTitle), "unavailable notice")
+	if err != nil {
+		return err
+	}
+	return d.post(ctx, payload)
+}
+
+func (d *discordNotifier) NotifyDigest(ctx context.Context, digest *Digest) error {
+	payload, err := d.s.marshalDiscord(d.s.inForum(d.s.buildDigestPayload(d.webhook.Format, digest), digestTitle), "digest")
+	if err != nil {
+		return err
+	}
+	return d.post(ctx, payload)
+}
+
+// notify sends the update to every one of routes whose filter accepts it,
+// returning how many were told, the routes that failed and an error naming each
+func (s *Server) notify(ctx context.Context, u *Update, routes []route) (int, []route, error) {
+	ctx, all := s.startSpan(ctx, "notify", otlpKindInternal)
+	var (
+		failed    []string
+		failedTo  []route
+		delivered int
+	)
+	sent := 0
+	for _, r := range routes {
+		if !r.wantsUpdate(u) {
+			continue
+		}
+		sent++
+		nctx, sp := s.startSpan(ctx, "notify "+r.n.Name(), otlpKindClient)
+		sp.set("notifier", r.n.Name())
+		err := r.n.Notify(nctx, u)
+		s.finish(sp, err)
+		s.metrics.countNotification(r.n.Name(), "update", err)
+		if err != nil {
+			s.log.Errorf("unable to notify %s: (%v)", r.n.Name(), err)
+			failed = append(failed, fmt.Sprintf("%s: (%v)", r.n.Name(), err))
+			failedTo = append(failedTo, r)
+			continue
+		}
+		delivered++
+		s.log.Infof("notified %s of %s", r.n.Name(), u.Checksum)
+	}
+	all.set("notifiers.sent", sent)
+	all.set("notifiers.failed", len(failed))
+	var err error
+	if len(failed) > 0 {
+		err = fmt.Errorf("%d of %d notifiers failed: %s", len(failed), sent, strings.Join(failed, ", "))
+	}
+	s.finish(all, err)
+	return delivered, failedTo, err
+}
+
+// notifyFailure alerts every notifier that asked for failures
+func (s *Server) notifyFailure(ctx context.Context, f *Failure) {
+	for _, r := range s.activeRoutes() {
+		if !r.wantsFailure() {
+			continue
+		}
+		fn, ok := r.n.(FailureNotifier)
+		if !ok {
+			continue
+		}
+		err := fn.NotifyFailure(ctx, f)
+		s.metrics.countNotification(r.n.Name(), "failure", err)
+		if err != nil {
+			s.log.Errorf("unable to send failure alert to %s: (%v)", r.n.Name(), err)
+			continue
+		}
+		s.log.Infof("sent failure alert to %s", r.n.Name())
+	}
+}
@@ -0,0 +1,34 @@
+package arcmon
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestNotifiersOfTheSameKindAreNumbered(t *testing.T) {
+	var opts []Option
+	for _, chat := range []string{"1", "2"} {
+		tg, err := NewTelegramNotifier(nil, TelegramConfig{Token: "token", ChatID: chat})
+		if err != nil {
+			t.Fatal(err)
+		}
+		opts = append(opts, WithNotifier(tg))
+	}
+	gh, err := NewGitHubNotifier(nil, GitHubConfig{Token: "token", Repo: "owner/repo", Issue: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	opts = append(opts, WithNotifier(gh),
+		WithDiscordBot(DiscordBot{Token: "a", ChannelID: "1"}, DiscordBot{Token: "b", ChannelID: "2"}),
+		WithWebhook(Webhook{URL: "https://discord.com/api/webhooks/1/token"}))
+	s := NewServer(append([]Option{WithLogger(quietLogger())}, opts...)...)
+
+	var names []string
+	for _, r := range s.notifiers {
+		names = append(names, r.n.Name())
+	}
+	want := []string{"discord", "discord-bot#1", "discord-bot#2", "telegram#1", "telegram#2", "github"}
+	if !reflect.DeepEqual(names, want) {
+		t.Fatalf("notifiers named %v, want %v", names, want)
+	}
+}
@@ -0,0 +1,352 @@
+package arcmon
+
+import (
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// Option configures a Server
+type Option func(*Server)
+
+// WithState tracks arcdps, which is updated in place as new versions are seen
+func WithState(arcdps *ArcDPSVersion) Option {
+	return func(s *Server) { s.arcdps = arcdps }
+}
+
+// WithInterval sets how often the checksum is checked
+func WithInterval(d time.Duration) Option {
+	return func(s *Server) { s.interval = d }
+}
+
+// WithWebhook adds Discord webhooks to announce updates to
+func WithWebhook(webhooks ...Webhook) Option {
+	return func(s *Server) { s.webhooks = append(s.webhooks, webhooks...) }
+}
+
+// WithDiscordBot also posts updates to channels as a bot, rendered like an embed webhook
+func WithDiscordBot(bots ...DiscordBot) Option {
+	return func(s *Server) { s.bots = append(s.bots, bots...) }
+}
+
+// WithHTTPClient sets the client used for every outgoing request
+func WithHTTPClient(c *http.Client) Option {
+	return func(s *Server) { s.http = c }
+}
+
+// WithDoer is WithHTTPClient for anything that can perform a request, such as a stub in tests
+func WithDoer(d Doer) Option {
+	return func(s *Server) { s.http = d }
+}
+
+// WithBaseURL checks the checksum and links the DLL under url instead of ArcDpsURL
+func WithBaseURL(url string) Option {
+	return func(s *Server) { s.baseURL = strings.TrimSuffix(url, "/") + "/" }
+}
+
+// WithHashAlgorithm sets the algorithm of the published checksum, see
+// ParseHashAlgorithm. The checksum file is looked for under the matching
+// name, d3d9.dll.sha256sum for HashSHA256, and DLLs are verified with it.
+func WithHashAlgorithm(algorithm string) Option {
+	return func(s *Server) { s.hashAlgorithm = algorithm }
+}
+
+// WithLogger sends the server's log output to l instead of the standard logrus logger
+func WithLogger(l logrus.FieldLogger) Option {
+	return func(s *Server) { s.log = l }
+}
+
+// WithNotifier adds destinations other than Discord webhooks to announce updates to
+func WithNotifier(notifiers ...Notifier) Option {
+	return WithFilteredNotifier(EventsUpdates, notifiers...)
+}
+
+// WithFilteredNotifier adds notifiers that only receive the events selected by
+// events, see ParseEventFilter. Failures only reach notifiers implementing FailureNotifier.
+func WithFilteredNotifier(events string, notifiers ...Notifier) Option {
+	return func(s *Server) {
+		for _, n := range notifiers {
+			s.notifiers = append(s.notifiers, route{n: n, events: events})
+		}
+	}
+}
+
+// WithHotfixWindow sets how soon after the previous release an update counts as a hotfix rather than major
+func WithHotfixWindow(d time.Duration) Option {
+	return func(s *Server) { s.hotfixWindow = d }
+}
+
+// WithStore persists the tracked state every time it changes
+func WithStore(store Store) Option {
+	return func(s *Server) { s.store = store }
+}
+
+// WithEventSocket publishes every detected update to es
+func WithEventSocket(es *EventSocket) Option {
+	return func(s *Server) { s.events = es }
+}
+
+// WithAnnounceCooldown sets how long the same checksum is protected from being announced again
+func WithAnnounceCooldown(d time.Duration) Option {
+	return func(s *Server) { s.announceCooldown = d }
+}
+
+// WithClockSkewThreshold sets how far ahead of local time Last-Modified may be before the local clock is suspect
+func WithClockSkewThreshold(d time.Duration) Option {
+	return func(s *Server) { s.clockSkewThreshold = d }
+}
+
+// WithStartupRetries sets how many times the startup check is attempted and the
+// base delay between attempts, which doubles after each one
+func WithStartupRetries(attempts int, delay time.Duration) Option {
+	return func(s *Server) {
+		s.startupRetries = attempts
+		s.startupRetryDelay = delay
+	}
+}
+
+// WithRetryLimits caps the delay between startup attempts at maxDelay and the
+// time spent retrying at maxElapsed, zero for no limit. Retrying stops at
+// whichever of these and WithStartupRetries' attempts is reached first.
+func WithRetryLimits(maxDelay, maxElapsed time.Duration) Option {
+	return func(s *Server) {
+		s.retryMaxDelay = maxDelay
+		s.retryMaxElapsed = maxElapsed
+	}
+}
+
+// WithThumbnail shows the image at url in the corner of embed notifications
+func WithThumbnail(url string) Option {
+	return func(s *Server) { s.thumbnail = url }
+}
+
+// WithBranding overrides the footer and author of embed notifications
+func WithBranding(b Branding) Option {
+	return func(s *Server) { s.branding = b }
+}
+
+// WithLocales renders update announcements in each of locales, see Locale.
+// Failure alerts and heartbeats stay in English.
+func WithLocales(locales ...Locale) Option {
+	return func(s *Server) { s.locales = locales }
+}
+
+// WithAutoDisableDeadWebhooks stops posting to a Discord webhook for the rest
+// of the run once Discord answers 404, meaning it was deleted, rather than
+// failing against it on every notification. Disabled webhooks are listed on /healthz.
+func WithAutoDisableDeadWebhooks(disable bool) Option {
+	return func(s *Server) { s.disableDeadWebhooks = disable }
+}
+
+// WithPreviousChecksum shows the checksum each release replaces in Discord messages
+func WithPreviousChecksum(show bool) Option {
+	return func(s *Server) { s.showPrevious = show }
+}
+
+// WithForumPosts creates a forum post for every message sent to a Discord
+// webhook, as webhooks into forum channels must. Updates are posted in a thread
+// named by the threadName template, DefaultForumThreadName when empty, with
+// .Checksum, .ShortChecksum and .Released available to it.
+func WithForumPosts(threadName string) Option {
+	return func(s *Server) {
+		if threadName == "" {
+			threadName = DefaultForumThreadName
+		}
+		s.forumThread = threadName
+	}
+}
+
+// WithInlineFields lays the checksum and timestamp of update embeds out side
+// by side, the default, or when false as full width blocks, which read better on mobile
+func WithInlineFields(inline bool) Option {
+	return func(s *Server) { s.blockFields = !inline }
+}
+
+// WithEmbedTimestamp sets the release time as the embed's native timestamp,
+// which Discord shows in every reader's own timezone. It is on by default and
+// the Timestamp Version field is kept either way.
+func WithEmbedTimestamp(show bool) Option {
+	return func(s *Server) { s.hideTimestamp = !show }
+}
+
+// WithNotifyOnSeed announces the version found on the very first check instead of quietly adopting it
+func WithNotifyOnSeed(notify bool) Option {
+	return func(s *Server) { s.notifyOnSeed = notify }
+}
+
+// WithDLLVerification downloads the DLL of every new version, capped at maxSize
+// bytes, and only accepts the version once its hash matches the published checksum
+func WithDLLVerification(maxSize int64) Option {
+	return func(s *Server) {
+		s.verify = true
+		s.maxDLLSize = maxSize
+	}
+}
+
+// WithHTTPTrace logs a breakdown of every checksum request at debug level, how
+// long DNS, connecting, the TLS handshake and the first byte took, to find
+// where slow checks spend their time
+func WithHTTPTrace(trace bool) Option {
+	return func(s *Server) { s.httpTrace = trace }
+}
+
+// WithSignatureCheck reports whether DLLs downloaded by WithDLLVerification
+// carry an Authenticode signature in their announcements, warning when one
+// does, since arcdps is released unsigned
+func WithSignatureCheck(check bool) Option {
+	return func(s *Server) { s.checkSignature = check }
+}
+
+// WithRetryableStatus sets the response codes that make the startup check try
+// again, DefaultRetryableStatus unless set
+func WithRetryableStatus(codes ...int) Option {
+	return func(s *Server) { s.retryableStatus = codes }
+}
+
+// WithRetryJitter controls whether retry delays are randomised, on by default
+func WithRetryJitter(jitter bool) Option {
+	return func(s *Server) { s.retryJitter = jitter }
+}
+
+// WithWatchdog reports when no check has completed for staleAfter, sending a
+// failure alert if alert is set and then calling onStale, if it isn't nil
+func WithWatchdog(staleAfter time.Duration, alert bool, onStale func()) Option {
+	return func(s *Server) {
+		s.staleAfter = staleAfter
+		s.staleAlert = alert
+		s.onStale = onStale
+	}
+}
+
+// WithStatusWindow sets how recent the last successful check must be for
+// /status to answer OK, three intervals when unset
+func WithStatusWindow(d time.Duration) Option {
+	return func(s *Server) { s.statusWindow = d }
+}
+
+// WithRoute serves h on pattern alongside the built in health endpoints
+func WithRoute(pattern string, h http.Handler) Option {
+	return func(s *Server) {
+		if s.routes == nil {
+			s.routes = make(map[string]http.Handler)
+		}
+		s.routes[pattern] = h
+	}
+}
+
+// WithPathPrefix serves the HTTP endpoints under prefix, e.g. "/arcmon" serves
+// /arcmon/healthz, for running behind a shared reverse proxy
+func WithPathPrefix(prefix string) Option {
+	return func(s *Server) { s.pathPrefix = NormalizePathPrefix(prefix) }
+}
+
+// NormalizePathPrefix returns prefix with a single leading slash and no trailing one, "" for the root
+func NormalizePathPrefix(prefix string) string {
+	prefix = strings.Trim(strings.TrimSpace(prefix), "/")
+	if prefix == "" {
+		return ""
+	}
+	return "/" + prefix
+}
+
+// WithHeartbeat posts a heartbeat to every notifier receiving all updates once
+// after passes with no new release, and again every after until one arrives
+func WithHeartbeat(after time.Duration) Option {
+	return func(s *Server) { s.heartbeatAfter = after }
+}
+
+// WithDirectoryWatch also watches the directory index under the base URL,
+// announcing new files and changed timestamps to notifiers receiving all updates
+func WithDirectoryWatch(watch bool) Option {
+	return func(s *Server) { s.watchListing = watch }
+}
+
+// WithCircuitBreaker skips checks for cooldown once threshold have failed in a
+// row, then probes with a single check. A threshold of zero always checks.
+func WithCircuitBreaker(threshold int, cooldown time.Duration) Option {
+	return func(s *Server) { s.breaker = breaker{threshold: threshold, cooldown: cooldown} }
+}
+
+// WithBaseline only announces releases made after t, older ones are recorded
+// without a notification. Unlike WithNotifyOnSeed it applies to every version,
+// so a monitor deployed with a baseline of today stays quiet until the next release.
+func WithBaseline(t time.Time) Option {
+	return func(s *Server) { s.baseline = t }
+}
+
+// WithAlertGracePeriod holds back failure alerts for checks failing within d
+// of Tick starting, so a deploy's network hiccups don't alert. If they're still
+// failing afterwards the alert goes out as usual, zero alerts straight away.
+func WithAlertGracePeriod(d time.Duration) Option {
+	return func(s *Server) { s.alertGrace = d }
+}
+
+// WithUnavailableAfter sets how many checks in a row must find the checksum
+// missing before every notifier is told it's no longer available
+func WithUnavailableAfter(checks int) Option {
+	return func(s *Server) { s.unavailableAfter = checks }
+}
+
+// WithSSEClientBuffer sets how many events each /events client may fall behind
+// before further ones are dropped for it and reported as missed
+func WithSSEClientBuffer(n int) Option {
+	return func(s *Server) { s.broadcaster.buffer = n }
+}
+
+// WithDigest holds updates back and posts everything detected in each interval
+// as one digest instead, skipping intervals without any
+func WithDigest(interval time.Duration) Option {
+	return func(s *Server) { s.digestInterval = interval }
+}
+
+// WithEmbedContent also sends the text of the plain format as the content of
+// every embed message, so receivers that ignore embeds still show something.
+// It is on by default, Discord shows both and false leaves only the embed.
+func WithEmbedContent(on bool) Option {
+	return func(s *Server) { s.embedContent = on }
+}
+
+// WithSelfUpgradeNotice records version, the running build, in the state and
+// announces it to notifiers receiving every update whenever it differs from
+// the one recorded by the last run, as an audit trail of deployments
+func WithSelfUpgradeNotice(version string) Option {
+	return func(s *Server) { s.monitorVersion = version }
+}
+
+// WithUpstreamHeaders adds headers to every request for deltaconnected, the
+// checksum, the DLL and the directory listing, for CDNs and proxies that
+// won't serve them without. See ValidateHeader.
+func WithUpstreamHeaders(headers map[string]string) Option {
+	return func(s *Server) { s.upstreamHeaders = headers }
+}
+
+// WithOTLPTraces exports a trace of every tick, with spans for fetching and
+// parsing the checksum and for each notifier told about an update, to the
+// OTLP/HTTP collector at endpoint. service is reported as service.name.
+func WithOTLPTraces(endpoint, service string) Option {
+	return func(s *Server) {
+		if endpoint == "" {
+			return
+		}
+		s.tracer = &tracer{url: strings.TrimRight(endpoint, "/") + "/v1/traces", service: service}
+	}
+}
+
+// WithClock replaces the wall clock the server schedules by, for driving it
+// deterministically
+func WithClock(c Clock) Option {
+	return func(s *Server) { s.clock = c }
+}
+
+// WithHistorySize sets how many versions are kept in the history
+func WithHistorySize(n int) Option {
+	return func(s *Server) { s.historySize = n }
+}
+
+// WithHistoryArchive appends versions trimmed from the history to path as JSON
+// lines rather than dropping them
+func WithHistoryArchive(path string) Option {
+	return func(s *Server) { s.historyArchive = path }
+}
@@ -0,0 +1,228 @@
+package arcmon
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// DefaultOTelServiceName is the service.name traces are exported under unless configured otherwise
+const DefaultOTelServiceName = "arcmon"
+
+// otlpExportTimeout bounds how long exporting one tick's spans may take
+const otlpExportTimeout = 10 * time.Second
+
+// OTLP span kinds and status codes, see the opentelemetry-proto trace definitions
+const (
+	otlpKindInternal = 1
+	otlpKindClient   = 3
+	otlpStatusOK     = 1
+	otlpStatusError  = 2
+)
+
+// tracer exports a trace per tick to an OTLP/HTTP collector, JSON encoded so
+// no protobuf or SDK dependency is needed. Spans are buffered until the root
+// span of their trace ends and then sent together.
+type tracer struct {
+	url     string
+	service string
+}
+
+// span : One timed step of a tick. A nil span, as started when tracing is
+// off, ignores everything done to it.
+type span struct {
+	trace    *traceBuffer
+	traceID  string
+	id       string
+	parentID string
+	name     string
+	kind     int
+	start    time.Time
+	end      time.Time
+	attrs    []otlpAttribute
+	err      error
+}
+
+// traceBuffer collects the finished spans of one trace
+type traceBuffer struct {
+	mu    sync.Mutex
+	spans []*span
+}
+
+type spanKey struct{}
+
+// startSpan starts a span named name, a child of the span in ctx if there is
+// one, and returns a context carrying it
+func (s *Server) startSpan(ctx context.Context, name string, kind int) (context.Context, *span) {
+	if s.tracer == nil {
+		return ctx, nil
+	}
+	sp := &span{id: randomHex(8), name: name, kind: kind, start: s.clock.Now()}
+	if parent, ok := ctx.Value(spanKey{}).(*span); ok {
+		sp.trace, sp.traceID, sp.parentID = parent.trace, parent.traceID, parent.id
+	} else {
+		sp.trace, sp.traceID = &traceBuffer{}, randomHex(16)
+	}
+	return context.WithValue(ctx, spanKey{}, sp), sp
+}
+
+// spanFrom returns the span carried by ctx, nil if there isn't one
+func spanFrom(ctx context.Context) *span {
+	sp, _ := ctx.Value(spanKey{}).(*span)
+	return sp
+}
+
+// set records an attribute, value may be a string, bool or int
+func (sp *span) set(key string, value interface{}) {
+	if sp == nil {
+		return
+	}
+	var v otlpValue
+	switch value := value.(type) {
+	case bool:
+		v.Bool = &value
+	case int:
+		i := strconv.Itoa(value)
+		v.Int = &i
+	default:
+		str := fmt.Sprint(value)
+		v.String = &str
+	}
+	sp.attrs = append(sp.attrs, otlpAttribute{Key: key, Value: v})
+}
+
+// finish ends the span, failed if err is set. Finishing the root span
+// exports the whole trace in the background.
+func (s *Server) finish(sp *span, err error) {
+	if sp == nil {
+		return
+	}
+	sp.end, sp.err = s.clock.Now(), err
+	sp.trace.mu.Lock()
+	sp.trace.spans = append(sp.trace.spans, sp)
+	spans := sp.trace.spans
+	sp.trace.mu.Unlock()
+	if sp.parentID == "" {
+		go s.exportSpans(spans)
+	}
+}
+
+// exportSpans posts spans to the collector, failures are only logged as
+// traces aren't worth retrying
+func (s *Server) exportSpans(spans []*span) {
+	body, err := json.Marshal(s.tracer.request(spans))
+	if err != nil {
+		s.log.Warnf("unable to encode trace: (%v)", err)
+		return
+	}
+	ctx, cncl := context.WithTimeout(context.Background(), otlpExportTimeout)
+	defer cncl()
+	req, err := http.NewRequestWithContext(ctx, "POST", s.tracer.url, bytes.NewReader(body))
+	if err != nil {
+		s.log.Warnf("unable to export trace: (%v)", err)
+		return
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := s.http.Do(req)
+	if err != nil {
+		s.log.Warnf("unable to export trace: (%v)", err)
+		return
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode > 299 {
+		detail, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		s.log.Warnf("unable to export trace: collector answered %d (%s)", resp.StatusCode, strings.TrimSpace(string(detail)))
+		return
+	}
+	s.log.Debugf("exported %d spans", len(spans))
+}
+
+// otlpRequest and the types below are the JSON encoding of an
+// ExportTraceServiceRequest, with ids in hex and timestamps as strings
+type otlpRequest struct {
+	ResourceSpans []otlpResourceSpans `json:"resourceSpans"`
+}
+
+type otlpResourceSpans struct {
+	Resource struct {
+		Attributes []otlpAttribute `json:"attributes"`
+	} `json:"resource"`
+	ScopeSpans []otlpScopeSpans `json:"scopeSpans"`
+}
+
+type otlpScopeSpans struct {
+	Scope struct {
+		Name string `json:"name"`
+	} `json:"scope"`
+	Spans []otlpSpan `json:"spans"`
+}
+
+type otlpSpan struct {
+	TraceID      string          `json:"traceId"`
+	SpanID       string          `json:"spanId"`
+	ParentSpanID string          `json:"parentSpanId,omitempty"`
+	Name         string          `json:"name"`
+	Kind         int             `json:"kind"`
+	Start        string          `json:"startTimeUnixNano"`
+	End          string          `json:"endTimeUnixNano"`
+	Attributes   []otlpAttribute `json:"attributes,omitempty"`
+	Status       otlpStatus      `json:"status"`
+}
+
+type otlpStatus struct {
+	Code    int    `json:"code"`
+	Message string `json:"message,omitempty"`
+}
+
+type otlpAttribute struct {
+	Key   string    `json:"key"`
+	Value otlpValue `json:"value"`
+}
+
+type otlpValue struct {
+	String *string `json:"stringValue,omitempty"`
+	Bool   *bool   `json:"boolValue,omitempty"`
+	Int    *string `json:"intValue,omitempty"`
+}
+
+func (t *tracer) request(spans []*span) otlpRequest {
+	service := t.service
+	rs := otlpResourceSpans{ScopeSpans: []otlpScopeSpans{{}}}
+	rs.Resource.Attributes = []otlpAttribute{{Key: "service.name", Value: otlpValue{String: &service}}}
+	scope := &rs.ScopeSpans[0]
+	scope.Scope.Name = "github.com/mythwright/arc-monitor/arcmon"
+	for _, sp := range spans {
+		out := otlpSpan{
+			TraceID:      sp.traceID,
+			SpanID:       sp.id,
+			ParentSpanID: sp.parentID,
+			Name:         sp.name,
+			Kind:         sp.kind,
+			Start:        strconv.FormatInt(sp.start.UnixNano(), 10),
+			End:          strconv.FormatInt(sp.end.UnixNano(), 10),
+			Attributes:   sp.attrs,
+			Status:       otlpStatus{Code: otlpStatusOK},
+		}
+		if sp.err != nil {
+			out.Status = otlpStatus{Code: otlpStatusError, Message: sp.err.Error()}
+		}
+		scope.Spans = append(scope.Spans, out)
+	}
+	return otlpRequest{ResourceSpans: []otlpResourceSpans{rs}}
+}
+
+// randomHex returns n random bytes hex encoded, for trace and span ids
+func randomHex(n int) string {
+	b := make([]byte, n)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
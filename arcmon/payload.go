@@ -0,0 +1,368 @@
+package arcmon
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+)
+
+const (
+	embedTitle        = "ArcDPS has updated!"
+	embedColor        = 12124160
+	failureEmbedTitle = "ArcDPS Monitor checks are failing"
+	failureEmbedColor = 15158332
+	heartbeatTitle    = "ArcDPS Monitor is still watching"
+	heartbeatColor    = 9807270
+	unavailableTitle  = "ArcDPS is no longer available"
+	unavailableColor  = 15105570
+	digestTitle       = "ArcDPS updates digest"
+	// monitorUpgradeTitle is only used to name forum posts, upgrades are sent as plain text
+	monitorUpgradeTitle = "ArcDPS Monitor upgraded"
+	// directoryChangeTitle is only used to name forum posts, directory changes are sent as plain text
+	directoryChangeTitle = "ArcDPS download directory changed"
+	embedAuthorName      = "ArcDPS Monitor"
+	embedAuthorIcon      = "https://wiki.guildwars2.com/images/0/03/Specter_icon_(highres).png"
+)
+
+// discordPayload : Body of a webhook execution, see https://discord.com/developers/docs/resources/webhook#execute-webhook
+type discordPayload struct {
+	Content string         `json:"content,omitempty"`
+	Embeds  []discordEmbed `json:"embeds,omitempty"`
+	// ThreadName creates a forum post to send the message in, only webhooks into forum channels need one
+	ThreadName string `json:"thread_name,omitempty"`
+}
+
+type discordEmbed struct {
+	Title     string            `json:"title,omitempty"`
+	Color     int               `json:"color,omitempty"`
+	Fields    []discordField    `json:"fields,omitempty"`
+	Author    *discordAuthor    `json:"author,omitempty"`
+	Footer    *discordFooter    `json:"footer,omitempty"`
+	Thumbnail *discordThumbnail `json:"thumbnail,omitempty"`
+	// Timestamp is shown in the footer, in each reader's own timezone
+	Timestamp string `json:"timestamp,omitempty"`
+}
+
+type discordField struct {
+	Name   string `json:"name"`
+	Value  string `json:"value"`
+	Inline bool   `json:"inline,omitempty"`
+}
+
+type discordAuthor struct {
+	Name    string `json:"name"`
+	IconURL string `json:"icon_url,omitempty"`
+}
+
+type discordFooter struct {
+	Text string `json:"text"`
+}
+
+type discordThumbnail struct {
+	URL string `json:"url"`
+}
+
+// buildPayload renders u in the requested webhook format, once for each
+// configured locale: an embed each, or a line each in the plain format
+func (s *Server) buildPayload(format string, u *Update) *discordPayload {
+	locales := s.locales
+	if len(locales) == 0 {
+		locales = []Locale{DefaultLocale}
+	}
+	showPrevious := s.showPrevious && u.Previous != ""
+
+	p := &discordPayload{}
+	for _, l := range locales {
+		l = l.withDefaults()
+		if format == WebhookFormatPlain || s.embedContent {
+			line := buildPlainText(u, l)
+			if showPrevious {
+				line += fmt.Sprintf(" %s: %s", l.Previous, u.Previous)
+			}
+			if !u.BuiltAt.IsZero() {
+				line += fmt.Sprintf(" %s: %s", l.Built, u.BuiltAt.Format(time.RFC1123))
+			}
+			if u.Signature != "" {
+				line += fmt.Sprintf(" %s: %s", l.Signature, u.Signature)
+			}
+			if u.Replayed {
+				line = replayPrefix + line
+			}
+			if p.Content != "" {
+				p.Content += "\n"
+			}
+			p.Content += line
+		}
+		if format == WebhookFormatPlain {
+			continue
+		}
+
+		e := buildEmbed(u, s.interval, l)
+		if showPrevious {
+			// right after the new checksum so the two read together
+			e.Fields = append([]discordField{e.Fields[0], {Name: l.Previous, Value: fmt.Sprintf("`%s`", u.Previous), Inline: true}}, e.Fields[1:]...)
+		}
+		e.Color = s.branding.Colors.update()
+		if u.Replayed {
+			e.Title = replayPrefix + e.Title
+		}
+		if !s.hideTimestamp {
+			e.Timestamp = u.LastModified.UTC().Format(time.RFC3339)
+		}
+		if s.blockFields {
+			for i := range e.Fields {
+				e.Fields[i].Inline = false
+			}
+		}
+		s.branding.apply(&e, s.interval)
+		if s.thumbnail != "" {
+			e.Thumbnail = &discordThumbnail{URL: s.thumbnail}
+		}
+		p.Embeds = append(p.Embeds, e)
+	}
+	return p
+}
+
+func buildEmbed(u *Update, interval time.Duration, l Locale) discordEmbed {
+	timestamp := fmt.Sprintf("`%s`", u.LastModified.String())
+	if u.ClockSkew {
+		timestamp += " (monitor clock may be skewed)"
+	}
+
+	fields := []discordField{
+		{Name: l.Checksum, Value: fmt.Sprintf("`%s`", u.Checksum), Inline: true},
+		{Name: l.Timestamp, Value: timestamp, Inline: true},
+	}
+	if !u.BuiltAt.IsZero() {
+		fields = append(fields, discordField{Name: l.Built, Value: fmt.Sprintf("`%s`", u.BuiltAt.Format(time.RFC1123)), Inline: true})
+	}
+	if u.Signature != "" {
+		fields = append(fields, discordField{Name: l.Signature, Value: u.Signature, Inline: true})
+	}
+	return discordEmbed{
+		Title:  l.Title,
+		Color:  embedColor,
+		Fields: append(fields, discordField{Name: l.Download, Value: u.DownloadURL}),
+		Author: &discordAuthor{Name: embedAuthorName, IconURL: embedAuthorIcon},
+		Footer: &discordFooter{Text: Branding{}.renderFooter(interval)},
+	}
+}
+
+// buildPlainText renders a single line of text, friendlier to screen readers than an embed
+func buildPlainText(u *Update, l Locale) string {
+	return l.renderPlain(struct {
+		Checksum, Released, DownloadURL string
+	}{u.Checksum, u.LastModified.UTC().Format(time.RFC1123), u.DownloadURL})
+}
+
+// buildFailurePayload renders an alert that checks have started failing
+func (s *Server) buildFailurePayload(format string, f *Failure) *discordPayload {
+	text := fmt.Sprintf("ArcDPS Monitor checks are failing since %s: %s", f.Since.UTC().Format(time.RFC1123), f.Err)
+	var p *discordPayload
+	if format == WebhookFormatPlain {
+		p = &discordPayload{Content: text}
+	} else {
+		p = &discordPayload{
+			Content: s.fallbackContent(text),
+			Embeds: []discordEmbed{{
+				Title: failureEmbedTitle,
+				Color: s.branding.Colors.failure(),
+				Fields: []discordField{
+					{Name: "Error", Value: fmt.Sprintf("`%s`", f.Err)},
+					{Name: "Failing Since", Value: fmt.Sprintf("`%s`", f.Since.UTC().Format(time.RFC1123))},
+				},
+				Author: &discordAuthor{Name: embedAuthorName, IconURL: embedAuthorIcon},
+			}},
+		}
+		s.branding.apply(&p.Embeds[0], s.interval)
+	}
+	return p
+}
+
+// buildHeartbeatPayload renders a reminder that the monitor is alive through a quiet stretch
+func (s *Server) buildHeartbeatPayload(format string, h *Heartbeat) *discordPayload {
+	text := fmt.Sprintf("ArcDPS Monitor is still watching, no arcdps update in %s. Current checksum %s, released %s",
+		quietFor(h.Quiet), h.Checksum, h.LastModified.UTC().Format(time.RFC1123))
+	if format == WebhookFormatPlain {
+		return &discordPayload{Content: text}
+	}
+	p := &discordPayload{
+		Content: s.fallbackContent(text),
+		Embeds: []discordEmbed{{
+			Title: heartbeatTitle,
+			Color: s.branding.Colors.heartbeat(),
+			Fields: []discordField{
+				{Name: "No Update In", Value: quietFor(h.Quiet)},
+				{Name: "Checksum", Value: fmt.Sprintf("`%s`", h.Checksum), Inline: true},
+				{Name: "Timestamp Version", Value: fmt.Sprintf("`%s`", h.LastModified.String()), Inline: true},
+			},
+			Author: &discordAuthor{Name: embedAuthorName, IconURL: embedAuthorIcon},
+		}},
+	}
+	s.branding.apply(&p.Embeds[0], s.interval)
+	return p
+}
+
+// buildUnavailablePayload renders a notice that the monitored file has gone missing
+func (s *Server) buildUnavailablePayload(format string, u *Unavailable) *discordPayload {
+	text := fmt.Sprintf("ArcDPS is no longer available, %s has been missing since %s. Last version seen: %s",
+		u.URL, u.Since.UTC().Format(time.RFC1123), u.Checksum)
+	if format == WebhookFormatPlain {
+		return &discordPayload{Content: text}
+	}
+	p := &discordPayload{
+		Content: s.fallbackContent(text),
+		Embeds: []discordEmbed{{
+			Title: unavailableTitle,
+			Color: s.branding.Colors.unavailable(),
+			Fields: []discordField{
+				{Name: "Missing Since", Value: fmt.Sprintf("`%s`", u.Since.UTC().Format(time.RFC1123)), Inline: true},
+				{Name: "Last Checksum", Value: fmt.Sprintf("`%s`", u.Checksum), Inline: true},
+				{Name: "URL", Value: u.URL},
+			},
+			Author: &discordAuthor{Name: embedAuthorName, IconURL: embedAuthorIcon},
+		}},
+	}
+	s.branding.apply(&p.Embeds[0], s.interval)
+	return p
+}
+
+// buildDigestPayload renders every update in a digest, a field each in the
+// embed format. Discord caps embeds at 25 fields, so later updates are cut.
+func (s *Server) buildDigestPayload(format string, d *Digest) *discordPayload {
+	var p *discordPayload
+	if format == WebhookFormatPlain {
+		p = &discordPayload{Content: d.Summary()}
+	} else {
+		e := discordEmbed{
+			Title:  digestTitle,
+			Color:  s.branding.Colors.update(),
+			Author: &discordAuthor{Name: embedAuthorName, IconURL: embedAuthorIcon},
+		}
+		for i, u := range d.Updates {
+			if i == discordMaxFields {
+				break
+			}
+			e.Fields = append(e.Fields, discordField{
+				Name:  u.DetectedAt.UTC().Format(time.RFC1123),
+				Value: fmt.Sprintf("`%s`, released `%s`", u.Checksum, u.LastModified.UTC().Format(time.RFC1123)),
+			})
+		}
+		s.branding.apply(&e, s.interval)
+		if s.thumbnail != "" {
+			e.Thumbnail = &discordThumbnail{URL: s.thumbnail}
+		}
+		p = &discordPayload{Content: s.fallbackContent(d.Summary()), Embeds: []discordEmbed{e}}
+	}
+	return p
+}
+
+// fallbackContent is text to send as the content of an embed message unless
+// WithEmbedContent turned it off, for receivers that don't render embeds
+func (s *Server) fallbackContent(text string) string {
+	if !s.embedContent {
+		return ""
+	}
+	return text
+}
+
+// Discord rejects messages over these limits, counted in characters
+const (
+	discordContentLimit    = 2000
+	discordTitleLimit      = 256
+	discordFieldNameLimit  = 256
+	discordFieldValueLimit = 1024
+	discordFooterLimit     = 2048
+	discordAuthorLimit     = 256
+	discordEmbedTotalLimit = 6000
+	discordMaxFields       = 25
+)
+
+// truncate shortens s to at most limit characters, marking the cut with an ellipsis
+func truncate(s string, limit int) (string, bool) {
+	r := []rune(s)
+	if len(r) <= limit {
+		return s, false
+	}
+	if limit < 1 {
+		return "", true
+	}
+	return string(r[:limit-1]) + "…", true
+}
+
+// marshalDiscord encodes p for posting, truncating anything Discord would
+// reject first. Every Discord message is encoded here, so text from upstream,
+// such as the error in a failure alert, can't get one rejected.
+func (s *Server) marshalDiscord(p *discordPayload, what string) ([]byte, error) {
+	if enforceDiscordLimits(p) {
+		s.log.Warnf("truncated %s to fit Discord's limits", what)
+	}
+	return json.Marshal(p)
+}
+
+// enforceDiscordLimits truncates anything in p that Discord would reject for
+// being too long, so notifications stay deliverable even with large values.
+// It reports whether anything was cut.
+func enforceDiscordLimits(p *discordPayload) bool {
+	var cut, c bool
+	p.Content, c = truncate(p.Content, discordContentLimit)
+	cut = cut || c
+
+	for i := range p.Embeds {
+		e := &p.Embeds[i]
+		e.Title, c = truncate(e.Title, discordTitleLimit)
+		cut = cut || c
+		if e.Author != nil {
+			e.Author.Name, c = truncate(e.Author.Name, discordAuthorLimit)
+			cut = cut || c
+		}
+		if e.Footer != nil {
+			e.Footer.Text, c = truncate(e.Footer.Text, discordFooterLimit)
+			cut = cut || c
+		}
+		for j := range e.Fields {
+			f := &e.Fields[j]
+			f.Name, c = truncate(f.Name, discordFieldNameLimit)
+			cut = cut || c
+			f.Value, c = truncate(f.Value, discordFieldValueLimit)
+			cut = cut || c
+		}
+	}
+
+	// the total is of every embed in the message together, one per locale, so
+	// the excess comes out of the field values from the last embed's last one back
+	over := -discordEmbedTotalLimit
+	for i := range p.Embeds {
+		over += embedLength(&p.Embeds[i])
+	}
+	for i := len(p.Embeds) - 1; i >= 0 && over > 0; i-- {
+		e := &p.Embeds[i]
+		for j := len(e.Fields) - 1; j >= 0 && over > 0; j-- {
+			f := &e.Fields[j]
+			n := len([]rune(f.Value))
+			keep := n - over
+			if keep < 1 {
+				keep = 1
+			}
+			f.Value, c = truncate(f.Value, keep)
+			cut = cut || c
+			over -= n - len([]rune(f.Value))
+		}
+	}
+	return cut
+}
+
+// embedLength counts the characters of e Discord includes in the 6000 character total
+func embedLength(e *discordEmbed) int {
+	n := len([]rune(e.Title))
+	if e.Author != nil {
+		n += len([]rune(e.Author.Name))
+	}
+	if e.Footer != nil {
+		n += len([]rune(e.Footer.Text))
+	}
+	for _, f := range e.Fields {
+		n += len([]rune(f.Name)) + len([]rune(f.Value))
+	}
+	return n
+}
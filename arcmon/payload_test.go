@@ -0,0 +1,113 @@
+package arcmon
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"unicode/utf8"
+
+	"github.com/sirupsen/logrus/hooks/test"
+)
+
+func TestEnforceDiscordLimitsTruncatesLongField(t *testing.T) {
+	p := &discordPayload{Embeds: []discordEmbed{{
+		Title:  embedTitle,
+		Fields: []discordField{{Name: "Changelog", Value: strings.Repeat("é", 3000)}},
+	}}}
+
+	if !enforceDiscordLimits(p) {
+		t.Fatalf("reported nothing was cut from a %d character field", 3000)
+	}
+	v := p.Embeds[0].Fields[0].Value
+	if n := utf8.RuneCountInString(v); n != discordFieldValueLimit {
+		t.Fatalf("field value is %d characters, want %d", n, discordFieldValueLimit)
+	}
+	if !strings.HasSuffix(v, "…") {
+		t.Fatalf("truncated value doesn't end with an ellipsis")
+	}
+	if p.Embeds[0].Title != embedTitle {
+		t.Fatalf("title changed to %q though it was within its limit", p.Embeds[0].Title)
+	}
+}
+
+func TestEnforceDiscordLimitsLeavesShortPayloadAlone(t *testing.T) {
+	s := NewServer(WithLogger(quietLogger()))
+	p := s.buildPayload(WebhookFormatEmbed, &Update{Checksum: testChecksum, LastModified: testReleased, DownloadURL: ArcDPSDLLURL})
+	if enforceDiscordLimits(p) {
+		t.Fatalf("cut something from an ordinary update")
+	}
+}
+
+func TestEnforceDiscordLimitsBudgetsTotalAcrossEmbeds(t *testing.T) {
+	// one embed per locale, each under the total on its own but not together
+	var p discordPayload
+	for i := 0; i < 3; i++ {
+		e := discordEmbed{Title: embedTitle}
+		for j := 0; j < 3; j++ {
+			e.Fields = append(e.Fields, discordField{Name: "Field", Value: strings.Repeat("x", 1000)})
+		}
+		p.Embeds = append(p.Embeds, e)
+	}
+
+	if !enforceDiscordLimits(&p) {
+		t.Fatalf("reported nothing was cut from embeds over the total together")
+	}
+	total := 0
+	for i := range p.Embeds {
+		total += embedLength(&p.Embeds[i])
+	}
+	if total > discordEmbedTotalLimit {
+		t.Fatalf("embeds total %d characters, over the %d limit", total, discordEmbedTotalLimit)
+	}
+	// trimmed from the end, so the first locale is complete
+	for _, f := range p.Embeds[0].Fields {
+		if len(f.Value) != 1000 {
+			t.Fatalf("first embed was trimmed, only the last ones should be")
+		}
+	}
+}
+
+func TestEmbedContentOnByDefault(t *testing.T) {
+	u := &Update{Checksum: testChecksum, LastModified: testReleased, DownloadURL: ArcDPSDLLURL}
+	p := NewServer(WithLogger(quietLogger())).buildPayload(WebhookFormatEmbed, u)
+	if !strings.Contains(p.Content, testChecksum) {
+		t.Fatalf("embed sent with content %q, want the plain text by default", p.Content)
+	}
+	p = NewServer(WithLogger(quietLogger()), WithEmbedContent(false)).buildPayload(WebhookFormatEmbed, u)
+	if p.Content != "" || len(p.Embeds) == 0 {
+		t.Fatalf("WithEmbedContent(false) sent content %q with %d embeds, want the embed alone", p.Content, len(p.Embeds))
+	}
+}
+
+func TestFailureAlertFitsDiscordLimits(t *testing.T) {
+	var posted discordPayload
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		json.Unmarshal(body, &posted)
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer srv.Close()
+	log, hook := test.NewNullLogger()
+	s := NewServer(WithLogger(log), WithDoer(srv.Client()), WithWebhook(Webhook{URL: srv.URL, Format: WebhookFormatEmbed}))
+
+	// an upstream error page pasted into the error
+	f := &Failure{Err: "bad response: " + strings.Repeat("<p>maintenance</p>", 500), Since: testReleased}
+	if err := s.notifiers[0].n.(FailureNotifier).NotifyFailure(context.Background(), f); err != nil {
+		t.Fatalf("NotifyFailure() = %v", err)
+	}
+	if n := utf8.RuneCountInString(posted.Content); n > discordContentLimit {
+		t.Fatalf("content is %d characters, over the %d limit", n, discordContentLimit)
+	}
+	for _, field := range posted.Embeds[0].Fields {
+		if n := utf8.RuneCountInString(field.Value); n > discordFieldValueLimit {
+			t.Fatalf("field %q is %d characters, over the %d limit", field.Name, n, discordFieldValueLimit)
+		}
+	}
+	if e := hook.LastEntry(); e == nil || !strings.Contains(e.Message, "truncated failure alert") {
+		t.Fatalf("truncating the alert wasn't logged")
+	}
+}
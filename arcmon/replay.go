@@ -0,0 +1,41 @@
+package arcmon
+
+import (
+	"context"
+	"fmt"
+)
+
+// replayPrefix marks replayed announcements so they aren't mistaken for new releases
+const replayPrefix = "[Historical] "
+
+// Replay re-sends the last n versions in the history to webhooks, oldest
+// first, each marked as historical. It is meant for backfilling a newly added
+// channel and stops at the first webhook that fails.
+func (s *Server) Replay(ctx context.Context, n int, webhooks []Webhook) error {
+	s.arcdps.RLock()
+	history := s.arcdps.History
+	start := len(history) - n
+	if start < 0 {
+		start = 0
+	}
+	var updates []*Update
+	for i := start; i < len(history); i++ {
+		u := s.historyUpdate(history, i)
+		u.Replayed = true
+		updates = append(updates, u)
+	}
+	s.arcdps.RUnlock()
+
+	if len(updates) == 0 {
+		return fmt.Errorf("no versions in the history to replay")
+	}
+	for _, wh := range webhooks {
+		for i, u := range updates {
+			if err := s.SendWebHook(ctx, wh, u); err != nil {
+				return fmt.Errorf("replayed %d of %d versions: (%v)", i, len(updates), err)
+			}
+		}
+		s.log.Infof("replayed %d versions", len(updates))
+	}
+	return nil
+}
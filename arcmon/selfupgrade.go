@@ -0,0 +1,62 @@
+package arcmon
+
+import (
+	"context"
+	"fmt"
+)
+
+// MonitorUpgrade : The monitor started with a different build than the one that last saved the state
+type MonitorUpgrade struct {
+	From string
+	To   string
+}
+
+// Summary renders the upgrade as a line of plain text
+func (m *MonitorUpgrade) Summary() string {
+	return fmt.Sprintf("ArcDPS Monitor upgraded from %s to %s", m.From, m.To)
+}
+
+// UpgradeNotifier is implemented by notifiers that can announce the monitor's own upgrades
+type UpgradeNotifier interface {
+	NotifyMonitorUpgrade(ctx context.Context, m *MonitorUpgrade) error
+}
+
+// checkSelfUpgrade compares the running build with the one recorded in the
+// state, announcing the change to notifiers receiving every update. The first
+// run to record a version has nothing to compare against and only records it.
+func (s *Server) checkSelfUpgrade(ctx context.Context) {
+	if s.monitorVersion == "" {
+		return
+	}
+	s.arcdps.Lock()
+	previous := s.arcdps.MonitorVersion
+	s.arcdps.MonitorVersion = s.monitorVersion
+	s.arcdps.Unlock()
+	if previous == s.monitorVersion {
+		return
+	}
+	s.persist()
+	if previous == "" {
+		s.log.Infof("recording monitor version %s", s.monitorVersion)
+		return
+	}
+
+	m := &MonitorUpgrade{From: previous, To: s.monitorVersion}
+	s.log.Infof("monitor upgraded from %s to %s", m.From, m.To)
+	for _, r := range s.activeRoutes() {
+		if !r.wantsNotices() {
+			continue
+		}
+		un, ok := r.n.(UpgradeNotifier)
+		if !ok {
+			continue
+		}
+		err := un.NotifyMonitorUpgrade(ctx, m)
+		s.metrics.countNotification(r.n.Name(), "upgrade", err)
+		if err != nil {
+			s.log.Errorf("unable to send monitor upgrade to %s: (%v)", r.n.Name(), err)
+			continue
+		}
+		s.log.Infof("sent monitor upgrade to %s", r.n.Name())
+	}
+}
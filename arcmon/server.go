@@ -0,0 +1,768 @@
+// Package arcmon watches the published ArcDPS checksum and announces new releases
+// to Discord webhooks and any other configured Notifier.
+package arcmon
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"runtime/debug"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	ArcDpsURL           = "https://www.deltaconnected.com/arcdps/x64/"
+	ArcDPSCheckSumURL   = ArcDpsURL + "d3d9.dll.md5sum"
+	ArcDPSDLLURL        = ArcDpsURL + "d3d9.dll"
+	DefaultTickDuration = 10 * time.Minute
+	// MinTickInterval is the shortest interval accepted, anything less is raised to it
+	MinTickInterval = 30 * time.Second
+	// MaxTickInterval is the longest interval accepted without a warning that updates will be missed for a long time
+	MaxTickInterval = 24 * time.Hour
+	// DefaultAnnounceCooldown is how long the same checksum is protected from being announced again
+	DefaultAnnounceCooldown = time.Hour
+	// DefaultAlertGracePeriod is how long after starting failing checks are only logged
+	DefaultAlertGracePeriod = 2 * time.Minute
+	// DefaultStartupRetries and DefaultStartupRetryDelay control how hard the startup check tries before deferring to the ticker
+	DefaultStartupRetries    = 3
+	DefaultStartupRetryDelay = 10 * time.Second
+)
+
+// StateVersion is the layout of ArcDPSVersion saved by this build. Fields are
+// only ever added, with zero values that mean what files without them did, so
+// older files load as they are and migrations can key off Version if that
+// ever changes.
+const StateVersion = 1
+
+type ArcDPSVersion struct {
+	// Version is the StateVersion the state was written with, zero for files
+	// from before it was recorded
+	Version   int       `yaml:"version,omitempty"`
+	Timestamp time.Time `yaml:"timestamp"`
+	CheckSum  string    `yaml:"check_sum"`
+	// LastAnnounced and LastAnnouncedAt record the most recent checksum that was
+	// successfully sent out, used to suppress duplicate announcements
+	LastAnnounced   string    `yaml:"last_announced,omitempty"`
+	LastAnnouncedAt time.Time `yaml:"last_announced_at,omitempty"`
+	// ETag is the validator upstream sent with CheckSum, replayed in If-None-Match
+	ETag string `yaml:"etag,omitempty"`
+	// MonitorVersion is the build of the monitor that last ran against the state, see WithSelfUpgradeNotice
+	MonitorVersion string         `yaml:"monitor_version,omitempty"`
+	History        []HistoryEntry `yaml:"history,omitempty"`
+	sync.RWMutex   `yaml:"-"`
+}
+
+// Doer is the subset of *http.Client used to make requests, so tests and
+// embedders can substitute their own transport
+type Doer interface {
+	Do(req *http.Request) (*http.Response, error)
+}
+
+// Server watches the arcdps checksum and announces changes to its notifiers
+type Server struct {
+	http        Doer
+	log         logrus.FieldLogger
+	baseURL     string
+	interval    time.Duration
+	webhooks    []Webhook
+	bots        []DiscordBot
+	arcdps      *ArcDPSVersion
+	store       Store
+	events      *EventSocket
+	broadcaster *Broadcaster
+	notifiers   []route
+	metrics     *metrics
+
+	// mu guards the result of the most recent check
+	mu          sync.RWMutex
+	lastChecked time.Time
+	lastErr     error
+	// failingSince is when checks started failing, zero while they succeed
+	failingSince time.Time
+	// alerted is set once notifiers have been told about the current failures
+	alerted   bool
+	nextCheck time.Time
+	breaker   breaker
+	// disabledWebhooks are the webhooks found deleted, by notifier name, when disableDeadWebhooks is set
+	disabledWebhooks    map[string]bool
+	disableDeadWebhooks bool
+	// lastPayload is the body of the most recent Discord message and when it was sent
+	lastPayload   []byte
+	lastPayloadAt time.Time
+	// startedAt is when Tick began, alerts are held back until alertGrace after it
+	startedAt  time.Time
+	alertGrace time.Duration
+
+	announceCooldown   time.Duration
+	clockSkewThreshold time.Duration
+	startupRetries     int
+	startupRetryDelay  time.Duration
+	retryJitter        bool
+	// retryMaxDelay caps the backoff between startup attempts, retryMaxElapsed
+	// the time spent on them in total, zero for no limit
+	retryMaxDelay   time.Duration
+	retryMaxElapsed time.Duration
+	retryableStatus []int
+	historySize     int
+	// historyArchive is where history entries trimmed to historySize are appended, empty to drop them
+	historyArchive string
+	thumbnail      string
+	showPrevious   bool
+	// blockFields renders update fields full width rather than side by side
+	blockFields bool
+	// hideTimestamp leaves out the native embed timestamp, shown in each reader's timezone
+	hideTimestamp bool
+	// forumThread names the forum post each webhook message creates, empty when not posting to a forum
+	forumThread  string
+	locales      []Locale
+	branding     Branding
+	notifyOnSeed bool
+	// baseline silences releases made at or before it, zero announces everything
+	baseline       time.Time
+	hotfixWindow   time.Duration
+	verify         bool
+	maxDLLSize     int64
+	checkSignature bool
+	// httpTrace logs how long each phase of checksum requests took
+	httpTrace        bool
+	staleAfter       time.Duration
+	staleAlert       bool
+	onStale          func()
+	routes           map[string]http.Handler
+	pathPrefix       string
+	heartbeatAfter   time.Duration
+	watchListing     bool
+	unavailableAfter int
+	digestInterval   time.Duration
+	statusWindow     time.Duration
+	hashAlgorithm    string
+	// notFound counts checks in a row answered with a 404, only touched by the checker
+	notFound        int
+	notFoundSince   time.Time
+	unavailableSent bool
+	// listing is the directory index as last fetched, only touched by the ticker
+	listing       map[string]string
+	lastHeartbeat time.Time
+	cacheWarning  sync.Once
+	// embedContent also sends the plain text of every embed message as its content
+	embedContent bool
+	// monitorVersion is the running build, announced when it differs from the state's
+	monitorVersion string
+	// upstreamHeaders are added to every request for deltaconnected
+	upstreamHeaders map[string]string
+	// retrying is an announcement some notifiers failed to receive, nil if there is none
+	retrying *queuedAnnouncement
+	// tracer exports a trace of every tick, nil unless WithOTLPTraces is used
+	tracer *tracer
+	// clock is the time everything is scheduled by, the wall clock outside of tests
+	clock Clock
+}
+
+// NewServer creates a Server. Without options it starts from an empty state,
+// checks ArcDpsURL every DefaultTickDuration and has nowhere to announce
+// updates to, see WithState, WithWebhook and WithNotifier.
+func NewServer(opts ...Option) *Server {
+	s := &Server{
+		http:               &http.Client{Timeout: 5 * time.Second},
+		log:                logrus.StandardLogger(),
+		clock:              realClock{},
+		baseURL:            ArcDpsURL,
+		interval:           DefaultTickDuration,
+		arcdps:             &ArcDPSVersion{},
+		broadcaster:        NewBroadcaster(),
+		metrics:            newMetrics(),
+		disabledWebhooks:   make(map[string]bool),
+		announceCooldown:   DefaultAnnounceCooldown,
+		clockSkewThreshold: DefaultClockSkewThreshold,
+		startupRetries:     DefaultStartupRetries,
+		startupRetryDelay:  DefaultStartupRetryDelay,
+		retryJitter:        true,
+		embedContent:       true,
+		retryMaxDelay:      DefaultRetryMaxDelay,
+		retryableStatus:    DefaultRetryableStatus,
+		historySize:        DefaultHistorySize,
+		hotfixWindow:       DefaultHotfixWindow,
+		maxDLLSize:         DefaultMaxDLLSize,
+		unavailableAfter:   DefaultUnavailableAfter,
+		alertGrace:         DefaultAlertGracePeriod,
+		hashAlgorithm:      HashMD5,
+		breaker:            breaker{threshold: DefaultBreakerThreshold, cooldown: DefaultBreakerCooldown},
+	}
+	for _, opt := range opts {
+		opt(s)
+	}
+	s.interval = s.clampInterval(s.interval)
+
+	// webhooks are turned into notifiers last so their names reflect how many there are
+	discord := make([]route, 0, len(s.webhooks)+len(s.bots))
+	for i, wh := range s.webhooks {
+		name := "discord"
+		if len(s.webhooks) > 1 {
+			name = fmt.Sprintf("discord#%d", i+1)
+		}
+		discord = append(discord, route{n: &discordNotifier{s: s, name: name, webhook: wh}, events: wh.Events})
+	}
+	for _, bot := range s.bots {
+		discord = append(discord, route{n: &discordBotNotifier{s: s, bot: bot}, events: bot.Events})
+	}
+	s.notifiers = append(discord, s.notifiers...)
+	numberNotifiers(s.notifiers)
+	for _, r := range s.notifiers {
+		if c, ok := r.n.(clocked); ok {
+			c.useClock(s.clock)
+		}
+		if l, ok := r.n.(logged); ok {
+			l.useLogger(s.log)
+		}
+	}
+	return s
+}
+
+func (s *Server) Tick(ctx context.Context) {
+	s.mu.Lock()
+	s.startedAt = s.clock.Now()
+	s.mu.Unlock()
+	if s.staleAfter > 0 {
+		go s.watchdog(ctx, s.clock.Now())
+	}
+	s.reconcile(ctx)
+	s.checkSelfUpgrade(ctx)
+	s.seed(ctx)
+	s.lastHeartbeat = s.clock.Now()
+	if s.watchListing {
+		s.checkListing(ctx)
+	}
+	// Every wait below is a duration handed to the clock, which counts elapsed
+	// rather than wall time, never a comparison against a wall clock deadline.
+	// An NTP step can then only shift when the next fire happens, it can't
+	// cause a burst of them or a stall.
+
+	// rearmed after every check rather than a ticker, so the next fire time is known exactly
+	next := s.clock.After(s.scheduleNext())
+	// digest stays nil, and so never fires, outside digest mode
+	var (
+		digest   <-chan time.Time
+		digestAt time.Time
+	)
+	if s.digestInterval > 0 {
+		digestAt, digest = s.scheduleDigest(time.Time{})
+		s.log.Infof("sending a digest every %s, the next at %s", s.digestInterval, digestAt.Format(time.RFC3339))
+	}
+	s.log.Infof("Starting Check Ticker")
+	for {
+		select {
+		case <-digest:
+			s.safely("digest", func() { s.sendDigest(ctx) })
+			digestAt, digest = s.scheduleDigest(digestAt)
+		case <-next:
+			s.safely("tick", func() { s.tick(ctx) })
+			next = s.clock.After(s.scheduleNext())
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// tick is the work done on every fire of the check timer
+func (s *Server) tick(ctx context.Context) {
+	ctx, sp := s.startSpan(ctx, "tick", otlpKindInternal)
+	// before checking, so an announcement queued by this check waits for the next
+	s.retryAnnouncement(ctx)
+	err := s.check(ctx)
+	s.finish(sp, err)
+	switch err.(type) {
+	case nil:
+	case *circuitOpen:
+		// already warned about when it opened
+		s.log.Debugf("%v", err)
+	default:
+		s.log.Errorf("Failed getting checksum: (%v)", err)
+	}
+	if s.heartbeatAfter > 0 {
+		s.heartbeat(ctx, s.clock.Now())
+	}
+	if s.watchListing {
+		s.checkListing(ctx)
+	}
+}
+
+// safely runs f, recovering from any panic so that one bad tick doesn't stop
+// monitoring. The panic is logged with its stack and counted.
+func (s *Server) safely(what string, f func()) {
+	defer func() {
+		if r := recover(); r != nil {
+			s.metrics.countPanic()
+			s.log.Errorf("recovered from panic during %s: %v\n%s", what, r, debug.Stack())
+		}
+	}()
+	f()
+}
+
+// clampInterval raises intervals below MinTickInterval to it, as zero or
+// negative ones would panic the timer, and warns about ones so long that
+// monitoring is effectively off
+func (s *Server) clampInterval(d time.Duration) time.Duration {
+	switch {
+	case d < MinTickInterval:
+		s.log.Warnf("check interval %s is below the minimum, using %s", d, MinTickInterval)
+		return MinTickInterval
+	case d > MaxTickInterval:
+		s.log.Warnf("check interval %s is very long, updates may not be announced until %s after release", d, d)
+	}
+	return d
+}
+
+// scheduleDigest returns when the digest after the one due at previous is and
+// a channel that fires then. Digests are aligned to the wall clock, but the
+// wait is the difference from a single reading of it, and a boundary is never
+// used twice, so the clock stepping back just before one can't send it again.
+func (s *Server) scheduleDigest(previous time.Time) (time.Time, <-chan time.Time) {
+	now := s.clock.Now()
+	at := nextDigest(now, s.digestInterval)
+	if !previous.IsZero() && !at.After(previous) {
+		at = previous.Add(s.digestInterval)
+	}
+	return at, s.clock.After(at.Sub(now))
+}
+
+// scheduleNext records when the next check will happen and returns how long until then
+func (s *Server) scheduleNext() time.Duration {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.nextCheck = s.clock.Now().Add(s.interval)
+	return s.interval
+}
+
+// NextCheck returns when the next scheduled check will happen, zero before the ticker has started
+func (s *Server) NextCheck() time.Time {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.nextCheck
+}
+
+// CheckOnce announces anything a previous run missed and performs a single
+// check, for running from a scheduler instead of as a long lived process
+func (s *Server) CheckOnce(ctx context.Context) error {
+	s.reconcile(ctx)
+	return s.check(ctx)
+}
+
+// seed performs the immediate startup check, retrying a few times with
+// exponential backoff so that a brief upstream outage during a restart isn't
+// fatal. Retrying stops at whichever of the attempt and elapsed time limits
+// is reached first, or once an attempt fails in a way retrying won't fix, and
+// we fall back to waiting for the first tick.
+func (s *Server) seed(ctx context.Context) {
+	start := s.clock.Now()
+	for attempt := 1; attempt <= s.startupRetries; attempt++ {
+		err := s.check(ctx)
+		if err == nil {
+			return
+		}
+		s.log.Warnf("initial check attempt %d/%d failed: (%v)", attempt, s.startupRetries, err)
+		if attempt == s.startupRetries || !s.retryable(err) {
+			break
+		}
+		delay := backoff(s.startupRetryDelay, s.retryMaxDelay, attempt, s.retryJitter)
+		if s.retryMaxElapsed > 0 && s.since(start)+delay > s.retryMaxElapsed {
+			s.log.Warnf("giving up on the initial check, retrying would take longer than %s", s.retryMaxElapsed)
+			break
+		}
+		if sleep(ctx, s.clock, delay) != nil {
+			return
+		}
+	}
+	s.log.Warnf("initial check failed, waiting for the first tick in %s", s.interval)
+}
+
+// check fetches the current checksum and handles any change from what we're tracking
+func (s *Server) check(ctx context.Context) error {
+	if err := s.allowCheck(); err != nil {
+		s.metrics.countSkipped()
+		return err
+	}
+	fetchCtx, fetch := s.startSpan(ctx, "fetch", otlpKindClient)
+	fetch.set("url.full", s.checksumURL())
+	check, err := s.GetChecksum(fetchCtx)
+	err = explainDNS(err)
+	s.finish(fetch, err)
+	s.recordBreaker(err)
+	s.metrics.countCheck(err)
+	if f := s.recordCheck(err); f != nil {
+		s.notifyFailure(ctx, f)
+	}
+	s.trackAvailability(ctx, err)
+	if err != nil {
+		return err
+	}
+	tick := spanFrom(ctx)
+	tick.set("arcdps.checksum", check.Checksum)
+	tick.set("arcdps.changed", s.arcdps.CheckSum != check.Checksum)
+	s.warnIfPollingTooOften(check.CacheTTL)
+	if check.NotModified {
+		s.log.Debugf("checksum file not modified")
+	}
+
+	age, skewed := releaseAge(check.LastModified, s.clock.Now(), s.clockSkewThreshold)
+	if skewed {
+		s.log.Warnf("Last-Modified %s is more than %s ahead of local time, the system clock may be skewed",
+			check.LastModified.Format(time.RFC3339), s.clockSkewThreshold)
+	}
+	seeding := s.arcdps.CheckSum == ""
+	if seeding && !s.notifyOnSeed {
+		s.log.Infof("Setting initial version")
+		s.arcdps.Lock()
+		s.arcdps.CheckSum = check.Checksum
+		s.arcdps.Timestamp = check.LastModified
+		// the seeded version is the baseline, there is nothing to announce
+		now := s.clock.Now()
+		s.arcdps.LastAnnounced = check.Checksum
+		s.arcdps.LastAnnouncedAt = now
+		s.arcdps.ETag = check.ETag
+		trimmed := s.arcdps.recordVersion(check.Checksum, check.LastModified, now, s.historySize)
+		s.arcdps.Unlock()
+		s.archiveHistory(trimmed)
+		s.persist()
+		return nil
+	}
+	if s.arcdps.CheckSum == check.Checksum {
+		s.recordETag(check.ETag)
+		return nil
+	}
+
+	// the checksum file can be published before the DLL it describes, leave
+	// the version unrecorded so the next check tries again
+	var dll dllInfo
+	if s.verify {
+		if dll, err = s.verifyDLL(ctx, check.Checksum); err != nil {
+			return fmt.Errorf("unable to verify %s: (%v)", check.Checksum, err)
+		}
+	}
+
+	// new version
+	if seeding {
+		s.log.Infof("Setting initial version %s and announcing it as a baseline", check.Checksum)
+	} else if skewed {
+		s.log.Infof("new version %s detected, release age unknown due to clock skew", check.Checksum)
+	} else {
+		s.log.Infof("new version %s detected, released %s ago", check.Checksum, age.Round(time.Second))
+	}
+
+	// record the version as seen before announcing it, so a restart part way
+	// through knows it still has to be announced rather than missing it
+	detected := s.clock.Now()
+	s.arcdps.Lock()
+	previous := s.arcdps.CheckSum
+	major := seeding || isMajor(s.arcdps.Timestamp, check.LastModified, s.hotfixWindow)
+	s.arcdps.CheckSum = check.Checksum
+	s.arcdps.Timestamp = check.LastModified
+	s.arcdps.ETag = check.ETag
+	trimmed := s.arcdps.recordVersion(check.Checksum, check.LastModified, detected, s.historySize)
+	s.arcdps.Unlock()
+	s.archiveHistory(trimmed)
+	s.persist()
+
+	s.announce(ctx, &Update{
+		Checksum:     check.Checksum,
+		LastModified: check.LastModified,
+		DetectedAt:   detected,
+		Previous:     previous,
+		DownloadURL:  s.dllURL(),
+		BuiltAt:      dll.BuiltAt,
+		Signature:    dll.Signature,
+		ClockSkew:    skewed,
+		Major:        major,
+	})
+
+	ev := UpdateEvent{
+		Type:         "update",
+		Checksum:     check.Checksum,
+		LastModified: check.LastModified,
+		DetectedAt:   detected,
+	}
+	s.events.Publish(ev)
+	s.broadcaster.Publish(ev)
+	return nil
+}
+
+// checksumURL and dllURL locate the published files under the configured base URL
+func (s *Server) checksumURL() string { return s.baseURL + "d3d9.dll." + s.hashAlgorithm + "sum" }
+func (s *Server) dllURL() string      { return s.baseURL + "d3d9.dll" }
+
+// recordCheck stores the result of a check, returning a Failure to alert on
+// for the first of a run of failures to happen after the startup grace period
+func (s *Server) recordCheck(err error) *Failure {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.lastChecked = s.clock.Now()
+	s.lastErr = err
+	if err == nil {
+		s.failingSince = time.Time{}
+		s.alerted = false
+		return nil
+	}
+	if s.failingSince.IsZero() {
+		s.failingSince = s.lastChecked
+	}
+	if s.alerted {
+		return nil
+	}
+	// network hiccups straight after a deploy aren't worth waking anyone for
+	if !s.startedAt.IsZero() && s.lastChecked.Sub(s.startedAt) < s.alertGrace {
+		s.log.Debugf("not alerting yet, checks only just started: (%v)", err)
+		return nil
+	}
+	s.alerted = true
+	return &Failure{Err: err.Error(), Since: s.failingSince}
+}
+
+// Checksum : Used to compare local cache to remote
+type Checksum struct {
+	Checksum     string
+	LastModified time.Time
+	// CacheTTL is how long upstream says the response may be cached, zero if it didn't say
+	CacheTTL time.Duration
+	// ETag is the response's validator, empty if upstream sent none
+	ETag string
+	// NotModified is set when upstream answered 304, Checksum and LastModified
+	// are then the version already known
+	NotModified bool
+}
+
+// GetChecksum fetches the monitored checksum file. Once a version is known the
+// request is conditional on it, with If-None-Match when upstream sent an ETag
+// and If-Modified-Since otherwise.
+func (s *Server) GetChecksum(ctx context.Context) (*Checksum, error) {
+	s.arcdps.RLock()
+	known := &Checksum{Checksum: s.arcdps.CheckSum, LastModified: s.arcdps.Timestamp, ETag: s.arcdps.ETag}
+	s.arcdps.RUnlock()
+	if known.Checksum == "" {
+		known = nil
+	}
+	return s.fetchChecksum(ctx, s.checksumURL(), known)
+}
+
+// GetChecksumFrom fetches and parses a checksum file from an arbitrary url
+func (s *Server) GetChecksumFrom(ctx context.Context, url string) (*Checksum, error) {
+	return s.fetchChecksum(ctx, url, nil)
+}
+
+// maxChecksumSize caps how much of a checksum response is read, decompressed,
+// far more than the single line it should be
+const maxChecksumSize = 64 << 10
+
+// fetchChecksum fetches and parses the checksum file at url. When known is
+// set the request is conditional on it and a 304 returns it unchanged.
+func (s *Server) fetchChecksum(ctx context.Context, url string, known *Checksum) (*Checksum, error) {
+	req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Accept", "text/plain")
+	if known != nil {
+		if known.ETag != "" {
+			req.Header.Set("If-None-Match", known.ETag)
+		} else if !known.LastModified.IsZero() {
+			req.Header.Set("If-Modified-Since", known.LastModified.UTC().Format(http.TimeFormat))
+		}
+	}
+	s.setUpstreamHeaders(req)
+
+	req, logTiming := s.traceRequest(req)
+	defer logTiming()
+	resp, err := s.http.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	// a 304 has no body to decompress, whatever its headers say
+	if resp.StatusCode == http.StatusNotModified && known != nil {
+		etag := resp.Header.Get("ETag")
+		if etag == "" {
+			etag = known.ETag
+		}
+		return &Checksum{
+			Checksum:     known.Checksum,
+			LastModified: known.LastModified,
+			CacheTTL:     cacheTTL(resp.Header, s.clock.Now()),
+			ETag:         etag,
+			NotModified:  true,
+		}, nil
+	}
+	if resp.StatusCode > 299 {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, maxChecksumSize))
+		return nil, &statusError{StatusCode: resp.StatusCode, Body: string(body)}
+	}
+
+	r, err := decodedBody(resp)
+	if err != nil {
+		return nil, fmt.Errorf("unable to decompress checksum: (%v)", err)
+	}
+	body, err := io.ReadAll(io.LimitReader(r, maxChecksumSize))
+	if err != nil {
+		return nil, err
+	}
+
+	_, parse := s.startSpan(ctx, "parse", otlpKindInternal)
+	check, err := s.parseChecksum(resp.Header, body)
+	s.finish(parse, err)
+	return check, err
+}
+
+// parseChecksum reads the checksum and its release time out of a successful response
+func (s *Server) parseChecksum(header http.Header, body []byte) (*Checksum, error) {
+	// captive portals and error pages answer 200 with HTML, which would otherwise parse as a checksum
+	if ct := header.Get("Content-Type"); isHTML(ct) {
+		s.log.Warnf("checksum request returned unexpected content type %q", ct)
+		return nil, fmt.Errorf("unexpected content type %q, expected text/plain", ct)
+	}
+
+	// HTTP dates are always GMT, which parses without allocating a zone, other
+	// zones are still accepted as before
+	lastModified, err := time.Parse(http.TimeFormat, header.Get("Last-Modified"))
+	if err != nil {
+		lastModified, err = time.Parse(time.RFC1123, header.Get("Last-Modified"))
+	}
+	if err != nil {
+		return nil, fmt.Errorf("unable to parse time: (%v)", err)
+	}
+
+	// only the digest before the first space is wanted, so don't split the whole body
+	end := bytes.IndexByte(body, ' ')
+	if end < 0 {
+		return nil, fmt.Errorf("incorrect size of checksum split")
+	}
+	digest := string(body[:end])
+	if !validDigest(s.hashAlgorithm, digest) {
+		return nil, fmt.Errorf("%q is not a valid %s checksum", digest, s.hashAlgorithm)
+	}
+
+	return &Checksum{
+		Checksum:     digest,
+		LastModified: lastModified,
+		CacheTTL:     cacheTTL(header, s.clock.Now()),
+		ETag:         header.Get("ETag"),
+	}, nil
+}
+
+// isHTML reports whether a Content-Type header describes an HTML document
+func isHTML(contentType string) bool {
+	// the usual text/plain is ruled out without parsing it
+	if !strings.Contains(strings.ToLower(contentType), "html") {
+		return false
+	}
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return false
+	}
+	return mediaType == "text/html" || mediaType == "application/xhtml+xml"
+}
+
+// RenderWebhook returns the JSON body that announcing u to webhook would post
+func (s *Server) RenderWebhook(webhook Webhook, u *Update) ([]byte, error) {
+	return s.marshalDiscord(s.inForum(s.buildPayload(webhook.Format, u), s.renderThreadName(u)), "notification for "+u.Checksum)
+}
+
+func (s *Server) SendWebHook(ctx context.Context, webhook Webhook, u *Update) error {
+	payload, err := s.RenderWebhook(webhook, u)
+	if err != nil {
+		return err
+	}
+	return s.postDiscord(ctx, webhook.URL, "", payload)
+}
+
+// Discord retry limits, rate limits asking for a longer wait than discordMaxRetryWait fail straight away
+const (
+	discordMaxAttempts  = 3
+	discordRetryDelay   = time.Second
+	discordMaxRetryWait = time.Minute
+)
+
+// postDiscord posts a rendered message to Discord, authenticating with
+// authorization when it's set. Rate limits and server errors are retried, and
+// every wait gives up as soon as ctx is done so shutdown isn't held up.
+func (s *Server) postDiscord(ctx context.Context, url, authorization string, payload []byte) error {
+	s.mu.Lock()
+	s.lastPayload, s.lastPayloadAt = payload, s.clock.Now()
+	s.mu.Unlock()
+
+	for attempt := 1; ; attempt++ {
+		req, err := http.NewRequestWithContext(ctx, "POST", url, bytes.NewReader(payload))
+		if err != nil {
+			return err
+		}
+
+		req.Header.Set("Content-Type", "application/json")
+		if authorization != "" {
+			req.Header.Set("Authorization", authorization)
+		}
+
+		resp, err := s.http.Do(req)
+		if err != nil {
+			return err
+		}
+		// any 2xx is a success whatever it carries, the body is only drained so the connection can be reused
+		if resp.StatusCode <= 299 {
+			io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+			resp.Body.Close()
+			return nil
+		}
+
+		// enough for Discord's JSON errors, not a proxy's whole error page
+		body, err := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		resp.Body.Close()
+		if err != nil {
+			return err
+		}
+		detail := strings.TrimSpace(string(body))
+		if detail == "" {
+			detail = http.StatusText(resp.StatusCode)
+		}
+		respErr := &discordError{StatusCode: resp.StatusCode, Detail: detail}
+
+		wait, retry := discordRetryWait(resp, body, attempt, s.retryJitter)
+		if !retry || attempt >= discordMaxAttempts {
+			return respErr
+		}
+		if wait > discordMaxRetryWait {
+			return fmt.Errorf("rate limited by Discord, retry in %s", wait.Round(time.Second))
+		}
+
+		s.log.Warnf("%v, retrying in %s", respErr, wait.Round(time.Millisecond))
+		if err := sleep(ctx, s.clock, wait); err != nil {
+			return err
+		}
+	}
+}
+
+// discordRetryWait decides whether a failed post is worth retrying and how
+// long to wait first. Rate limits say how long in the body or Retry-After,
+// server errors back off.
+func discordRetryWait(resp *http.Response, body []byte, attempt int, jitter bool) (time.Duration, bool) {
+	switch {
+	case resp.StatusCode == http.StatusTooManyRequests:
+		var limit struct {
+			RetryAfter float64 `json:"retry_after"`
+		}
+		if json.Unmarshal(body, &limit) == nil && limit.RetryAfter > 0 {
+			return time.Duration(limit.RetryAfter * float64(time.Second)), true
+		}
+		if secs, err := strconv.ParseFloat(resp.Header.Get("Retry-After"), 64); err == nil {
+			return time.Duration(secs * float64(time.Second)), true
+		}
+		return backoff(discordRetryDelay, DefaultRetryMaxDelay, attempt, jitter), true
+	case resp.StatusCode >= 500:
+		return backoff(discordRetryDelay, DefaultRetryMaxDelay, attempt, jitter), true
+	}
+	return 0, false
+}
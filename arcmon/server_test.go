@@ -0,0 +1,346 @@
+package arcmon
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/sirupsen/logrus/hooks/test"
+)
+
+func TestGetChecksumRejectsHTML(t *testing.T) {
+	var accept string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		accept = r.Header.Get("Accept")
+		// a captive portal answering for the real host
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		w.Header().Set("Last-Modified", testReleased.Format(http.TimeFormat))
+		fmt.Fprintf(w, "<html><body>%s sign in to continue</body></html>", testChecksum)
+	}))
+	defer srv.Close()
+	s := NewServer(WithLogger(quietLogger()), WithDoer(srv.Client()), WithBaseURL(srv.URL))
+
+	check, err := s.GetChecksum(context.Background())
+	if err == nil {
+		t.Fatalf("parsed %q out of an HTML page", check.Checksum)
+	}
+	if !strings.Contains(err.Error(), "text/html") {
+		t.Fatalf("error %q doesn't name the content type", err)
+	}
+	if accept != "text/plain" {
+		t.Fatalf("sent Accept %q, want text/plain", accept)
+	}
+}
+
+func TestSendWebHookReturnsWhenCancelledMidRetry(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// rate limited for long enough that waiting it out would stall shutdown
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusTooManyRequests)
+		fmt.Fprint(w, `{"message": "You are being rate limited.", "retry_after": 30}`)
+	}))
+	defer srv.Close()
+	clock := newFakeClock(testReleased)
+	s := NewServer(WithLogger(quietLogger()), WithDoer(srv.Client()), WithClock(clock))
+
+	ctx, cncl := context.WithCancel(context.Background())
+	defer cncl()
+	done := make(chan error, 1)
+	go func() {
+		done <- s.SendWebHook(ctx, Webhook{URL: srv.URL, Format: WebhookFormatEmbed}, &Update{Checksum: testChecksum, LastModified: testReleased})
+	}()
+	// waiting out the rate limit, which the fake clock never ends
+	clock.waitForTimers(t, 1)
+	cncl()
+	select {
+	case err := <-done:
+		if !errors.Is(err, context.Canceled) {
+			t.Fatalf("SendWebHook() = %v, want context.Canceled", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatalf("still retrying after being cancelled")
+	}
+}
+
+func TestClampInterval(t *testing.T) {
+	for _, tc := range []struct {
+		interval time.Duration
+		want     time.Duration
+		warns    bool
+	}{
+		{0, MinTickInterval, true},
+		{-5 * time.Minute, MinTickInterval, true},
+		{DefaultTickDuration, DefaultTickDuration, false},
+		{365 * 24 * time.Hour, 365 * 24 * time.Hour, true},
+	} {
+		log, hook := test.NewNullLogger()
+		s := NewServer(WithLogger(log), WithInterval(tc.interval))
+		if s.interval != tc.want {
+			t.Errorf("interval %s clamped to %s, want %s", tc.interval, s.interval, tc.want)
+		}
+		if warned := len(hook.Entries) > 0; warned != tc.warns {
+			t.Errorf("interval %s warned %t, want %t", tc.interval, warned, tc.warns)
+		}
+	}
+}
+
+func TestSendWebHookAcceptsNoContent(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// no body and no Content-Type, as Discord answers without ?wait=true
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer srv.Close()
+	s := NewServer(WithLogger(quietLogger()), WithDoer(srv.Client()))
+
+	if err := s.SendWebHook(context.Background(), Webhook{URL: srv.URL, Format: WebhookFormatEmbed}, &Update{Checksum: testChecksum, LastModified: testReleased}); err != nil {
+		t.Fatalf("SendWebHook() = %v for a 204, want success", err)
+	}
+}
+
+// etagUpstream serves testChecksum with etag, answering 304 to requests that already have it
+func etagUpstream(t *testing.T, etag string) (*httptest.Server, *[]http.Header) {
+	t.Helper()
+	var requests []http.Header
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests = append(requests, r.Header.Clone())
+		if etag != "" {
+			w.Header().Set("ETag", etag)
+		}
+		if etag != "" && r.Header.Get("If-None-Match") == etag {
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		w.Header().Set("Content-Type", "text/plain")
+		w.Header().Set("Last-Modified", testReleased.Format(http.TimeFormat))
+		fmt.Fprintf(w, "%s  d3d9.dll\n", testChecksum)
+	}))
+	t.Cleanup(srv.Close)
+	return srv, &requests
+}
+
+func TestGetChecksumNotModifiedWithETag(t *testing.T) {
+	srv, requests := etagUpstream(t, `"v1"`)
+	store := &memStore{}
+	s := NewServer(WithLogger(quietLogger()), WithDoer(srv.Client()), WithBaseURL(srv.URL), WithStore(store))
+	ctx := context.Background()
+
+	if err := s.check(ctx); err != nil {
+		t.Fatalf("check() = %v", err)
+	}
+	if got := store.load(t).ETag; got != `"v1"` {
+		t.Fatalf("saved ETag %q, want %q", got, `"v1"`)
+	}
+
+	// a restart picks the ETag up from the state and revalidates with it
+	s = NewServer(WithLogger(quietLogger()), WithDoer(srv.Client()), WithBaseURL(srv.URL), WithState(store.load(t)))
+	check, err := s.GetChecksum(ctx)
+	if err != nil {
+		t.Fatalf("GetChecksum() = %v", err)
+	}
+	last := (*requests)[len(*requests)-1]
+	if got := last.Get("If-None-Match"); got != `"v1"` {
+		t.Fatalf("sent If-None-Match %q, want %q", got, `"v1"`)
+	}
+	if last.Get("If-Modified-Since") != "" {
+		t.Fatalf("sent If-Modified-Since alongside the ETag")
+	}
+	if !check.NotModified || check.Checksum != testChecksum || !check.LastModified.Equal(testReleased) {
+		t.Fatalf("304 gave %+v, want the known version marked not modified", check)
+	}
+	if check.ETag != `"v1"` {
+		t.Fatalf("304 gave ETag %q, want %q", check.ETag, `"v1"`)
+	}
+}
+
+func TestGetChecksumFallsBackToIfModifiedSince(t *testing.T) {
+	srv, requests := etagUpstream(t, "")
+	s := NewServer(WithLogger(quietLogger()), WithDoer(srv.Client()), WithBaseURL(srv.URL),
+		WithState(&ArcDPSVersion{CheckSum: testChecksum, Timestamp: testReleased}))
+
+	if _, err := s.GetChecksum(context.Background()); err != nil {
+		t.Fatalf("GetChecksum() = %v", err)
+	}
+	last := (*requests)[0]
+	if got := last.Get("If-Modified-Since"); got != testReleased.Format(http.TimeFormat) {
+		t.Fatalf("sent If-Modified-Since %q, want %q", got, testReleased.Format(http.TimeFormat))
+	}
+	if last.Get("If-None-Match") != "" {
+		t.Fatalf("sent If-None-Match without an ETag")
+	}
+}
+
+func TestTickSurvivesPanic(t *testing.T) {
+	up := newUpstream(t)
+	var calls int32
+	doer := doerFunc(func(req *http.Request) (*http.Response, error) {
+		if atomic.AddInt32(&calls, 1) == 2 {
+			panic("injected")
+		}
+		return up.Client().Do(req)
+	})
+	clock := newFakeClock(testReleased)
+	s := newTestServer(up, WithDoer(doer), WithClock(clock))
+	startTick(t, s)
+
+	// the startup check, then a tick that panics and two that shouldn't notice
+	for i := 0; i < 3; i++ {
+		clock.waitForTimers(t, 1)
+		clock.Advance(DefaultTickDuration)
+	}
+	clock.waitForTimers(t, 1)
+	if n := atomic.LoadInt32(&calls); n != 4 {
+		t.Fatalf("%d checks, want 4 with the loop still running after the panic", n)
+	}
+	s.metrics.mu.Lock()
+	panics := s.metrics.panics
+	s.metrics.mu.Unlock()
+	if panics != 1 {
+		t.Fatalf("%d panics counted, want 1", panics)
+	}
+}
+
+// checksumHeader is the header deltaconnected answers the checksum with
+func checksumHeader(lastModified string) http.Header {
+	h := make(http.Header)
+	h.Set("Content-Type", "text/plain")
+	h.Set("Last-Modified", lastModified)
+	h.Set("ETag", `"v1"`)
+	return h
+}
+
+func TestParseChecksum(t *testing.T) {
+	body := []byte(testChecksum + "  d3d9.dll\n")
+	for _, tc := range []struct {
+		name   string
+		header http.Header
+		body   []byte
+		err    string
+	}{
+		{"valid", checksumHeader(testReleased.Format(http.TimeFormat)), body, ""},
+		{"zone other than GMT", checksumHeader("Fri, 01 Mar 2024 12:00:00 UTC"), body, ""},
+		{"html", func() http.Header {
+			h := checksumHeader(testReleased.Format(http.TimeFormat))
+			h.Set("Content-Type", "text/html; charset=utf-8")
+			return h
+		}(), body, "unexpected content type"},
+		{"bad time", checksumHeader("yesterday"), body, "unable to parse time"},
+		{"no space", checksumHeader(testReleased.Format(http.TimeFormat)), []byte(testChecksum), "incorrect size of checksum split"},
+		{"invalid digest", checksumHeader(testReleased.Format(http.TimeFormat)), []byte("not-a-checksum  d3d9.dll\n"), "is not a valid md5 checksum"},
+	} {
+		s := NewServer(WithLogger(quietLogger()))
+		check, err := s.parseChecksum(tc.header, tc.body)
+		if tc.err != "" {
+			if err == nil || !strings.Contains(err.Error(), tc.err) {
+				t.Errorf("%s: parseChecksum() = %v, want an error containing %q", tc.name, err, tc.err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: parseChecksum() = %v", tc.name, err)
+			continue
+		}
+		if check.Checksum != testChecksum || !check.LastModified.Equal(testReleased) || check.ETag != `"v1"` {
+			t.Errorf("%s: parsed %+v, want %s released %s with ETag %q", tc.name, check, testChecksum, testReleased, `"v1"`)
+		}
+	}
+}
+
+func BenchmarkParseChecksum(b *testing.B) {
+	s := NewServer(WithLogger(quietLogger()))
+	header := checksumHeader(testReleased.Format(http.TimeFormat))
+	body := []byte(testChecksum + "  d3d9.dll\n")
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := s.parseChecksum(header, body); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func TestScheduleDigestNeverReusesABoundary(t *testing.T) {
+	boundary := time.Date(2024, 3, 2, 0, 0, 0, 0, time.UTC)
+	clock := newFakeClock(boundary)
+	s := newTestServer(newUpstream(t), WithClock(clock), WithDigest(24*time.Hour))
+
+	// NTP steps the clock back an hour just after the digest went out
+	clock.Step(-time.Hour)
+	at, fire := s.scheduleDigest(boundary)
+	if want := boundary.Add(24 * time.Hour); !at.Equal(want) {
+		t.Fatalf("next digest at %s after stepping back, want %s rather than the one just sent", at, want)
+	}
+	// which is 25 hours away by the stepped clock
+	clock.Advance(25*time.Hour - time.Second)
+	select {
+	case <-fire:
+		t.Fatalf("digest fired before its boundary")
+	default:
+	}
+	clock.Advance(time.Second)
+	select {
+	case <-fire:
+	default:
+		t.Fatalf("digest didn't fire at its boundary")
+	}
+}
+
+func TestTickIgnoresClockSteps(t *testing.T) {
+	up := newUpstream(t)
+	clock := newFakeClock(testReleased)
+	s := newTestServer(up, WithClock(clock))
+	startTick(t, s)
+	clock.waitForTimers(t, 1)
+	checks := up.count()
+
+	// stepping either way neither checks early nor makes up for lost time
+	clock.Step(-time.Hour)
+	clock.Step(3 * time.Hour)
+	clock.Advance(DefaultTickDuration - time.Second)
+	if n := up.count(); n != checks {
+		t.Fatalf("%d checks after the clock was stepped, want %d", n, checks)
+	}
+	clock.Advance(time.Second)
+	clock.waitForTimers(t, 1)
+	if n := up.count(); n != checks+1 {
+		t.Fatalf("%d checks once the interval passed, want %d", n, checks+1)
+	}
+}
+
+func TestErrorBodiesAreCapped(t *testing.T) {
+	// a misbehaving proxy answering every request with a huge error page
+	page := strings.Repeat("<p>bad gateway</p>", 64<<10)
+	doer := doerFunc(func(req *http.Request) (*http.Response, error) {
+		return response(req, http.StatusBadRequest, page), nil
+	})
+	s := NewServer(WithLogger(quietLogger()), WithDoer(doer))
+	gh, err := NewGitHubNotifier(doer, GitHubConfig{Token: "token", Repo: "owner/repo", Issue: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	tg, err := NewTelegramNotifier(doer, TelegramConfig{Token: "token", ChatID: "1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	u := &Update{Checksum: testChecksum, LastModified: testReleased}
+	ctx := context.Background()
+
+	for name, err := range map[string]error{
+		"discord":  s.SendWebHook(ctx, Webhook{URL: "https://discord.invalid/webhook", Format: WebhookFormatEmbed}, u),
+		"github":   gh.Notify(ctx, u),
+		"telegram": tg.Notify(ctx, u),
+	} {
+		if err == nil {
+			t.Errorf("%s: succeeded on a 400", name)
+			continue
+		}
+		if n := len(err.Error()); n > 2048 {
+			t.Errorf("%s: error is %d bytes, the body should have been cut short", name, n)
+		}
+	}
+}
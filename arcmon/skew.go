@@ -0,0 +1,21 @@
+package arcmon
+
+import "time"
+
+// DefaultClockSkewThreshold is how far ahead of local time a Last-Modified may be before we suspect our own clock
+const DefaultClockSkewThreshold = 5 * time.Minute
+
+// releaseAge returns how long ago lastModified was. A timestamp further in the
+// future than threshold means the local clock is likely wrong, in which case
+// skewed is reported instead of a nonsensical negative age. Smaller drift is
+// treated as a release that just happened.
+func releaseAge(lastModified, now time.Time, threshold time.Duration) (age time.Duration, skewed bool) {
+	age = now.Sub(lastModified)
+	if age < -threshold {
+		return 0, true
+	}
+	if age < 0 {
+		age = 0
+	}
+	return age, false
+}
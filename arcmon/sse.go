@@ -0,0 +1,141 @@
+package arcmon
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	// DefaultSSEClientBuffer is how many events a slow client may fall behind before events are dropped for it
+	DefaultSSEClientBuffer = 16
+	sseKeepAlive           = 30 * time.Second
+)
+
+// Broadcaster fans update events out to every connected SSE client without ever
+// blocking the publisher on a slow consumer. Events a client is too slow for
+// are counted instead, see Missed.
+type Broadcaster struct {
+	mu sync.Mutex
+	// clients maps each subscription to how many events it has missed
+	clients map[chan UpdateEvent]int
+	buffer  int
+	closed  bool
+}
+
+func NewBroadcaster() *Broadcaster {
+	return &Broadcaster{clients: make(map[chan UpdateEvent]int), buffer: DefaultSSEClientBuffer}
+}
+
+// Subscribe registers a new client, the returned channel is closed when the broadcaster is
+func (b *Broadcaster) Subscribe() chan UpdateEvent {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	ch := make(chan UpdateEvent, b.buffer)
+	if b.closed {
+		close(ch)
+		return ch
+	}
+	b.clients[ch] = 0
+	return ch
+}
+
+// Missed returns how many events were dropped for ch since it was last asked, resetting the count
+func (b *Broadcaster) Missed(ch chan UpdateEvent) int {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	n, ok := b.clients[ch]
+	if ok {
+		b.clients[ch] = 0
+	}
+	return n
+}
+
+func (b *Broadcaster) Unsubscribe(ch chan UpdateEvent) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if _, ok := b.clients[ch]; ok {
+		delete(b.clients, ch)
+		close(ch)
+	}
+}
+
+func (b *Broadcaster) Publish(ev UpdateEvent) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	for ch := range b.clients {
+		select {
+		case ch <- ev:
+		default:
+			b.clients[ch]++
+			logrus.Warnf("dropping %s event for slow SSE client", ev.Type)
+		}
+	}
+}
+
+// Close disconnects every client so their streams end and the HTTP server can shut down
+func (b *Broadcaster) Close() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.closed = true
+	for ch := range b.clients {
+		delete(b.clients, ch)
+		close(ch)
+	}
+}
+
+func (s *Server) handleEvents(w http.ResponseWriter, r *http.Request) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "streaming unsupported", http.StatusInternalServerError)
+		return
+	}
+
+	ch := s.broadcaster.Subscribe()
+	defer s.broadcaster.Unsubscribe(ch)
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	fmt.Fprint(w, ": connected\n\n")
+	flusher.Flush()
+
+	keepAlive := time.NewTicker(sseKeepAlive)
+	defer keepAlive.Stop()
+	for {
+		select {
+		case ev, ok := <-ch:
+			if !ok {
+				return
+			}
+			b, err := json.Marshal(ev)
+			if err != nil {
+				logrus.Errorf("unable to encode event: (%v)", err)
+				continue
+			}
+			if _, err := fmt.Fprintf(w, "event: %s\ndata: %s\n\n", ev.Type, b); err != nil {
+				return
+			}
+			// dropped events are newer than anything buffered, so say so once caught up
+			if len(ch) == 0 {
+				if n := s.broadcaster.Missed(ch); n > 0 {
+					if _, err := fmt.Fprintf(w, "event: missed\ndata: {\"missed\":%d}\n\n", n); err != nil {
+						return
+					}
+				}
+			}
+			flusher.Flush()
+		case <-keepAlive.C:
+			if _, err := fmt.Fprint(w, ": ping\n\n"); err != nil {
+				return
+			}
+			flusher.Flush()
+		case <-r.Context().Done():
+			return
+		}
+	}
+}
@@ -0,0 +1,68 @@
+package arcmon
+
+import (
+	"encoding/json"
+	"net/http"
+	"time"
+)
+
+// VersionLifetime : How long a superseded version was live for
+type VersionLifetime struct {
+	CheckSum        string        `json:"check_sum"`
+	FirstSeen       time.Time     `json:"first_seen"`
+	LastSeen        time.Time     `json:"last_seen"`
+	Lifetime        time.Duration `json:"-"`
+	LifetimeText    string        `json:"lifetime"`
+	LifetimeSeconds int64         `json:"lifetime_seconds"`
+}
+
+// HistoryStats : Aggregates over the versions in the history. Only versions
+// that have been superseded count, the current one is still going.
+type HistoryStats struct {
+	Versions int              `json:"versions"`
+	Longest  *VersionLifetime `json:"longest,omitempty"`
+	Shortest *VersionLifetime `json:"shortest,omitempty"`
+}
+
+// historyStats finds the longest and shortest lived versions in a single pass
+func historyStats(history []HistoryEntry) HistoryStats {
+	stats := HistoryStats{Versions: len(history)}
+	for _, e := range history {
+		if e.LastSeen == nil {
+			continue
+		}
+		d := e.LastSeen.Sub(e.FirstSeen)
+		if stats.Longest == nil || d > stats.Longest.Lifetime {
+			stats.Longest = newVersionLifetime(e, d)
+		}
+		if stats.Shortest == nil || d < stats.Shortest.Lifetime {
+			stats.Shortest = newVersionLifetime(e, d)
+		}
+	}
+	return stats
+}
+
+func newVersionLifetime(e HistoryEntry, d time.Duration) *VersionLifetime {
+	return &VersionLifetime{
+		CheckSum:        e.CheckSum,
+		FirstSeen:       e.FirstSeen,
+		LastSeen:        *e.LastSeen,
+		Lifetime:        d,
+		LifetimeText:    d.Round(time.Second).String(),
+		LifetimeSeconds: int64(d / time.Second),
+	}
+}
+
+func (s *Server) handleStats(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	s.arcdps.RLock()
+	stats := historyStats(s.arcdps.History)
+	s.arcdps.RUnlock()
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(stats)
+}
@@ -0,0 +1,7 @@
+package arcmon
+
+// Store persists the tracked state. Save is called with the state's read lock
+// held every time it changes.
+type Store interface {
+	Save(arcdps *ArcDPSVersion) error
+}
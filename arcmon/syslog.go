@@ -0,0 +1,111 @@
+package arcmon
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// DefaultSyslogTag and DefaultSyslogFacility are used unless configured otherwise
+const (
+	DefaultSyslogTag      = "arcmon"
+	DefaultSyslogFacility = "daemon"
+)
+
+// errSyslogUnsupported is returned by dialSyslog where log/syslog doesn't exist
+var errSyslogUnsupported = errors.New("syslog is not supported on this platform")
+
+// syslogFacilities are the facilities a SyslogConfig can log to
+var syslogFacilities = []string{"daemon", "user", "local0", "local1", "local2", "local3", "local4", "local5", "local6", "local7"}
+
+// SyslogConfig : Settings for writing events to the local syslog or journald
+type SyslogConfig struct {
+	Tag      string
+	Facility string
+	// Events filters what is logged, see ParseEventFilter
+	Events string
+}
+
+// Validate checks the settings without connecting
+func (c SyslogConfig) Validate() error {
+	if c.Tag == "" || strings.ContainsAny(c.Tag, " \t\n") {
+		return fmt.Errorf("invalid tag %q, must be a single word", c.Tag)
+	}
+	for _, f := range syslogFacilities {
+		if c.Facility == f {
+			return nil
+		}
+	}
+	return fmt.Errorf("unknown facility %q, must be one of %s", c.Facility, strings.Join(syslogFacilities, ", "))
+}
+
+// syslogWriter is the part of a syslog connection the notifier uses, so
+// platforms without syslog can leave it out
+type syslogWriter interface {
+	Notice(m string) error
+	Warning(m string) error
+	Err(m string) error
+	Info(m string) error
+}
+
+// SyslogNotifier writes every event to syslog as key=value pairs, updates at
+// notice priority, failures at err and unavailability at warning. Where
+// syslog isn't available it does nothing.
+type SyslogNotifier struct {
+	instance
+	w syslogWriter
+}
+
+func NewSyslogNotifier(cfg SyslogConfig) (*SyslogNotifier, error) {
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+	w, err := dialSyslog(cfg.Facility, cfg.Tag)
+	if err == errSyslogUnsupported {
+		logrus.Warnf("syslog isn't available on this platform, events won't be logged to it")
+		return &SyslogNotifier{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &SyslogNotifier{w: w}, nil
+}
+
+func (n *SyslogNotifier) Name() string { return n.named("syslog") }
+
+func (n *SyslogNotifier) Notify(ctx context.Context, u *Update) error {
+	if n.w == nil {
+		return nil
+	}
+	msg := fmt.Sprintf("event=update checksum=%s last_modified=%s detected_at=%s major=%t download_url=%s",
+		u.Checksum, u.LastModified.UTC().Format(time.RFC3339), u.DetectedAt.UTC().Format(time.RFC3339), u.Major, u.DownloadURL)
+	if u.Previous != "" {
+		msg += " previous_checksum=" + u.Previous
+	}
+	return n.w.Notice(msg)
+}
+
+func (n *SyslogNotifier) NotifyFailure(ctx context.Context, f *Failure) error {
+	if n.w == nil {
+		return nil
+	}
+	return n.w.Err(fmt.Sprintf("event=failure since=%s error=%q", f.Since.UTC().Format(time.RFC3339), f.Err))
+}
+
+func (n *SyslogNotifier) NotifyHeartbeat(ctx context.Context, h *Heartbeat) error {
+	if n.w == nil {
+		return nil
+	}
+	return n.w.Info(fmt.Sprintf("event=heartbeat checksum=%s quiet=%s", h.Checksum, h.Quiet.Round(time.Second)))
+}
+
+func (n *SyslogNotifier) NotifyUnavailable(ctx context.Context, u *Unavailable) error {
+	if n.w == nil {
+		return nil
+	}
+	return n.w.Warning(fmt.Sprintf("event=unavailable checksum=%s since=%s url=%s", u.Checksum, u.Since.UTC().Format(time.RFC3339), u.URL))
+}
@@ -0,0 +1,8 @@
+//go:build windows || plan9
+
+package arcmon
+
+// dialSyslog always fails, log/syslog doesn't exist here
+func dialSyslog(facility, tag string) (syslogWriter, error) {
+	return nil, errSyslogUnsupported
+}
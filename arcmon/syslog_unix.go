@@ -0,0 +1,23 @@
+//go:build !windows && !plan9
+
+package arcmon
+
+import "log/syslog"
+
+var syslogPriorities = map[string]syslog.Priority{
+	"daemon": syslog.LOG_DAEMON,
+	"user":   syslog.LOG_USER,
+	"local0": syslog.LOG_LOCAL0,
+	"local1": syslog.LOG_LOCAL1,
+	"local2": syslog.LOG_LOCAL2,
+	"local3": syslog.LOG_LOCAL3,
+	"local4": syslog.LOG_LOCAL4,
+	"local5": syslog.LOG_LOCAL5,
+	"local6": syslog.LOG_LOCAL6,
+	"local7": syslog.LOG_LOCAL7,
+}
+
+// dialSyslog connects to the local syslog daemon, which journald provides too
+func dialSyslog(facility, tag string) (syslogWriter, error) {
+	return syslog.New(syslogPriorities[facility]|syslog.LOG_NOTICE, tag)
+}
@@ -0,0 +1,132 @@
+package arcmon
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"html"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// TelegramAPIURL is the Bot API the Telegram notifier sends messages through
+const TelegramAPIURL = "https://api.telegram.org"
+
+// TelegramConfig : Settings for the optional Telegram notifier, enabled when Token is set
+type TelegramConfig struct {
+	Token  string
+	ChatID string
+	// Events filters what is sent, see ParseEventFilter
+	Events string
+}
+
+func (c TelegramConfig) Enabled() bool { return c.Token != "" }
+
+// TelegramNotifier sends updates to a Telegram chat as a bot
+type TelegramNotifier struct {
+	instance
+	http   Doer
+	token  string
+	chatID string
+	log    logrus.FieldLogger
+}
+
+func NewTelegramNotifier(client Doer, cfg TelegramConfig) (*TelegramNotifier, error) {
+	if cfg.Token == "" {
+		return nil, fmt.Errorf("missing Telegram bot token")
+	}
+	if cfg.ChatID == "" {
+		return nil, fmt.Errorf("missing Telegram chat ID")
+	}
+	return &TelegramNotifier{http: client, token: cfg.Token, chatID: cfg.ChatID, log: logrus.StandardLogger()}, nil
+}
+
+func (t *TelegramNotifier) useLogger(l logrus.FieldLogger) { t.log = l }
+
+func (t *TelegramNotifier) Name() string { return t.named("telegram") }
+
+func (t *TelegramNotifier) Notify(ctx context.Context, u *Update) error {
+	return t.send(ctx, fmt.Sprintf("<b>ArcDPS has updated!</b>\n\n<b>Checksum:</b> <code>%s</code>\n<b>Timestamp Version:</b> <code>%s</code>\n\n<a href=\"%s\">Direct Download Link</a>",
+		html.EscapeString(u.Checksum), u.LastModified.UTC().Format(time.RFC1123), html.EscapeString(u.DownloadURL)))
+}
+
+func (t *TelegramNotifier) NotifyFailure(ctx context.Context, f *Failure) error {
+	return t.send(ctx, fmt.Sprintf("<b>ArcDPS Monitor checks are failing</b> since <code>%s</code>\n\n<code>%s</code>",
+		f.Since.UTC().Format(time.RFC1123), html.EscapeString(f.Err)))
+}
+
+func (t *TelegramNotifier) NotifyHeartbeat(ctx context.Context, h *Heartbeat) error {
+	return t.send(ctx, fmt.Sprintf("<b>ArcDPS Monitor is still watching</b>, no arcdps update in %s\n\n<b>Checksum:</b> <code>%s</code>\n<b>Timestamp Version:</b> <code>%s</code>",
+		quietFor(h.Quiet), html.EscapeString(h.Checksum), h.LastModified.UTC().Format(time.RFC1123)))
+}
+
+func (t *TelegramNotifier) NotifyUnavailable(ctx context.Context, u *Unavailable) error {
+	return t.send(ctx, fmt.Sprintf("<b>ArcDPS is no longer available</b>, missing since <code>%s</code>\n\n<b>Last Checksum:</b> <code>%s</code>\n%s",
+		u.Since.UTC().Format(time.RFC1123), html.EscapeString(u.Checksum), html.EscapeString(u.URL)))
+}
+
+func (t *TelegramNotifier) NotifyDigest(ctx context.Context, d *Digest) error {
+	var b strings.Builder
+	fmt.Fprintf(&b, "<b>ArcDPS updated %d times</b>\n", len(d.Updates))
+	for _, u := range d.Updates {
+		fmt.Fprintf(&b, "\n<code>%s</code> released <code>%s</code>", html.EscapeString(u.Checksum), u.LastModified.UTC().Format(time.RFC1123))
+	}
+	return t.send(ctx, b.String())
+}
+
+// telegramResponse : Envelope of every Bot API response
+type telegramResponse struct {
+	OK          bool   `json:"ok"`
+	ErrorCode   int    `json:"error_code"`
+	Description string `json:"description"`
+}
+
+// send posts text as HTML, which only needs <, > and & escaped, so anything
+// interpolated into it goes through html.EscapeString
+func (t *TelegramNotifier) send(ctx context.Context, text string) error {
+	body, err := json.Marshal(map[string]interface{}{
+		"chat_id":    t.chatID,
+		"text":       text,
+		"parse_mode": "HTML",
+	})
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, "POST", fmt.Sprintf("%s/bot%s/sendMessage", TelegramAPIURL, t.token), bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := t.http.Do(req)
+	if err != nil {
+		// the token is part of the URL, keep it out of the logs
+		return fmt.Errorf("%s", strings.ReplaceAll(err.Error(), t.token, "<token>"))
+	}
+	defer resp.Body.Close()
+
+	// a success echoes the message back, up to Telegram's 4096 characters
+	respBody, err := io.ReadAll(io.LimitReader(resp.Body, 64<<10))
+	if err != nil {
+		return err
+	}
+	var tr telegramResponse
+	if err := json.Unmarshal(respBody, &tr); err != nil {
+		detail, _ := truncate(string(respBody), 1024)
+		return fmt.Errorf("bad response from Telegram: %d (%s)", resp.StatusCode, detail)
+	}
+	if tr.OK {
+		return nil
+	}
+
+	if strings.Contains(strings.ToLower(tr.Description), "chat not found") {
+		t.log.Errorf("Telegram chat %s not found, check the chat ID and that the bot has been added to the chat", t.chatID)
+	}
+	return fmt.Errorf("bad response from Telegram: %d (%s)", tr.ErrorCode, tr.Description)
+}
@@ -0,0 +1,63 @@
+package arcmon
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/sirupsen/logrus/hooks/test"
+)
+
+func TestTelegramEscapesInterpolatedText(t *testing.T) {
+	var sent map[string]interface{}
+	doer := doerFunc(func(req *http.Request) (*http.Response, error) {
+		body, err := io.ReadAll(req.Body)
+		if err != nil {
+			return nil, err
+		}
+		if err := json.Unmarshal(body, &sent); err != nil {
+			return nil, err
+		}
+		return response(req, http.StatusOK, `{"ok": true}`), nil
+	})
+	tg, err := NewTelegramNotifier(doer, TelegramConfig{Token: "token", ChatID: "1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// an error full of what legacy Markdown choked on, and what HTML needs escaped
+	f := &Failure{Since: time.Now(), Err: "Get \"https://x/?a=1&b_c=*2*\": `dial` [tcp] <nil>"}
+	if err := tg.NotifyFailure(context.Background(), f); err != nil {
+		t.Fatalf("NotifyFailure() = %v", err)
+	}
+	if sent["parse_mode"] != "HTML" {
+		t.Fatalf("parse_mode = %v, want HTML", sent["parse_mode"])
+	}
+	text, _ := sent["text"].(string)
+	if want := "<code>Get &#34;https://x/?a=1&amp;b_c=*2*&#34;: `dial` [tcp] &lt;nil&gt;</code>"; !strings.Contains(text, want) {
+		t.Fatalf("text = %q, want the error escaped as %q", text, want)
+	}
+}
+
+func TestTelegramChatNotFoundUsesServerLogger(t *testing.T) {
+	doer := doerFunc(func(req *http.Request) (*http.Response, error) {
+		return response(req, http.StatusBadRequest, `{"ok": false, "error_code": 400, "description": "Bad Request: chat not found"}`), nil
+	})
+	tg, err := NewTelegramNotifier(doer, TelegramConfig{Token: "token", ChatID: "42"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	log, hook := test.NewNullLogger()
+	NewServer(WithLogger(log), WithNotifier(tg))
+
+	if err := tg.Notify(context.Background(), &Update{Checksum: testChecksum, LastModified: testReleased}); err == nil {
+		t.Fatalf("Notify() succeeded on a missing chat")
+	}
+	if e := hook.LastEntry(); e == nil || !strings.Contains(e.Message, "chat 42 not found") {
+		t.Fatalf("chat not found hint wasn't logged through the server's logger, got %v", e)
+	}
+}
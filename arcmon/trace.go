@@ -0,0 +1,82 @@
+package arcmon
+
+import (
+	"crypto/tls"
+	"net/http"
+	"net/http/httptrace"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// requestTiming : When each phase of a traced request happened, zero for
+// phases it skipped, like DNS and connecting on a reused connection. Dialing
+// can race several addresses, so the hooks may run concurrently.
+type requestTiming struct {
+	mu sync.Mutex
+
+	start, firstByte          time.Time
+	dnsStart, dnsDone         time.Time
+	connectStart, connectDone time.Time
+	tlsStart, tlsDone         time.Time
+	reused                    bool
+}
+
+// mark records now in *at unless an earlier call already did, so the first
+// attempt of each phase is the one timed
+func (t *requestTiming) mark(at *time.Time) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if at.IsZero() {
+		*at = time.Now()
+	}
+}
+
+// traceRequest attaches an httptrace.ClientTrace to req when WithHTTPTrace is
+// on. The returned func logs the breakdown at debug level and should be called
+// once the response has been read.
+func (s *Server) traceRequest(req *http.Request) (*http.Request, func()) {
+	if !s.httpTrace {
+		return req, func() {}
+	}
+
+	t := &requestTiming{start: time.Now()}
+	trace := &httptrace.ClientTrace{
+		DNSStart:             func(httptrace.DNSStartInfo) { t.mark(&t.dnsStart) },
+		DNSDone:              func(httptrace.DNSDoneInfo) { t.mark(&t.dnsDone) },
+		ConnectStart:         func(string, string) { t.mark(&t.connectStart) },
+		ConnectDone:          func(string, string, error) { t.mark(&t.connectDone) },
+		TLSHandshakeStart:    func() { t.mark(&t.tlsStart) },
+		TLSHandshakeDone:     func(tls.ConnectionState, error) { t.mark(&t.tlsDone) },
+		GotFirstResponseByte: func() { t.mark(&t.firstByte) },
+		GotConn: func(info httptrace.GotConnInfo) {
+			t.mu.Lock()
+			t.reused = info.Reused
+			t.mu.Unlock()
+		},
+	}
+	req = req.WithContext(httptrace.WithClientTrace(req.Context(), trace))
+
+	return req, func() {
+		t.mu.Lock()
+		defer t.mu.Unlock()
+		s.log.WithFields(logrus.Fields{
+			"url":     req.URL.String(),
+			"dns":     since(t.dnsStart, t.dnsDone),
+			"connect": since(t.connectStart, t.connectDone),
+			"tls":     since(t.tlsStart, t.tlsDone),
+			"ttfb":    since(t.start, t.firstByte),
+			"total":   time.Since(t.start),
+			"reused":  t.reused,
+		}).Debugf("request timing")
+	}
+}
+
+// since is how long the phase between start and end took, zero if it didn't happen
+func since(start, end time.Time) time.Duration {
+	if start.IsZero() || end.IsZero() {
+		return 0
+	}
+	return end.Sub(start)
+}
@@ -0,0 +1,87 @@
+package arcmon
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+)
+
+// DefaultUnavailableAfter is how many checks in a row must find the checksum
+// missing before it's announced as no longer available
+const DefaultUnavailableAfter = 3
+
+// statusError : Non-2xx response from deltaconnected
+type statusError struct {
+	StatusCode int
+	Body       string
+}
+
+func (e *statusError) Error() string {
+	return fmt.Sprintf("bad response from delta: (%s)", e.Body)
+}
+
+func isNotFound(err error) bool {
+	var se *statusError
+	return errors.As(err, &se) && se.StatusCode == http.StatusNotFound
+}
+
+// Unavailable : Describes the monitored file disappearing after it had been published
+type Unavailable struct {
+	URL string
+	// Checksum is the last version seen before it went missing
+	Checksum string
+	Since    time.Time
+}
+
+// UnavailableNotifier is implemented by notifiers that can announce the monitored file going missing
+type UnavailableNotifier interface {
+	NotifyUnavailable(ctx context.Context, u *Unavailable) error
+}
+
+// trackAvailability counts checks in a row answered with a 404 once a version
+// has been seen, announcing it to every notifier when it reaches
+// unavailableAfter. Other errors leave the count alone, since they say nothing
+// about whether the file is still there.
+func (s *Server) trackAvailability(ctx context.Context, err error) {
+	s.arcdps.RLock()
+	checksum := s.arcdps.CheckSum
+	s.arcdps.RUnlock()
+
+	switch {
+	case err == nil:
+		if s.unavailableSent {
+			s.log.Infof("%s is available again", s.checksumURL())
+		}
+		s.notFound, s.unavailableSent = 0, false
+		return
+	case !isNotFound(err) || checksum == "":
+		return
+	}
+
+	s.notFound++
+	if s.notFound == 1 {
+		s.notFoundSince = s.clock.Now()
+	}
+	if s.notFound < s.unavailableAfter || s.unavailableSent {
+		return
+	}
+	s.unavailableSent = true
+
+	u := &Unavailable{URL: s.checksumURL(), Checksum: checksum, Since: s.notFoundSince}
+	s.log.Warnf("%s has been missing for %d checks, announcing it as no longer available", u.URL, s.notFound)
+	for _, r := range s.activeRoutes() {
+		un, ok := r.n.(UnavailableNotifier)
+		if !ok {
+			continue
+		}
+		err := un.NotifyUnavailable(ctx, u)
+		s.metrics.countNotification(r.n.Name(), "unavailable", err)
+		if err != nil {
+			s.log.Errorf("unable to send unavailable notice to %s: (%v)", r.n.Name(), err)
+			continue
+		}
+		s.log.Infof("sent unavailable notice to %s", r.n.Name())
+	}
+}
@@ -0,0 +1,31 @@
+package arcmon
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// ValidateHeader checks that name is a valid header name and value can be sent in it
+func ValidateHeader(name, value string) error {
+	if !validHeaderName(name) {
+		return fmt.Errorf("invalid header name %q", name)
+	}
+	if strings.ContainsAny(value, "\r\n\x00") {
+		return fmt.Errorf("invalid value for header %s", name)
+	}
+	return nil
+}
+
+// setUpstreamHeaders adds the WithUpstreamHeaders headers to a request for
+// deltaconnected, replacing any the monitor set itself. Host can't be sent as
+// a header, so it overrides the request's host instead.
+func (s *Server) setUpstreamHeaders(req *http.Request) {
+	for name, value := range s.upstreamHeaders {
+		if http.CanonicalHeaderKey(name) == "Host" {
+			req.Host = value
+			continue
+		}
+		req.Header.Set(name, value)
+	}
+}
@@ -0,0 +1,172 @@
+package arcmon
+
+import (
+	"bytes"
+	"context"
+	"debug/pe"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// DefaultMaxDLLSize caps how much of the DLL is downloaded when verifying it
+const DefaultMaxDLLSize = 64 << 20
+
+// peHeaderSize is how much of the DLL is kept to read its PE headers from,
+// comfortably more than linkers put before the section data
+const peHeaderSize = 4 << 10
+
+// Signatures reported by WithSignatureCheck
+const (
+	SignatureSigned   = "signed"
+	SignatureUnsigned = "unsigned"
+)
+
+// dllInfo : What the PE headers of a verified DLL say about it, zero values when unknown
+type dllInfo struct {
+	BuiltAt   time.Time
+	Signature string
+}
+
+// verifyDLL downloads the DLL and checks that it hashes to checksum. The
+// body is hashed as it streams in, so memory use doesn't grow with the file,
+// and reading stops once it passes maxSize. The build date from the PE header
+// is returned too, zero if it couldn't be read, and whether it's signed when
+// checkSignature is set.
+func (s *Server) verifyDLL(ctx context.Context, checksum string) (dllInfo, error) {
+	req, err := http.NewRequestWithContext(ctx, "GET", s.dllURL(), nil)
+	if err != nil {
+		return dllInfo{}, err
+	}
+	s.setUpstreamHeaders(req)
+
+	resp, err := s.http.Do(req)
+	if err != nil {
+		return dllInfo{}, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode > 299 {
+		return dllInfo{}, fmt.Errorf("bad response downloading DLL: %d", resp.StatusCode)
+	}
+
+	// the checksum is of the DLL itself, not however it was encoded in transit
+	r, err := decodedBody(resp)
+	if err != nil {
+		return dllInfo{}, fmt.Errorf("unable to decompress DLL: (%v)", err)
+	}
+	h := hashes[s.hashAlgorithm]()
+	header := &prefixWriter{limit: peHeaderSize}
+	n, err := io.Copy(io.MultiWriter(h, header), io.LimitReader(r, s.maxDLLSize+1))
+	if err != nil {
+		return dllInfo{}, fmt.Errorf("unable to download DLL: (%v)", err)
+	}
+	if n > s.maxDLLSize {
+		return dllInfo{}, fmt.Errorf("DLL is larger than the %d byte limit", s.maxDLLSize)
+	}
+
+	if sum := hex.EncodeToString(h.Sum(nil)); !strings.EqualFold(sum, checksum) {
+		return dllInfo{}, fmt.Errorf("downloaded DLL hashes to %s, not the published %s", sum, checksum)
+	}
+	info := dllInfo{BuiltAt: buildDate(header.buf, s.clock.Now())}
+	if s.checkSignature {
+		info.Signature = peSignature(header.buf)
+		// arcdps is unsigned by design, a signature means someone else built it
+		if info.Signature == SignatureSigned {
+			s.log.Warnf("%s carries an Authenticode signature, which arcdps releases don't", checksum)
+		}
+	}
+	return info, nil
+}
+
+// prefixWriter keeps the first limit bytes written to it and discards the rest
+type prefixWriter struct {
+	buf   []byte
+	limit int
+}
+
+func (w *prefixWriter) Write(p []byte) (int, error) {
+	if room := w.limit - len(w.buf); room > 0 {
+		if len(p) < room {
+			room = len(p)
+		}
+		w.buf = append(w.buf, p[:room]...)
+	}
+	return len(p), nil
+}
+
+// buildDate reads the link time from the COFF header of a PE file, given its
+// first bytes. Only the header itself is decoded, pe.NewFile would go on to
+// read symbol tables that lie past the prefix. Reproducible builds store a hash
+// there instead, so stamps that can't be a build date, before 2000 or after
+// now, are ignored like unreadable headers are, returning zero.
+func buildDate(header []byte, now time.Time) time.Time {
+	fh, _, ok := coffHeader(header)
+	if !ok {
+		return time.Time{}
+	}
+	built := time.Unix(int64(fh.TimeDateStamp), 0).UTC()
+	if built.Year() < 2000 || built.After(now) {
+		return time.Time{}
+	}
+	return built
+}
+
+// coffHeader decodes the COFF header of a PE file from its first bytes,
+// returning the rest of the prefix after it, where the optional header starts
+func coffHeader(header []byte) (pe.FileHeader, []byte, bool) {
+	var fh pe.FileHeader
+	// the DOS stub points at the PE signature, which the COFF header follows
+	if len(header) < 0x40 || header[0] != 'M' || header[1] != 'Z' {
+		return fh, nil, false
+	}
+	offset := int(binary.LittleEndian.Uint32(header[0x3c:]))
+	if offset < 0 || offset+4 > len(header) || !bytes.Equal(header[offset:offset+4], []byte("PE\x00\x00")) {
+		return fh, nil, false
+	}
+	r := bytes.NewReader(header[offset+4:])
+	if err := binary.Read(r, binary.LittleEndian, &fh); err != nil {
+		return fh, nil, false
+	}
+	return fh, header[len(header)-r.Len():], true
+}
+
+// peSignature reports whether a PE file, given its first bytes, has an
+// Authenticode certificate table, or "" if its headers can't be read. Only the
+// table's presence is checked, validating the certificates needs the whole file.
+func peSignature(header []byte) string {
+	fh, rest, ok := coffHeader(header)
+	if !ok || int(fh.SizeOfOptionalHeader) > len(rest) || len(rest) < 2 {
+		return ""
+	}
+	optional := bytes.NewReader(rest[:fh.SizeOfOptionalHeader])
+
+	var (
+		dirs  [16]pe.DataDirectory
+		count uint32
+	)
+	switch binary.LittleEndian.Uint16(rest) {
+	case 0x10b:
+		var oh pe.OptionalHeader32
+		if err := binary.Read(optional, binary.LittleEndian, &oh); err != nil {
+			return ""
+		}
+		dirs, count = oh.DataDirectory, oh.NumberOfRvaAndSizes
+	case 0x20b:
+		var oh pe.OptionalHeader64
+		if err := binary.Read(optional, binary.LittleEndian, &oh); err != nil {
+			return ""
+		}
+		dirs, count = oh.DataDirectory, oh.NumberOfRvaAndSizes
+	default:
+		return ""
+	}
+	if count > pe.IMAGE_DIRECTORY_ENTRY_SECURITY && dirs[pe.IMAGE_DIRECTORY_ENTRY_SECURITY].Size > 0 {
+		return SignatureSigned
+	}
+	return SignatureUnsigned
+}
@@ -0,0 +1,74 @@
+package arcmon
+
+import (
+	"context"
+	"crypto/md5"
+	"encoding/hex"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"runtime"
+	"strings"
+	"testing"
+)
+
+// patternReader produces an endless stream of bytes without holding any of it in memory
+type patternReader struct{ n int }
+
+func (r *patternReader) Read(p []byte) (int, error) {
+	for i := range p {
+		p[i] = byte(r.n % 251)
+		r.n++
+	}
+	return len(p), nil
+}
+
+// largeDLL serves size bytes of patternReader output as the DLL, returning its MD5
+func largeDLL(t *testing.T, size int64) (*httptest.Server, string) {
+	t.Helper()
+	h := md5.New()
+	io.Copy(h, io.LimitReader(&patternReader{}, size))
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.CopyN(w, &patternReader{}, size)
+	}))
+	t.Cleanup(srv.Close)
+	return srv, hex.EncodeToString(h.Sum(nil))
+}
+
+func TestVerifyDLLStreamsLargeBody(t *testing.T) {
+	const size = 48 << 20
+	srv, checksum := largeDLL(t, size)
+	s := NewServer(WithLogger(quietLogger()), WithDoer(srv.Client()), WithBaseURL(srv.URL), WithDLLVerification(DefaultMaxDLLSize))
+
+	var before, after runtime.MemStats
+	runtime.GC()
+	runtime.ReadMemStats(&before)
+	if _, err := s.verifyDLL(context.Background(), checksum); err != nil {
+		t.Fatalf("verifyDLL() = %v", err)
+	}
+	runtime.ReadMemStats(&after)
+	// the test server's side of the copy is in here too, still far from the whole file
+	if grew := after.TotalAlloc - before.TotalAlloc; grew > size/4 {
+		t.Fatalf("verifying a %d byte DLL allocated %d bytes, it should be streamed", size, grew)
+	}
+}
+
+func TestVerifyDLLStopsAtMaxSize(t *testing.T) {
+	const size = 8 << 20
+	srv, checksum := largeDLL(t, size)
+	s := NewServer(WithLogger(quietLogger()), WithDoer(srv.Client()), WithBaseURL(srv.URL), WithDLLVerification(size-1))
+
+	_, err := s.verifyDLL(context.Background(), checksum)
+	if err == nil || !strings.Contains(err.Error(), "larger than") {
+		t.Fatalf("verifyDLL() = %v for a DLL over the limit, want a size error", err)
+	}
+}
+
+func TestVerifyDLLRejectsMismatch(t *testing.T) {
+	srv, _ := largeDLL(t, 1<<20)
+	s := NewServer(WithLogger(quietLogger()), WithDoer(srv.Client()), WithBaseURL(srv.URL), WithDLLVerification(DefaultMaxDLLSize))
+
+	if _, err := s.verifyDLL(context.Background(), testChecksum); err == nil {
+		t.Fatalf("accepted a DLL that doesn't hash to the published checksum")
+	}
+}
@@ -0,0 +1,54 @@
+package arcmon
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+// DefaultStaleMultiplier is how many intervals may pass without a completed
+// check before the monitor is considered stuck
+const DefaultStaleMultiplier = 3
+
+// watchdog notices when checks stop completing, for example because the tick
+// loop is deadlocked, while the process otherwise stays alive. It reports once
+// per stall and again only after checks have resumed and stalled anew.
+func (s *Server) watchdog(ctx context.Context, started time.Time) {
+	period := s.staleAfter / 4
+	if period < time.Second {
+		period = time.Second
+	}
+	stalled := false
+	for {
+		select {
+		case <-s.clock.After(period):
+		case <-ctx.Done():
+			return
+		}
+
+		s.mu.RLock()
+		last := s.lastChecked
+		s.mu.RUnlock()
+		if last.IsZero() {
+			last = started
+		}
+
+		age := s.since(last)
+		if age < s.staleAfter {
+			stalled = false
+			continue
+		}
+		if stalled {
+			continue
+		}
+		stalled = true
+
+		s.log.Errorf("no check has completed in %s, the monitor may be stuck", age.Round(time.Second))
+		if s.staleAlert {
+			s.notifyFailure(ctx, &Failure{Err: fmt.Sprintf("no check has completed in %s", age.Round(time.Second)), Since: last})
+		}
+		if s.onStale != nil {
+			s.onStale()
+		}
+	}
+}
@@ -0,0 +1,56 @@
+package arcmon
+
+import (
+	"context"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestWatchdogReportsEachStallOnce(t *testing.T) {
+	up := newUpstream(t)
+	clock := newFakeClock(testReleased)
+	n := &recordingNotifier{name: "recorder"}
+	var stalls int32
+	s := newTestServer(up, WithClock(clock), WithFilteredNotifier(EventsAll, n),
+		WithWatchdog(4*time.Minute, true, func() { atomic.AddInt32(&stalls, 1) }))
+
+	ctx, cncl := context.WithCancel(context.Background())
+	defer cncl()
+	go s.watchdog(ctx, clock.Now())
+
+	// the watchdog looks every quarter of staleAfter
+	minutes := func(m int) {
+		for i := 0; i < m; i++ {
+			clock.waitForTimers(t, 1)
+			clock.Advance(time.Minute)
+		}
+		clock.waitForTimers(t, 1)
+	}
+	minutes(3)
+	if got := atomic.LoadInt32(&stalls); got != 0 {
+		t.Fatalf("reported a stall after 3 minutes, staleAfter is 4")
+	}
+	minutes(1)
+	if got := atomic.LoadInt32(&stalls); got != 1 {
+		t.Fatalf("%d stalls reported once checks stopped for staleAfter, want 1", got)
+	}
+	minutes(10)
+	if got := atomic.LoadInt32(&stalls); got != 1 {
+		t.Fatalf("%d stalls reported for a single stall, want 1", got)
+	}
+	n.mu.Lock()
+	alerts := len(n.failures)
+	n.mu.Unlock()
+	if alerts != 1 {
+		t.Fatalf("%d failure alerts, want 1", alerts)
+	}
+
+	// a completed check ends the stall, so stopping again is a new one
+	s.recordCheck(nil)
+	minutes(1)
+	minutes(4)
+	if got := atomic.LoadInt32(&stalls); got != 2 {
+		t.Fatalf("%d stalls reported after checks resumed and stopped again, want 2", got)
+	}
+}
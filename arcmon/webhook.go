@@ -0,0 +1,70 @@
+package arcmon
+
+import (
+	"fmt"
+	"net/url"
+	"strings"
+)
+
+// Webhook formats
+const (
+	WebhookFormatEmbed = "embed"
+	WebhookFormatPlain = "plain"
+)
+
+// Webhook : A Discord webhook destination and how messages sent to it are rendered
+type Webhook struct {
+	URL    string
+	Format string
+	// Events filters what is posted, see ParseEventFilter
+	Events string
+}
+
+// ParseWebhooks parses a comma separated list of webhook URLs, each of which
+// may carry a |format suffix, e.g. "https://a,https://b|plain". Every valid
+// entry is returned alongside an error describing any invalid ones.
+func ParseWebhooks(raw string) ([]Webhook, error) {
+	var (
+		webhooks []Webhook
+		problems []string
+	)
+	for _, entry := range strings.Split(raw, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+
+		wh := Webhook{URL: entry, Format: WebhookFormatEmbed}
+		if i := strings.LastIndex(entry, "|"); i >= 0 {
+			wh.URL, wh.Format = strings.TrimSpace(entry[:i]), strings.ToLower(strings.TrimSpace(entry[i+1:]))
+		}
+		if wh.Format != WebhookFormatEmbed && wh.Format != WebhookFormatPlain {
+			problems = append(problems, fmt.Sprintf("%s: unknown format %q, must be embed or plain", wh.URL, wh.Format))
+			continue
+		}
+		if err := validateWebhookURL(wh.URL); err != nil {
+			problems = append(problems, fmt.Sprintf("%s: %v", wh.URL, err))
+			continue
+		}
+		webhooks = append(webhooks, wh)
+	}
+
+	if len(problems) > 0 {
+		return webhooks, fmt.Errorf("%s", strings.Join(problems, ", "))
+	}
+	return webhooks, nil
+}
+
+func validateWebhookURL(raw string) error {
+	u, err := url.Parse(raw)
+	if err != nil {
+		return err
+	}
+	if u.Scheme != "https" && u.Scheme != "http" {
+		return fmt.Errorf("unsupported scheme %q", u.Scheme)
+	}
+	if u.Host == "" {
+		return fmt.Errorf("missing host")
+	}
+	return nil
+}
@@ -0,0 +1,31 @@
+package arcmon
+
+import "testing"
+
+func TestParseWebhooksBlank(t *testing.T) {
+	for _, raw := range []string{"   ", ",", " , ,\t"} {
+		webhooks, err := ParseWebhooks(raw)
+		if err != nil {
+			t.Errorf("ParseWebhooks(%q) = %v, blank entries should be skipped", raw, err)
+		}
+		if len(webhooks) != 0 {
+			t.Errorf("ParseWebhooks(%q) returned %d webhooks, want none", raw, len(webhooks))
+		}
+	}
+}
+
+func TestParseWebhooksTrimsEntries(t *testing.T) {
+	webhooks, err := ParseWebhooks(" https://discord.com/api/webhooks/1/a ,, https://discord.com/api/webhooks/2/b | plain ")
+	if err != nil {
+		t.Fatalf("ParseWebhooks() = %v", err)
+	}
+	if len(webhooks) != 2 {
+		t.Fatalf("got %d webhooks, want 2", len(webhooks))
+	}
+	if webhooks[0].URL != "https://discord.com/api/webhooks/1/a" || webhooks[0].Format != WebhookFormatEmbed {
+		t.Errorf("first webhook parsed as %+v", webhooks[0])
+	}
+	if webhooks[1].URL != "https://discord.com/api/webhooks/2/b" || webhooks[1].Format != WebhookFormatPlain {
+		t.Errorf("second webhook parsed as %+v", webhooks[1])
+	}
+}
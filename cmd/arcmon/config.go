@@ -0,0 +1,785 @@
+package main
+
+import (
+	"crypto/x509"
+	"fmt"
+	"net"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/mythwright/arc-monitor/arcmon"
+	"github.com/sirupsen/logrus"
+)
+
+// DefaultStateFile is where the tracked version is persisted between runs
+const DefaultStateFile = "arcdps.yml"
+
+// DefaultHistoryArchive is where ARCHIVE_HISTORY appends trimmed history, next to the state
+const DefaultHistoryArchive = "arcdps-history-archive.jsonl"
+
+// STALE_ACTION values
+const (
+	StaleActionLog   = "log"
+	StaleActionAlert = "alert"
+	StaleActionExit  = "exit"
+)
+
+// Config : Everything the monitor reads from its environment
+type Config struct {
+	Webhooks      []arcmon.Webhook
+	DiscordBots   []arcmon.DiscordBot
+	StateFile     string
+	StateBackend  string
+	StateDB       string
+	CompressState bool
+	NotifyOnSeed  bool
+	// Baseline silences releases made at or before it, zero announces everything
+	Baseline time.Time
+	// DryRun logs updates instead of announcing them to any notifier
+	DryRun bool
+	// HTTPTrace logs the timing of each phase of checksum requests at debug level
+	HTTPTrace bool
+	// OTLPEndpoint is the OTLP/HTTP collector a trace of every tick is sent to, empty to not trace
+	OTLPEndpoint string
+	// OTelServiceName is the service.name traces are reported under
+	OTelServiceName string
+	// ForceHTTP1 disables HTTP/2 for proxies and CDNs that mishandle it
+	ForceHTTP1 bool
+	// NotifySelfUpgrade announces the monitor's own version changing between runs
+	NotifySelfUpgrade bool
+	// WatchDirectory announces changes to the deltaconnected directory listing
+	WatchDirectory bool
+	// Locales are the languages updates are announced in, in order
+	Locales []arcmon.Locale
+	// DisableDeadWebhooks stops posting to webhooks Discord says no longer exist
+	DisableDeadWebhooks bool
+	// ShowPrevious adds the replaced checksum to Discord messages
+	ShowPrevious bool
+	// InlineFields lays embed fields out side by side rather than full width
+	InlineFields bool
+	// EmbedTimestamp sets the release time as the native embed timestamp
+	EmbedTimestamp bool
+	// EmbedContent also sends the plain text of embed messages, for receivers that don't render embeds
+	EmbedContent bool
+	// Forum creates a forum post named by ForumThreadName for every message sent to a Discord webhook
+	Forum           bool
+	ForumThreadName string
+	VerifyDLL       bool
+	// VerifySignature reports whether the verified DLL carries an Authenticode signature
+	VerifySignature bool
+	// HashAlgorithm is the algorithm of the published checksum
+	HashAlgorithm string
+	MaxDLLSize    int
+	EventSocket   string
+	// Interval is how often deltaconnected is checked, raised to arcmon.MinTickInterval if below it
+	Interval   time.Duration
+	HealthAddr string
+	// AdminToken protects the endpoints that change a running instance, which are off without it
+	AdminToken string
+	LogLevel   logrus.Level
+	// PathPrefix is prepended to every HTTP endpoint, e.g. /arcmon
+	PathPrefix       string
+	AnnounceCooldown time.Duration
+	ShutdownTimeout  time.Duration
+	// ClockSkewThreshold is how far in the future Last-Modified may be before the local clock is suspect
+	ClockSkewThreshold time.Duration
+	StartupRetries     int
+	StartupRetryDelay  time.Duration
+	AlertGracePeriod   time.Duration
+	RetryJitter        bool
+	RetryMaxDelay      time.Duration
+	RetryMaxElapsed    time.Duration
+	RetryableStatus    []int
+	HistorySize        int
+	// HistoryArchive is where versions trimmed from the history are appended, empty to drop them
+	HistoryArchive   string
+	UnavailableAfter int
+	BreakerThreshold int
+	BreakerCooldown  time.Duration
+	SSEClientBuffer  int
+	IPVersion        string
+	// UpstreamHeaders are added to every request for deltaconnected
+	UpstreamHeaders map[string]string
+	// PinnedCerts are the SPKI SHA-256 hashes deltaconnected's certificate must match, if any
+	PinnedCerts [][]byte
+	// RootCAs is the system pool plus CA_BUNDLE_FILE, nil when no bundle is configured
+	RootCAs      *x509.CertPool
+	ThumbnailURL string
+	Branding     arcmon.Branding
+	HotfixWindow time.Duration
+	// StaleAfter is how long without a completed check before StaleAction is taken, zero disables it
+	StaleAfter  time.Duration
+	StaleAction string
+	// SelfTest probes deltaconnected and every notifier on startup, see SelfTestStrict
+	SelfTest string
+	// StatusWindow is how recent a successful check must be for /status, zero for three intervals
+	StatusWindow time.Duration
+	// DigestInterval batches updates into one digest per interval, zero announces them as they happen
+	DigestInterval time.Duration
+	// HeartbeatAfter is how long without an update before a heartbeat is posted, zero disables it
+	HeartbeatAfter  time.Duration
+	GitHub          []arcmon.GitHubConfig
+	Telegram        []arcmon.TelegramConfig
+	GenericWebhooks []arcmon.GenericWebhookConfig
+	NATS            []arcmon.NATSConfig
+	Syslog          []arcmon.SyslogConfig
+	// ConfigFile optionally declares further notifiers, each with its own event filter
+	ConfigFile string
+	// DuplicateNotifiers counts destinations listed more than once, only the first of which is kept
+	DuplicateNotifiers int
+}
+
+// Destinations is how many notifiers updates are sent to
+func (cfg *Config) Destinations() int {
+	return len(cfg.Webhooks) + len(cfg.DiscordBots) + len(cfg.GitHub) + len(cfg.Telegram) + len(cfg.GenericWebhooks) + len(cfg.NATS) + len(cfg.Syslog)
+}
+
+// StatePath is the file holding the state for the configured backend
+func (cfg *Config) StatePath() string {
+	if cfg.StateBackend == StateBackendSQLite {
+		return cfg.StateDB
+	}
+	return cfg.StateFile
+}
+
+// ConfigError : Every problem found while loading the configuration
+type ConfigError []string
+
+func (e ConfigError) Error() string {
+	return fmt.Sprintf("invalid configuration: %s", strings.Join(e, "; "))
+}
+
+// LoadConfig resolves and validates the configuration without touching the
+// network, collecting every problem rather than stopping at the first one.
+func LoadConfig(getenv func(string) string) (*Config, error) {
+	var problems ConfigError
+	cfg := &Config{
+		StateFile:          DefaultStateFile,
+		StateBackend:       StateBackendFile,
+		StateDB:            DefaultStateDB,
+		EventSocket:        getenv("EVENT_SOCKET"),
+		Interval:           arcmon.DefaultTickDuration,
+		HealthAddr:         getenv("HEALTH_ADDR"),
+		AdminToken:         getenv("ADMIN_TOKEN"),
+		LogLevel:           logrus.InfoLevel,
+		PathPrefix:         arcmon.NormalizePathPrefix(getenv("HTTP_PATH_PREFIX")),
+		AnnounceCooldown:   arcmon.DefaultAnnounceCooldown,
+		ShutdownTimeout:    DefaultShutdownTimeout,
+		ClockSkewThreshold: arcmon.DefaultClockSkewThreshold,
+		StartupRetries:     arcmon.DefaultStartupRetries,
+		StartupRetryDelay:  arcmon.DefaultStartupRetryDelay,
+		AlertGracePeriod:   arcmon.DefaultAlertGracePeriod,
+		RetryJitter:        true,
+		RetryMaxDelay:      arcmon.DefaultRetryMaxDelay,
+		RetryableStatus:    arcmon.DefaultRetryableStatus,
+		InlineFields:       true,
+		EmbedTimestamp:     true,
+		EmbedContent:       true,
+		HistorySize:        arcmon.DefaultHistorySize,
+		UnavailableAfter:   arcmon.DefaultUnavailableAfter,
+		BreakerThreshold:   arcmon.DefaultBreakerThreshold,
+		BreakerCooldown:    arcmon.DefaultBreakerCooldown,
+		SSEClientBuffer:    arcmon.DefaultSSEClientBuffer,
+		IPVersion:          IPVersionAuto,
+		HashAlgorithm:      arcmon.HashMD5,
+		ThumbnailURL:       getenv("EMBED_THUMBNAIL_URL"),
+		Branding: arcmon.Branding{
+			Footer:     getenv("EMBED_FOOTER"),
+			AuthorName: getenv("EMBED_AUTHOR_NAME"),
+			AuthorIcon: getenv("EMBED_AUTHOR_ICON"),
+		},
+		HotfixWindow: arcmon.DefaultHotfixWindow,
+		StaleAction:  StaleActionLog,
+		SelfTest:     SelfTestOff,
+		MaxDLLSize:   arcmon.DefaultMaxDLLSize,
+		ConfigFile:   getenv("CONFIG_FILE"),
+	}
+
+	// notifiers declared in the config file come first, the env vars are a shorthand on top
+	fileOK := true
+	if cfg.ConfigFile != "" {
+		if err := cfg.loadNotifiers(cfg.ConfigFile); err != nil {
+			problems = append(problems, fmt.Sprintf("CONFIG_FILE: %v", err))
+			fileOK = false
+		}
+	}
+
+	if v := getenv("RETRY_STATUS_CODES"); v != "" {
+		codes, err := parseStatusCodes(v)
+		if err != nil {
+			problems = append(problems, fmt.Sprintf("RETRY_STATUS_CODES: %v", err))
+		} else {
+			cfg.RetryableStatus = codes
+		}
+	}
+	if v := getenv("UPSTREAM_HEADERS"); v != "" {
+		headers, err := parseHeaders(v)
+		if err != nil {
+			problems = append(problems, fmt.Sprintf("UPSTREAM_HEADERS: %v", err))
+		} else {
+			cfg.UpstreamHeaders = headers
+		}
+	}
+	if v := getenv("CHECKSUM_ALGORITHM"); v != "" {
+		alg, err := arcmon.ParseHashAlgorithm(v)
+		if err != nil {
+			problems = append(problems, fmt.Sprintf("CHECKSUM_ALGORITHM: %v", err))
+		} else {
+			cfg.HashAlgorithm = alg
+		}
+	}
+
+	// kept out of the config file more easily than a per-notifier secret
+	if secret := getenv("GENERIC_WEBHOOK_SECRET"); secret != "" {
+		for i := range cfg.GenericWebhooks {
+			if cfg.GenericWebhooks[i].Secret == "" {
+				cfg.GenericWebhooks[i].Secret = secret
+			}
+		}
+	}
+
+	bot := arcmon.DiscordBot{Token: getenv("DISCORD_BOT_TOKEN"), ChannelID: getenv("DISCORD_CHANNEL_ID")}
+	switch {
+	case bot.Token == "" && bot.ChannelID == "":
+	case bot.Token == "":
+		problems = append(problems, "DISCORD_CHANNEL_ID is set without DISCORD_BOT_TOKEN")
+	case bot.ChannelID == "":
+		problems = append(problems, "DISCORD_BOT_TOKEN is set without DISCORD_CHANNEL_ID")
+	default:
+		if err := validateChannelID(bot.ChannelID); err != nil {
+			problems = append(problems, fmt.Sprintf("DISCORD_CHANNEL_ID: %v", err))
+		}
+		cfg.DiscordBots = append(cfg.DiscordBots, bot)
+	}
+
+	if raw := getenv("DISCORD_WEBHOOK"); raw != "" {
+		webhooks, err := arcmon.ParseWebhooks(raw)
+		switch {
+		case err != nil:
+			problems = append(problems, fmt.Sprintf("DISCORD_WEBHOOK: %v", err))
+		case len(webhooks) == 0:
+			// usually an env file with an empty value or a stray comma
+			problems = append(problems, "DISCORD_WEBHOOK is set but blank, it has no webhook URLs")
+		}
+		cfg.Webhooks = append(cfg.Webhooks, webhooks...)
+	}
+
+	parseDuration := func(key string, dst *time.Duration, allowZero bool) {
+		v := getenv(key)
+		if v == "" {
+			return
+		}
+		d, err := time.ParseDuration(v)
+		if err != nil || d < 0 || (d == 0 && !allowZero) {
+			problems = append(problems, fmt.Sprintf("invalid %s %q", key, v))
+			return
+		}
+		*dst = d
+	}
+	parseBool := func(key string, dst *bool) {
+		v := getenv(key)
+		if v == "" {
+			return
+		}
+		b, err := strconv.ParseBool(v)
+		if err != nil {
+			problems = append(problems, fmt.Sprintf("invalid %s %q, must be true or false", key, v))
+			return
+		}
+		*dst = b
+	}
+	parseBool("NOTIFY_ON_SEED", &cfg.NotifyOnSeed)
+	parseBool("DRY_RUN", &cfg.DryRun)
+	parseBool("EMBED_PREVIOUS_CHECKSUM", &cfg.ShowPrevious)
+	parseBool("AUTO_DISABLE_DEAD_WEBHOOKS", &cfg.DisableDeadWebhooks)
+	parseBool("EMBED_INLINE", &cfg.InlineFields)
+	parseBool("EMBED_TIMESTAMP", &cfg.EmbedTimestamp)
+	parseBool("EMBED_CONTENT", &cfg.EmbedContent)
+	parseBool("DISCORD_FORUM", &cfg.Forum)
+	cfg.ForumThreadName = getenv("DISCORD_FORUM_THREAD_NAME")
+	switch {
+	case cfg.Forum:
+		for _, wh := range cfg.Webhooks {
+			if err := arcmon.ValidateForumWebhook(wh.URL); err != nil {
+				problems = append(problems, fmt.Sprintf("DISCORD_FORUM: webhook %v", err))
+			}
+		}
+		if err := arcmon.ValidateThreadName(cfg.ForumThreadName); err != nil {
+			problems = append(problems, fmt.Sprintf("invalid DISCORD_FORUM_THREAD_NAME: %v", err))
+		}
+	case cfg.ForumThreadName != "":
+		problems = append(problems, "DISCORD_FORUM_THREAD_NAME is set without DISCORD_FORUM")
+	}
+	parseBool("WATCH_DIRECTORY", &cfg.WatchDirectory)
+	parseBool("NOTIFY_SELF_UPGRADE", &cfg.NotifySelfUpgrade)
+	parseBool("FORCE_HTTP1", &cfg.ForceHTTP1)
+	parseBool("HTTP_TRACE", &cfg.HTTPTrace)
+	cfg.OTLPEndpoint = getenv("OTEL_EXPORTER_OTLP_ENDPOINT")
+	cfg.OTelServiceName = getenv("OTEL_SERVICE_NAME")
+	switch {
+	case cfg.OTLPEndpoint != "":
+		if u, err := url.Parse(cfg.OTLPEndpoint); err != nil || (u.Scheme != "https" && u.Scheme != "http") || u.Host == "" {
+			problems = append(problems, fmt.Sprintf("invalid OTEL_EXPORTER_OTLP_ENDPOINT %q, must be an http(s) URL", cfg.OTLPEndpoint))
+		}
+		if cfg.OTelServiceName == "" {
+			cfg.OTelServiceName = arcmon.DefaultOTelServiceName
+		}
+	case cfg.OTelServiceName != "":
+		problems = append(problems, "OTEL_SERVICE_NAME is set without OTEL_EXPORTER_OTLP_ENDPOINT")
+	}
+	parseBool("VERIFY_DLL", &cfg.VerifyDLL)
+	parseBool("VERIFY_DLL_SIGNATURE", &cfg.VerifySignature)
+	if cfg.VerifySignature && !cfg.VerifyDLL {
+		problems = append(problems, "VERIFY_DLL_SIGNATURE is set without VERIFY_DLL")
+	}
+	parseBool("RETRY_JITTER", &cfg.RetryJitter)
+	var archive bool
+	parseBool("ARCHIVE_HISTORY", &archive)
+	parseBool("STATE_COMPRESS", &cfg.CompressState)
+	if cfg.CompressState {
+		cfg.StateFile += ".gz"
+	}
+
+	if v := getenv("BASELINE_DATE"); v != "" {
+		baseline, err := parseBaseline(v)
+		if err != nil {
+			problems = append(problems, fmt.Sprintf("invalid BASELINE_DATE %q, must be a date like 2024-01-31 or a time like 2024-01-31T12:00:00Z", v))
+		}
+		cfg.Baseline = baseline
+	}
+
+	parseDuration("ANNOUNCE_COOLDOWN", &cfg.AnnounceCooldown, true)
+	parseDuration("SHUTDOWN_TIMEOUT", &cfg.ShutdownTimeout, false)
+	parseDuration("CLOCK_SKEW_THRESHOLD", &cfg.ClockSkewThreshold, false)
+	parseDuration("STARTUP_RETRY_DELAY", &cfg.StartupRetryDelay, true)
+	parseDuration("HOTFIX_WINDOW", &cfg.HotfixWindow, true)
+	parseDuration("ALERT_GRACE_PERIOD", &cfg.AlertGracePeriod, true)
+	// zero and negative intervals are clamped by the server rather than rejected
+	if v := getenv("TICK_INTERVAL"); v != "" {
+		d, err := time.ParseDuration(v)
+		if err != nil {
+			problems = append(problems, fmt.Sprintf("invalid TICK_INTERVAL %q", v))
+		} else {
+			cfg.Interval = d
+		}
+	}
+	interval := cfg.Interval
+	if interval < arcmon.MinTickInterval {
+		interval = arcmon.MinTickInterval
+	}
+	cfg.StaleAfter = arcmon.DefaultStaleMultiplier * interval
+	parseDuration("STALE_AFTER", &cfg.StaleAfter, true)
+	parseDuration("DIGEST_INTERVAL", &cfg.DigestInterval, true)
+	parseDuration("STATUS_WINDOW", &cfg.StatusWindow, false)
+	switch v := strings.ToLower(getenv("HEARTBEAT_AFTER")); v {
+	case "", "off", "false":
+	case "on", "true":
+		cfg.HeartbeatAfter = arcmon.DefaultHeartbeatAfter
+	default:
+		parseDuration("HEARTBEAT_AFTER", &cfg.HeartbeatAfter, true)
+	}
+
+	parseInt := func(key string, dst *int, min int) {
+		v := getenv(key)
+		if v == "" {
+			return
+		}
+		n, err := strconv.Atoi(v)
+		if err != nil || n < min {
+			problems = append(problems, fmt.Sprintf("invalid %s %q, must be at least %d", key, v, min))
+			return
+		}
+		*dst = n
+	}
+	parseInt("STARTUP_RETRIES", &cfg.StartupRetries, 1)
+	// the newer name for STARTUP_RETRIES, alongside the other retry limits
+	if getenv("RETRY_MAX_ATTEMPTS") != "" && getenv("STARTUP_RETRIES") != "" {
+		problems = append(problems, "RETRY_MAX_ATTEMPTS and STARTUP_RETRIES are the same setting, only set one")
+	}
+	parseInt("RETRY_MAX_ATTEMPTS", &cfg.StartupRetries, 1)
+	parseDuration("RETRY_MAX_DELAY", &cfg.RetryMaxDelay, false)
+	parseDuration("RETRY_MAX_ELAPSED", &cfg.RetryMaxElapsed, true)
+	parseInt("HISTORY_SIZE", &cfg.HistorySize, 1)
+	parseInt("UNAVAILABLE_AFTER", &cfg.UnavailableAfter, 1)
+	parseInt("BREAKER_THRESHOLD", &cfg.BreakerThreshold, 0)
+	parseDuration("BREAKER_COOLDOWN", &cfg.BreakerCooldown, false)
+	parseInt("SSE_CLIENT_BUFFER", &cfg.SSEClientBuffer, 1)
+	parseInt("MAX_DLL_SIZE", &cfg.MaxDLLSize, 1)
+
+	switch v := strings.ToLower(getenv("STALE_ACTION")); v {
+	case "":
+	case StaleActionLog, StaleActionAlert, StaleActionExit:
+		cfg.StaleAction = v
+	default:
+		problems = append(problems, fmt.Sprintf("STALE_ACTION must be log, alert or exit, got %q", v))
+	}
+
+	if v := getenv("LOG_LEVEL"); v != "" {
+		level, err := logrus.ParseLevel(v)
+		if err != nil {
+			problems = append(problems, fmt.Sprintf("invalid LOG_LEVEL %q", v))
+		} else {
+			cfg.LogLevel = level
+		}
+	}
+
+	switch v := strings.ToLower(getenv("STARTUP_SELFTEST")); v {
+	case "":
+	case SelfTestOff, SelfTestOn, SelfTestStrict:
+		cfg.SelfTest = v
+	default:
+		problems = append(problems, fmt.Sprintf("STARTUP_SELFTEST must be off, on or strict, got %q", v))
+	}
+
+	switch v := strings.ToLower(getenv("IP_VERSION")); v {
+	case "":
+	case IPVersionAuto, IPVersion4, IPVersion6:
+		cfg.IPVersion = v
+	default:
+		problems = append(problems, fmt.Sprintf("IP_VERSION must be 4, 6 or auto, got %q", v))
+	}
+
+	switch v := strings.ToLower(getenv("STATE_BACKEND")); v {
+	case "":
+	case StateBackendFile, StateBackendSQLite:
+		cfg.StateBackend = v
+	default:
+		problems = append(problems, fmt.Sprintf("STATE_BACKEND must be file or sqlite, got %q", v))
+	}
+	if v := getenv("STATE_DB"); v != "" {
+		cfg.StateDB = v
+	}
+	if archive {
+		cfg.HistoryArchive = filepath.Join(filepath.Dir(cfg.StatePath()), DefaultHistoryArchive)
+	}
+
+	if cfg.StateBackend == StateBackendSQLite {
+		if err := validateParentDir(cfg.StateDB); err != nil {
+			problems = append(problems, fmt.Sprintf("STATE_DB: %v", err))
+		}
+	} else if err := validateParentDir(cfg.StateFile); err != nil {
+		problems = append(problems, fmt.Sprintf("state file: %v", err))
+	}
+	if cfg.EventSocket != "" {
+		if err := validateParentDir(cfg.EventSocket); err != nil {
+			problems = append(problems, fmt.Sprintf("EVENT_SOCKET: %v", err))
+		}
+	}
+
+	if v := getenv("PINNED_CERT_SHA256"); v != "" {
+		pins, err := parsePins(v)
+		if err != nil {
+			problems = append(problems, fmt.Sprintf("PINNED_CERT_SHA256: %v", err))
+		}
+		cfg.PinnedCerts = pins
+	}
+
+	if v := getenv("CA_BUNDLE_FILE"); v != "" {
+		pool, err := loadCABundle(v)
+		if err != nil {
+			problems = append(problems, fmt.Sprintf("CA_BUNDLE_FILE: %v", err))
+		}
+		cfg.RootCAs = pool
+	}
+
+	for _, img := range []struct{ key, url string }{
+		{"EMBED_THUMBNAIL_URL", cfg.ThumbnailURL},
+		{"EMBED_AUTHOR_ICON", cfg.Branding.AuthorIcon},
+	} {
+		if img.url == "" {
+			continue
+		}
+		if u, err := url.Parse(img.url); err != nil || (u.Scheme != "https" && u.Scheme != "http") || u.Host == "" {
+			problems = append(problems, fmt.Sprintf("invalid %s %q, must be an http(s) URL", img.key, img.url))
+		}
+	}
+	if err := cfg.Branding.Validate(); err != nil {
+		problems = append(problems, fmt.Sprintf("invalid EMBED_FOOTER: %v", err))
+	}
+	for _, color := range []struct {
+		key string
+		dst *int
+	}{
+		{"EMBED_COLOR_UPDATE", &cfg.Branding.Colors.Update},
+		{"EMBED_COLOR_FAILURE", &cfg.Branding.Colors.Failure},
+		{"EMBED_COLOR_HEARTBEAT", &cfg.Branding.Colors.Heartbeat},
+		{"EMBED_COLOR_UNAVAILABLE", &cfg.Branding.Colors.Unavailable},
+	} {
+		v := getenv(color.key)
+		if v == "" {
+			continue
+		}
+		c, err := arcmon.ParseColor(v)
+		if err != nil {
+			problems = append(problems, fmt.Sprintf("%s: %v", color.key, err))
+			continue
+		}
+		*color.dst = c
+	}
+
+	if locales, err := loadLocales(getenv("LOCALE_FILE"), getenv("LOCALES")); err != nil {
+		problems = append(problems, err.Error())
+	} else {
+		cfg.Locales = locales
+	}
+
+	if cfg.HealthAddr != "" {
+		if _, _, err := net.SplitHostPort(cfg.HealthAddr); err != nil {
+			problems = append(problems, fmt.Sprintf("invalid HEALTH_ADDR %q: %v", cfg.HealthAddr, err))
+		}
+	}
+	if strings.ContainsAny(cfg.PathPrefix, "?# ") {
+		problems = append(problems, fmt.Sprintf("invalid HTTP_PATH_PREFIX %q, must be a plain path like /arcmon", getenv("HTTP_PATH_PREFIX")))
+	}
+
+	github := arcmon.GitHubConfig{
+		Token:  getenv("GITHUB_TOKEN"),
+		Repo:   getenv("GITHUB_REPO"),
+		File:   getenv("GITHUB_FILE"),
+		Branch: getenv("GITHUB_BRANCH"),
+	}
+	if v := getenv("GITHUB_ISSUE"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n <= 0 {
+			problems = append(problems, fmt.Sprintf("invalid GITHUB_ISSUE %q", v))
+		}
+		github.Issue = n
+	}
+	if github.Enabled() {
+		if err := github.Validate(); err != nil {
+			problems = append(problems, fmt.Sprintf("GitHub notifier: %v", err))
+		}
+		cfg.GitHub = append(cfg.GitHub, github)
+	}
+
+	telegram := arcmon.TelegramConfig{Token: getenv("TELEGRAM_BOT_TOKEN"), ChatID: getenv("TELEGRAM_CHAT_ID")}
+	switch {
+	case telegram.Token == "" && telegram.ChatID == "":
+	case telegram.Token == "":
+		problems = append(problems, "TELEGRAM_CHAT_ID is set without TELEGRAM_BOT_TOKEN")
+	case telegram.ChatID == "":
+		problems = append(problems, "TELEGRAM_BOT_TOKEN is set without TELEGRAM_CHAT_ID")
+	default:
+		cfg.Telegram = append(cfg.Telegram, telegram)
+	}
+
+	if natsURL := getenv("NATS_URL"); natsURL != "" {
+		nc := arcmon.NATSConfig{URL: natsURL, Subject: getenv("NATS_SUBJECT")}
+		if nc.Subject == "" {
+			nc.Subject = arcmon.DefaultNATSSubject
+		}
+		if err := nc.Validate(); err != nil {
+			problems = append(problems, fmt.Sprintf("NATS notifier: %v", err))
+		} else {
+			cfg.NATS = append(cfg.NATS, nc)
+		}
+	} else if getenv("NATS_SUBJECT") != "" {
+		problems = append(problems, "NATS_SUBJECT is set without NATS_URL")
+	}
+
+	var useSyslog bool
+	parseBool("SYSLOG", &useSyslog)
+	if useSyslog {
+		sc := arcmon.SyslogConfig{Tag: getenv("SYSLOG_TAG"), Facility: strings.ToLower(getenv("SYSLOG_FACILITY"))}
+		if sc.Tag == "" {
+			sc.Tag = arcmon.DefaultSyslogTag
+		}
+		if sc.Facility == "" {
+			sc.Facility = arcmon.DefaultSyslogFacility
+		}
+		if err := sc.Validate(); err != nil {
+			problems = append(problems, fmt.Sprintf("syslog notifier: %v", err))
+		} else {
+			cfg.Syslog = append(cfg.Syslog, sc)
+		}
+	} else if getenv("SYSLOG_TAG") != "" || getenv("SYSLOG_FACILITY") != "" {
+		problems = append(problems, "SYSLOG_TAG or SYSLOG_FACILITY is set without SYSLOG")
+	}
+
+	cfg.DuplicateNotifiers = cfg.dedupeNotifiers()
+
+	// otherwise updates are detected and go nowhere
+	if cfg.Destinations() == 0 && fileOK && getenv("DISCORD_WEBHOOK") == "" && !cfg.DryRun {
+		problems = append(problems, "no notifier configured, set DISCORD_WEBHOOK, DISCORD_BOT_TOKEN with DISCORD_CHANNEL_ID, "+
+			"GITHUB_TOKEN with GITHUB_REPO, TELEGRAM_BOT_TOKEN with TELEGRAM_CHAT_ID, NATS_URL, SYSLOG or CONFIG_FILE, or DRY_RUN to only log updates")
+	}
+
+	if len(problems) > 0 {
+		return cfg, problems
+	}
+	return cfg, nil
+}
+
+// dedupeNotifiers drops notifiers posting to a destination already listed,
+// whether in the same env var or across the env and CONFIG_FILE, so nothing is
+// announced twice. Order is preserved and the number dropped returned.
+func (cfg *Config) dedupeNotifiers() int {
+	dropped := 0
+
+	seenURLs := make(map[string]bool)
+	webhooks := cfg.Webhooks[:0]
+	for _, wh := range cfg.Webhooks {
+		if seenURLs[wh.URL] {
+			dropped++
+			continue
+		}
+		seenURLs[wh.URL] = true
+		webhooks = append(webhooks, wh)
+	}
+	cfg.Webhooks = webhooks
+
+	seenBots := make(map[arcmon.DiscordBot]bool)
+	bots := cfg.DiscordBots[:0]
+	for _, bot := range cfg.DiscordBots {
+		key := arcmon.DiscordBot{Token: bot.Token, ChannelID: bot.ChannelID}
+		if seenBots[key] {
+			dropped++
+			continue
+		}
+		seenBots[key] = true
+		bots = append(bots, bot)
+	}
+	cfg.DiscordBots = bots
+
+	seenRepos := make(map[arcmon.GitHubConfig]bool)
+	github := cfg.GitHub[:0]
+	for _, gh := range cfg.GitHub {
+		key := gh
+		key.Events = ""
+		if seenRepos[key] {
+			dropped++
+			continue
+		}
+		seenRepos[key] = true
+		github = append(github, gh)
+	}
+	cfg.GitHub = github
+
+	seenChats := make(map[arcmon.TelegramConfig]bool)
+	telegram := cfg.Telegram[:0]
+	for _, tg := range cfg.Telegram {
+		key := arcmon.TelegramConfig{Token: tg.Token, ChatID: tg.ChatID}
+		if seenChats[key] {
+			dropped++
+			continue
+		}
+		seenChats[key] = true
+		telegram = append(telegram, tg)
+	}
+	cfg.Telegram = telegram
+
+	seenEndpoints := make(map[[2]string]bool)
+	generic := cfg.GenericWebhooks[:0]
+	for _, wh := range cfg.GenericWebhooks {
+		key := [2]string{strings.ToUpper(wh.Method), wh.URL}
+		if key[0] == "" {
+			key[0] = "POST"
+		}
+		if seenEndpoints[key] {
+			dropped++
+			continue
+		}
+		seenEndpoints[key] = true
+		generic = append(generic, wh)
+	}
+	cfg.GenericWebhooks = generic
+
+	seenSubjects := make(map[[2]string]bool)
+	nats := cfg.NATS[:0]
+	for _, nc := range cfg.NATS {
+		key := [2]string{nc.URL, nc.Subject}
+		if seenSubjects[key] {
+			dropped++
+			continue
+		}
+		seenSubjects[key] = true
+		nats = append(nats, nc)
+	}
+	cfg.NATS = nats
+
+	seenTags := make(map[[2]string]bool)
+	syslog := cfg.Syslog[:0]
+	for _, sc := range cfg.Syslog {
+		key := [2]string{sc.Tag, sc.Facility}
+		if seenTags[key] {
+			dropped++
+			continue
+		}
+		seenTags[key] = true
+		syslog = append(syslog, sc)
+	}
+	cfg.Syslog = syslog
+
+	return dropped
+}
+
+// validateChannelID checks that a Discord channel ID is a snowflake
+func validateChannelID(id string) error {
+	if _, err := strconv.ParseUint(id, 10, 64); err != nil {
+		return fmt.Errorf("invalid channel ID %q, must be numeric", id)
+	}
+	return nil
+}
+
+// validateParentDir checks that the directory a file will be created in exists
+func validateParentDir(path string) error {
+	dir := filepath.Dir(path)
+	fi, err := os.Stat(dir)
+	if err != nil {
+		return err
+	}
+	if !fi.IsDir() {
+		return fmt.Errorf("%s is not a directory", dir)
+	}
+	return nil
+}
+
+// parseStatusCodes reads a comma separated list of HTTP error status codes
+func parseStatusCodes(raw string) ([]int, error) {
+	var codes []int
+	for _, entry := range strings.Split(raw, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		code, err := strconv.Atoi(entry)
+		if err != nil || code < 400 || code > 599 {
+			return nil, fmt.Errorf("invalid status code %q, must be between 400 and 599", entry)
+		}
+		codes = append(codes, code)
+	}
+	return codes, nil
+}
+
+// parseHeaders reads "Name: value" pairs separated by |, as commas and
+// semicolons turn up in header values
+func parseHeaders(raw string) (map[string]string, error) {
+	headers := make(map[string]string)
+	for _, entry := range strings.Split(raw, "|") {
+		if strings.TrimSpace(entry) == "" {
+			continue
+		}
+		name, value, ok := strings.Cut(entry, ":")
+		if !ok {
+			return nil, fmt.Errorf("invalid header %q, must be Name: value", strings.TrimSpace(entry))
+		}
+		name, value = strings.TrimSpace(name), strings.TrimSpace(value)
+		if err := arcmon.ValidateHeader(name, value); err != nil {
+			return nil, err
+		}
+		headers[name] = value
+	}
+	return headers, nil
+}
+
+// parseBaseline reads an RFC 3339 time, or a date taken as midnight UTC
+func parseBaseline(v string) (time.Time, error) {
+	if t, err := time.Parse(time.RFC3339, v); err == nil {
+		return t, nil
+	}
+	return time.Parse("2006-01-02", v)
+}
@@ -0,0 +1,71 @@
+package main
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/mythwright/arc-monitor/arcmon"
+)
+
+// env is a getenv backed by a map, with DRY_RUN on so no notifier has to be configured
+func env(vars map[string]string) func(string) string {
+	return func(key string) string {
+		if key == "DRY_RUN" {
+			if _, ok := vars[key]; !ok {
+				return "true"
+			}
+		}
+		return vars[key]
+	}
+}
+
+func TestTickInterval(t *testing.T) {
+	for _, tc := range []struct {
+		raw       string
+		interval  time.Duration
+		staleFrom time.Duration
+	}{
+		// zero and negative are accepted here and raised to the minimum by the server
+		{"0", 0, arcmon.MinTickInterval},
+		{"-5m", -5 * time.Minute, arcmon.MinTickInterval},
+		{"1m", time.Minute, time.Minute},
+		// a year is accepted, the server only warns that it's effectively off
+		{"8760h", 8760 * time.Hour, 8760 * time.Hour},
+	} {
+		cfg, err := LoadConfig(env(map[string]string{"TICK_INTERVAL": tc.raw}))
+		if err != nil {
+			t.Errorf("TICK_INTERVAL=%s: %v", tc.raw, err)
+			continue
+		}
+		if cfg.Interval != tc.interval {
+			t.Errorf("TICK_INTERVAL=%s parsed as %s, want %s", tc.raw, cfg.Interval, tc.interval)
+		}
+		// the watchdog has to go by the interval actually used
+		if want := arcmon.DefaultStaleMultiplier * tc.staleFrom; cfg.StaleAfter != want {
+			t.Errorf("TICK_INTERVAL=%s gave STALE_AFTER %s, want %s", tc.raw, cfg.StaleAfter, want)
+		}
+	}
+}
+
+func TestTickIntervalInvalid(t *testing.T) {
+	_, err := LoadConfig(env(map[string]string{"TICK_INTERVAL": "soon"}))
+	if err == nil || !strings.Contains(err.Error(), "TICK_INTERVAL") {
+		t.Fatalf("LoadConfig() = %v, want an invalid TICK_INTERVAL error", err)
+	}
+}
+
+func TestDiscordWebhookBlank(t *testing.T) {
+	for _, raw := range []string{"   ", ","} {
+		_, err := LoadConfig(env(map[string]string{"DISCORD_WEBHOOK": raw, "DRY_RUN": ""}))
+		if err == nil || !strings.Contains(err.Error(), "DISCORD_WEBHOOK is set but blank") {
+			t.Errorf("DISCORD_WEBHOOK=%q: LoadConfig() = %v, want it reported as set but blank", raw, err)
+		}
+	}
+
+	// unset is a different mistake, with its own message
+	_, err := LoadConfig(env(map[string]string{"DRY_RUN": ""}))
+	if err == nil || strings.Contains(err.Error(), "set but blank") || !strings.Contains(err.Error(), "no notifier configured") {
+		t.Errorf("no DISCORD_WEBHOOK: LoadConfig() = %v, want no notifier configured", err)
+	}
+}
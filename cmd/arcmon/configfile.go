@@ -0,0 +1,169 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/mythwright/arc-monitor/arcmon"
+	"gopkg.in/yaml.v2"
+)
+
+// Notifier types that can be declared in the config file
+const (
+	NotifierDiscord    = "discord"
+	NotifierDiscordBot = "discord-bot"
+	NotifierGitHub     = "github"
+	NotifierTelegram   = "telegram"
+	NotifierWebhook    = "webhook"
+	NotifierNATS       = "nats"
+	NotifierSyslog     = "syslog"
+)
+
+// fileConfig : Layout of CONFIG_FILE
+type fileConfig struct {
+	Notifiers []notifierConfig `yaml:"notifiers"`
+}
+
+// notifierConfig : A single notifier, only the fields its type uses are read
+type notifierConfig struct {
+	Type   string `yaml:"type"`
+	Events string `yaml:"events,omitempty"`
+
+	// discord, webhook and nats
+	URL string `yaml:"url,omitempty"`
+
+	// discord
+	Format string `yaml:"format,omitempty"`
+
+	// webhook
+	Method  string            `yaml:"method,omitempty"`
+	Headers map[string]string `yaml:"headers,omitempty"`
+	Secret  string            `yaml:"secret,omitempty"`
+
+	// discord-bot, github and telegram
+	Token string `yaml:"token,omitempty"`
+
+	// discord-bot
+	ChannelID string `yaml:"channel_id,omitempty"`
+
+	// github
+	Repo   string `yaml:"repo,omitempty"`
+	Issue  int    `yaml:"issue,omitempty"`
+	File   string `yaml:"file,omitempty"`
+	Branch string `yaml:"branch,omitempty"`
+
+	// telegram
+	ChatID string `yaml:"chat_id,omitempty"`
+
+	// nats
+	Subject string `yaml:"subject,omitempty"`
+
+	// syslog
+	Tag      string `yaml:"tag,omitempty"`
+	Facility string `yaml:"facility,omitempty"`
+}
+
+// loadNotifiers reads the notifiers declared in path into cfg, reporting every
+// invalid entry at once
+func (cfg *Config) loadNotifiers(path string) error {
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	var fc fileConfig
+	if err := yaml.UnmarshalStrict(raw, &fc); err != nil {
+		return err
+	}
+
+	var problems []string
+	for i, n := range fc.Notifiers {
+		if err := cfg.addNotifier(n); err != nil {
+			problems = append(problems, fmt.Sprintf("notifiers[%d]: %v", i, err))
+		}
+	}
+	if len(problems) > 0 {
+		return fmt.Errorf("%s", strings.Join(problems, ", "))
+	}
+	return nil
+}
+
+func (cfg *Config) addNotifier(n notifierConfig) error {
+	events, err := arcmon.ParseEventFilter(n.Events)
+	if err != nil {
+		return err
+	}
+
+	switch strings.ToLower(n.Type) {
+	case NotifierDiscord:
+		raw := n.URL
+		if n.Format != "" {
+			raw += "|" + n.Format
+		}
+		webhooks, err := arcmon.ParseWebhooks(raw)
+		if err != nil {
+			return err
+		}
+		if len(webhooks) != 1 {
+			return fmt.Errorf("exactly one url is required")
+		}
+		webhooks[0].Events = events
+		cfg.Webhooks = append(cfg.Webhooks, webhooks[0])
+	case NotifierDiscordBot:
+		if n.Token == "" {
+			return fmt.Errorf("token is required")
+		}
+		if err := validateChannelID(n.ChannelID); err != nil {
+			return err
+		}
+		cfg.DiscordBots = append(cfg.DiscordBots, arcmon.DiscordBot{Token: n.Token, ChannelID: n.ChannelID, Events: events})
+	case NotifierGitHub:
+		gh := arcmon.GitHubConfig{Token: n.Token, Repo: n.Repo, Issue: n.Issue, File: n.File, Branch: n.Branch, Events: events}
+		if gh.Token == "" {
+			return fmt.Errorf("token is required")
+		}
+		if err := gh.Validate(); err != nil {
+			return err
+		}
+		if gh.Issue <= 0 && events == arcmon.EventsFailures {
+			return fmt.Errorf("failures can only be reported to an issue")
+		}
+		cfg.GitHub = append(cfg.GitHub, gh)
+	case NotifierTelegram:
+		if n.Token == "" || n.ChatID == "" {
+			return fmt.Errorf("token and chat_id are required")
+		}
+		cfg.Telegram = append(cfg.Telegram, arcmon.TelegramConfig{Token: n.Token, ChatID: n.ChatID, Events: events})
+	case NotifierWebhook:
+		wh := arcmon.GenericWebhookConfig{URL: n.URL, Method: n.Method, Headers: n.Headers, Secret: n.Secret, Events: events}
+		if err := wh.Validate(); err != nil {
+			return err
+		}
+		cfg.GenericWebhooks = append(cfg.GenericWebhooks, wh)
+	case NotifierNATS:
+		nc := arcmon.NATSConfig{URL: n.URL, Subject: n.Subject, Events: events}
+		if nc.Subject == "" {
+			nc.Subject = arcmon.DefaultNATSSubject
+		}
+		if err := nc.Validate(); err != nil {
+			return err
+		}
+		cfg.NATS = append(cfg.NATS, nc)
+	case NotifierSyslog:
+		sc := arcmon.SyslogConfig{Tag: n.Tag, Facility: strings.ToLower(n.Facility), Events: events}
+		if sc.Tag == "" {
+			sc.Tag = arcmon.DefaultSyslogTag
+		}
+		if sc.Facility == "" {
+			sc.Facility = arcmon.DefaultSyslogFacility
+		}
+		if err := sc.Validate(); err != nil {
+			return err
+		}
+		cfg.Syslog = append(cfg.Syslog, sc)
+	default:
+		return fmt.Errorf("unknown type %q, must be %s, %s, %s, %s, %s, %s or %s",
+			n.Type, NotifierDiscord, NotifierDiscordBot, NotifierGitHub, NotifierTelegram, NotifierWebhook, NotifierNATS, NotifierSyslog)
+	}
+	return nil
+}
@@ -0,0 +1,70 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/mythwright/arc-monitor/arcmon"
+)
+
+// diffLive is the -diff argument standing for the currently published version
+const diffLive = "live"
+
+// loadDiffSide reads one side of -diff: a state file, gzipped if its name ends
+// in .gz, or the published checksum for diffLive. State files are only read,
+// so a running instance's file can be compared without stopping it.
+func loadDiffSide(cfg *Config, side string) (*arcmon.ArcDPSVersion, error) {
+	if side == diffLive {
+		client := &http.Client{Transport: newTransport(cfg), Timeout: 5 * time.Second}
+		s := arcmon.NewServer(arcmon.WithHTTPClient(client), arcmon.WithHashAlgorithm(cfg.HashAlgorithm), arcmon.WithUpstreamHeaders(cfg.UpstreamHeaders))
+		check, err := s.GetChecksumFrom(context.Background(), arcmon.ChecksumURL(cfg.HashAlgorithm))
+		if err != nil {
+			return nil, err
+		}
+		return &arcmon.ArcDPSVersion{CheckSum: check.Checksum, Timestamp: check.LastModified}, nil
+	}
+
+	f, err := os.Open(side)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return loadState(f, strings.HasSuffix(side, ".gz"))
+}
+
+// diffStates compares the versions tracked by a and b, printing both and
+// which is newer. It reports whether they are in sync.
+func diffStates(cfg *Config, a, b string, out io.Writer) (bool, error) {
+	var versions [2]*arcmon.ArcDPSVersion
+	for i, side := range []string{a, b} {
+		v, err := loadDiffSide(cfg, side)
+		if err != nil {
+			return false, fmt.Errorf("%s: %v", side, err)
+		}
+		versions[i] = v
+		if v.CheckSum == "" {
+			fmt.Fprintf(out, "%s: no version tracked\n", side)
+			continue
+		}
+		fmt.Fprintf(out, "%s: %s released %s\n", side, v.CheckSum, v.Timestamp.UTC().Format(time.RFC1123))
+	}
+
+	va, vb := versions[0], versions[1]
+	switch {
+	case strings.EqualFold(va.CheckSum, vb.CheckSum):
+		fmt.Fprintln(out, "in sync")
+		return true, nil
+	case va.Timestamp.After(vb.Timestamp):
+		fmt.Fprintf(out, "checksums differ, %s is newer\n", a)
+	case vb.Timestamp.After(va.Timestamp):
+		fmt.Fprintf(out, "checksums differ, %s is newer\n", b)
+	default:
+		fmt.Fprintln(out, "checksums differ with the same release time")
+	}
+	return false, nil
+}
@@ -0,0 +1,24 @@
+package main
+
+import (
+	"context"
+
+	"github.com/mythwright/arc-monitor/arcmon"
+	"github.com/sirupsen/logrus"
+)
+
+// dryRunNotifier stands in for every notifier with DRY_RUN, logging what would
+// have been announced instead of sending it anywhere
+type dryRunNotifier struct{}
+
+func (dryRunNotifier) Name() string { return "dry-run" }
+
+func (dryRunNotifier) Notify(ctx context.Context, u *arcmon.Update) error {
+	logrus.Infof("dry run, not announcing update: %s released %s", u.Checksum, u.LastModified)
+	return nil
+}
+
+func (dryRunNotifier) NotifyFailure(ctx context.Context, f *arcmon.Failure) error {
+	logrus.Infof("dry run, not announcing failing checks since %s: %s", f.Since, f.Err)
+	return nil
+}
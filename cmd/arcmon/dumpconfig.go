@@ -0,0 +1,109 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"net/url"
+	"path"
+
+	"gopkg.in/yaml.v2"
+)
+
+// redacted stands in for secrets left out of -dump-config
+const redacted = "REDACTED"
+
+// dumpConfig writes every configured notifier to w in the CONFIG_FILE layout,
+// so a setup made of env vars can be moved into a config file. Other settings
+// are left out as CONFIG_FILE can't hold them. Tokens, secrets, header values
+// and the token in webhook URLs are replaced with redacted unless
+// includeSecrets is set.
+func dumpConfig(cfg *Config, includeSecrets bool, w io.Writer) error {
+	secret := func(s string) string {
+		if s == "" || includeSecrets {
+			return s
+		}
+		return redacted
+	}
+	secretURL := func(raw string, tokenInPath bool) string {
+		if includeSecrets {
+			return raw
+		}
+		return redactURL(raw, tokenInPath)
+	}
+
+	var fc fileConfig
+	for _, wh := range cfg.Webhooks {
+		fc.Notifiers = append(fc.Notifiers, notifierConfig{
+			Type: NotifierDiscord, Events: wh.Events, URL: secretURL(wh.URL, true), Format: wh.Format,
+		})
+	}
+	for _, bot := range cfg.DiscordBots {
+		fc.Notifiers = append(fc.Notifiers, notifierConfig{
+			Type: NotifierDiscordBot, Events: bot.Events, Token: secret(bot.Token), ChannelID: bot.ChannelID,
+		})
+	}
+	for _, gh := range cfg.GitHub {
+		fc.Notifiers = append(fc.Notifiers, notifierConfig{
+			Type: NotifierGitHub, Events: gh.Events, Token: secret(gh.Token), Repo: gh.Repo, Issue: gh.Issue, File: gh.File, Branch: gh.Branch,
+		})
+	}
+	for _, tg := range cfg.Telegram {
+		fc.Notifiers = append(fc.Notifiers, notifierConfig{
+			Type: NotifierTelegram, Events: tg.Events, Token: secret(tg.Token), ChatID: tg.ChatID,
+		})
+	}
+	for _, wh := range cfg.GenericWebhooks {
+		n := notifierConfig{
+			Type: NotifierWebhook, Events: wh.Events, URL: secretURL(wh.URL, false), Method: wh.Method, Secret: secret(wh.Secret),
+		}
+		if len(wh.Headers) > 0 {
+			n.Headers = make(map[string]string, len(wh.Headers))
+			for k, v := range wh.Headers {
+				n.Headers[k] = secret(v)
+			}
+		}
+		fc.Notifiers = append(fc.Notifiers, n)
+	}
+	for _, nc := range cfg.NATS {
+		fc.Notifiers = append(fc.Notifiers, notifierConfig{
+			Type: NotifierNATS, Events: nc.Events, URL: secretURL(nc.URL, false), Subject: nc.Subject,
+		})
+	}
+	for _, sc := range cfg.Syslog {
+		fc.Notifiers = append(fc.Notifiers, notifierConfig{
+			Type: NotifierSyslog, Events: sc.Events, Tag: sc.Tag, Facility: sc.Facility,
+		})
+	}
+
+	out, err := yaml.Marshal(fc)
+	if err != nil {
+		return err
+	}
+	fmt.Fprintln(w, "# only notifiers can be declared in CONFIG_FILE, every other setting is still read from the environment")
+	if !includeSecrets {
+		fmt.Fprintf(w, "# secrets are %s, fill them in or rerun with -include-secrets\n", redacted)
+	}
+	_, err = w.Write(out)
+	return err
+}
+
+// redactURL replaces any credentials in raw, and with tokenInPath the last
+// path segment too, which is where Discord puts a webhook's token
+func redactURL(raw string, tokenInPath bool) string {
+	u, err := url.Parse(raw)
+	if err != nil {
+		return redacted
+	}
+	if u.User != nil {
+		if _, ok := u.User.Password(); ok {
+			u.User = url.UserPassword(u.User.Username(), redacted)
+		} else {
+			u.User = url.User(redacted)
+		}
+	}
+	if tokenInPath && path.Base(u.Path) != "/" && path.Base(u.Path) != "." {
+		u.Path = path.Join(path.Dir(u.Path), redacted)
+		u.RawPath = ""
+	}
+	return u.String()
+}
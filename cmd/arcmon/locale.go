@@ -0,0 +1,52 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/mythwright/arc-monitor/arcmon"
+	"gopkg.in/yaml.v2"
+)
+
+// maxLocales is how many embeds Discord accepts in one message
+const maxLocales = 10
+
+// loadLocales resolves the comma separated locale names against the built in
+// English one and any declared in the YAML file at path, keyed by name
+func loadLocales(path, names string) ([]arcmon.Locale, error) {
+	known := map[string]arcmon.Locale{"en": arcmon.DefaultLocale}
+	if path != "" {
+		raw, err := os.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("LOCALE_FILE: %v", err)
+		}
+		var declared map[string]arcmon.Locale
+		if err := yaml.UnmarshalStrict(raw, &declared); err != nil {
+			return nil, fmt.Errorf("LOCALE_FILE: %v", err)
+		}
+		for name, l := range declared {
+			if err := l.Validate(); err != nil {
+				return nil, fmt.Errorf("LOCALE_FILE: %s: invalid plain template: %v", name, err)
+			}
+			known[strings.ToLower(name)] = l
+		}
+	}
+
+	var locales []arcmon.Locale
+	for _, name := range strings.Split(names, ",") {
+		name = strings.ToLower(strings.TrimSpace(name))
+		if name == "" {
+			continue
+		}
+		l, ok := known[name]
+		if !ok {
+			return nil, fmt.Errorf("LOCALES: unknown locale %q, declare it in LOCALE_FILE", name)
+		}
+		locales = append(locales, l)
+	}
+	if len(locales) > maxLocales {
+		return nil, fmt.Errorf("LOCALES: at most %d locales can be announced at once", maxLocales)
+	}
+	return locales, nil
+}
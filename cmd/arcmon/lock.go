@@ -0,0 +1,6 @@
+package main
+
+import "errors"
+
+// errLocked is returned by lockFile when another process already holds the lock
+var errLocked = errors.New("file is locked by another process")
@@ -0,0 +1,29 @@
+//go:build windows
+
+package main
+
+import (
+	"os"
+
+	"golang.org/x/sys/windows"
+)
+
+// Windows locks are mandatory for the locked range, so lock a single byte far
+// past the end of the file rather than the contents other tools may want to read.
+func lockOverlapped() *windows.Overlapped {
+	return &windows.Overlapped{Offset: 0xffffffff, OffsetHigh: 0xffffffff}
+}
+
+// lockFile takes an exclusive lock on f without blocking
+func lockFile(f *os.File) error {
+	err := windows.LockFileEx(windows.Handle(f.Fd()),
+		windows.LOCKFILE_EXCLUSIVE_LOCK|windows.LOCKFILE_FAIL_IMMEDIATELY, 0, 1, 0, lockOverlapped())
+	if err == windows.ERROR_LOCK_VIOLATION {
+		return errLocked
+	}
+	return err
+}
+
+func unlockFile(f *os.File) error {
+	return windows.UnlockFileEx(windows.Handle(f.Fd()), 0, 1, 0, lockOverlapped())
+}
@@ -0,0 +1,49 @@
+package main
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"net/http"
+	"strings"
+
+	"github.com/sirupsen/logrus"
+)
+
+// authorized reports whether r carries token as a bearer token
+func authorized(r *http.Request, token string) bool {
+	got := r.Header.Get("Authorization")
+	if !strings.HasPrefix(got, "Bearer ") {
+		return false
+	}
+	return subtle.ConstantTimeCompare([]byte(strings.TrimPrefix(got, "Bearer ")), []byte(token)) == 1
+}
+
+// logLevelHandler changes the log level at runtime, e.g. POST
+// /loglevel?level=debug. Without a level, or with level=default, it goes back
+// to LOG_LEVEL.
+func logLevelHandler(token string, defaultLevel logrus.Level) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		if !authorized(r, token) {
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		level := defaultLevel
+		if v := r.URL.Query().Get("level"); v != "" && v != "default" {
+			var err error
+			if level, err = logrus.ParseLevel(v); err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+		}
+		logrus.SetLevel(level)
+		logrus.Warnf("log level set to %s", level)
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]string{"level": level.String()})
+	})
+}
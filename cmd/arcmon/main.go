@@ -1,221 +1,437 @@
 package main
 
 import (
-	"bytes"
 	"context"
+	"errors"
+	"flag"
 	"fmt"
-	"io"
-	"net"
 	"net/http"
 	"os"
 	"os/signal"
-	"path/filepath"
 	"strings"
-	"sync"
 	"syscall"
 	"time"
 
+	"github.com/mythwright/arc-monitor/arcmon"
 	"github.com/sirupsen/logrus"
-	"gopkg.in/yaml.v2"
 )
 
-const (
-	ArcDpsURL           = "https://www.deltaconnected.com/arcdps/x64/"
-	ArcDPSCheckSumURL   = ArcDpsURL + "d3d9.dll.md5sum"
-	ArcDPSDLLURL        = ArcDpsURL + "d3d9.dll"
-	DefaultTickDuration = 10 * time.Minute
-)
-
-type ArcDPSVersion struct {
-	Timestamp    time.Time `yaml:"timestamp"`
-	CheckSum     string    `yaml:"check_sum"`
-	sync.RWMutex `yaml:"-"`
-}
+// version is the release being run, set at build time with -ldflags "-X main.version=..."
+var version = "dev"
 
 func main() {
-	if os.Getenv("DISCORD_WEBHOOK") == "" {
-		logrus.Fatalf("missing DISCORD_WEBHOOK env variable")
+	validateConfig := flag.Bool("validate-config", false, "validate the configuration and exit")
+	printPayload := flag.Bool("print-payload", false, "print the notification each webhook would receive for a sample update and exit")
+	reset := flag.Bool("reset", false, "delete the tracking file so the next run seeds cleanly, then exit")
+	force := flag.Bool("force", false, "don't ask for confirmation with -reset")
+	install := flag.Bool("install", false, "install as a Windows service and exit")
+	uninstall := flag.Bool("uninstall", false, "remove the Windows service and exit")
+	start := flag.Bool("start", false, "start the installed Windows service and exit")
+	stopSvc := flag.Bool("stop", false, "stop the running Windows service and exit")
+	once := flag.Bool("once", false, "perform a single check, announcing any update, and exit")
+	checkURL := flag.String("check-url", "", "with -once, fetch and parse the checksum at this URL without touching state or notifying anyone")
+	expect := flag.String("expect", "", "with -once, exit nonzero unless the published checksum is this one, without touching state or notifying anyone")
+	diff := flag.Bool("diff", false, "compare the versions in two state files, or \"live\" for the published one, given as arguments, exiting nonzero unless they match")
+	replayN := flag.Int("replay", 0, "re-send the last N versions in the history, marked as historical, to -replay-to and exit")
+	replayTo := flag.String("replay-to", "", "webhook URL to replay to, or \"all\" for every configured webhook")
+	dump := flag.Bool("dump-config", false, "print the configured notifiers as a CONFIG_FILE and exit, other settings aren't included as they can only be set in the environment")
+	includeSecrets := flag.Bool("include-secrets", false, "with -dump-config, print tokens and secrets rather than redacting them")
+	flag.Parse()
+
+	for _, svcCmd := range []struct {
+		name string
+		set  bool
+	}{{"install", *install}, {"uninstall", *uninstall}, {"start", *start}, {"stop", *stopSvc}} {
+		if !svcCmd.set {
+			continue
+		}
+		if err := controlService(svcCmd.name); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		os.Exit(0)
 	}
 
-	f, err := os.OpenFile(filepath.Join(".", "arcdps.yml"), os.O_RDWR|os.O_CREATE, 0755)
+	asService, err := isWindowsService()
 	if err != nil {
-		if !strings.Contains(err.Error(), "no such") {
-			logrus.Fatalf("err opening tracking file: %v\n", err)
+		logrus.Fatalf("unable to determine if running as a service: (%v)", err)
+	}
+	if asService {
+		// services start in the system directory, keep state next to the binary instead
+		if err := chdirToExecutable(); err != nil {
+			logrus.Fatalf("%v", err)
 		}
 	}
 
-	logrus.Infof("using: %s", f.Name())
+	cfg, err := LoadConfig(os.Getenv)
+	if *expect != "" {
+		if !*once {
+			fmt.Fprintln(os.Stderr, "-expect can only be used with -once")
+			os.Exit(2)
+		}
+		url := *checkURL
+		if url == "" {
+			url = arcmon.ChecksumURL(cfg.HashAlgorithm)
+		}
+		// nothing to announce to, so the notifier settings don't matter
+		if err := expectChecksum(cfg, url, *expect, os.Stdout); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		os.Exit(0)
+	}
+	if *diff {
+		if flag.NArg() != 2 {
+			fmt.Fprintln(os.Stderr, "-diff takes two state files, or \"live\" for the published version")
+			os.Exit(2)
+		}
+		// only the transport settings are used, so don't require any notifiers
+		inSync, err := diffStates(cfg, flag.Arg(0), flag.Arg(1), os.Stdout)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(2)
+		}
+		if !inSync {
+			os.Exit(1)
+		}
+		os.Exit(0)
+	}
+	if *checkURL != "" {
+		if !*once {
+			fmt.Fprintln(os.Stderr, "-check-url can only be used with -once")
+			os.Exit(2)
+		}
+		// nothing to announce to, so the notifier settings don't matter
+		if err := printChecksum(cfg, *checkURL, os.Stdout); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		os.Exit(0)
+	}
+	if *reset {
+		// the state file location doesn't depend on anything that can fail validation
+		if err := resetState(cfg.StatePath(), *force, os.Stdin, os.Stdout); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		os.Exit(0)
+	}
+	if *replayN > 0 {
+		if err != nil {
+			logrus.Fatalf("%v", err)
+		}
+		if err := replay(cfg, *replayN, *replayTo); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		os.Exit(0)
+	}
+	if *dump {
+		if err != nil {
+			logrus.Fatalf("%v", err)
+		}
+		if err := dumpConfig(cfg, *includeSecrets, os.Stdout); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		os.Exit(0)
+	}
+	if *validateConfig {
+		if err != nil {
+			var problems ConfigError
+			if !errors.As(err, &problems) {
+				problems = ConfigError{err.Error()}
+			}
+			for _, problem := range problems {
+				fmt.Fprintln(os.Stderr, problem)
+			}
+			os.Exit(1)
+		}
+		if !*printPayload {
+			fmt.Println("configuration OK")
+			os.Exit(0)
+		}
+	}
+	if *printPayload {
+		if err != nil {
+			logrus.Fatalf("%v", err)
+		}
+		if err := printSamplePayloads(cfg, os.Stdout); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		os.Exit(0)
+	}
+	if err != nil {
+		logrus.Fatalf("%v", err)
+	}
+	logrus.SetLevel(cfg.LogLevel)
 
-	arcdps := &ArcDPSVersion{}
-	if err := yaml.NewDecoder(f).Decode(&arcdps); err != nil && err != io.EOF {
-		logrus.Fatalf("unable to decode arcdps.yml: %v", err)
+	if *once {
+		os.Exit(runOnce(cfg))
 	}
 
-	s := NewServer(arcdps)
-	ctx, cncl := context.WithCancel(context.Background())
-	go s.Tick(ctx)
-	sig := make(chan os.Signal, 1)
-	signal.Notify(sig, syscall.SIGTERM, syscall.SIGKILL, os.Interrupt)
-	<-sig
-	cncl()
-	logrus.Infof("shutting down")
-	f.Seek(0, 0) //rewind file descriptor
-	if err := yaml.NewEncoder(f).Encode(arcdps); err != nil {
-		logrus.Fatalf("unable to save file: (%v)", err)
+	if asService {
+		if err := runService(cfg); err != nil {
+			logrus.Fatalf("service failed: (%v)", err)
+		}
+		return
 	}
-	f.Close()
-}
 
-type Server struct {
-	http       *http.Client
-	webhookURL string
-	arcdps     *ArcDPSVersion
+	// registered before run does anything, so a signal during startup still
+	// goes through the shutdown below rather than killing the process
+	os.Exit(run(cfg, stopOnSignal()))
 }
 
-func NewServer(arcdps *ArcDPSVersion) *Server {
-	return &Server{
-		http: &http.Client{
-			Transport: &http.Transport{
-				DialContext: (&net.Dialer{Timeout: 5 * time.Second}).DialContext,
-			},
-			Timeout: 5 * time.Second,
-		},
-		webhookURL: os.Getenv("DISCORD_WEBHOOK"),
-		arcdps:     arcdps,
-	}
+// stopOnSignal returns a channel closed on the first interrupt or termination signal
+func stopOnSignal() <-chan struct{} {
+	sig := make(chan os.Signal, 1)
+	signal.Notify(sig, syscall.SIGTERM, syscall.SIGKILL, os.Interrupt)
+	stop := make(chan struct{})
+	go func() {
+		<-sig
+		close(stop)
+	}()
+	return stop
 }
 
-func (s *Server) Tick(ctx context.Context) {
-	ticker := time.NewTicker(DefaultTickDuration)
-	logrus.Infof("Starting Check Ticker")
-	for {
+// run starts the monitor and blocks until stop is closed, then shuts down and
+// returns the process exit code. Closing stop while still starting up skips
+// the rest of startup, but the state is still saved.
+func run(cfg *Config, stop <-chan struct{}) int {
+	ctx, cncl := context.WithCancel(context.Background())
+	defer cncl()
+	go func() {
 		select {
-		case <-ticker.C:
-			check, err := s.GetChecksum(ctx)
-			if err != nil {
-				logrus.Errorf("Failed getting checksum: (%v)", err)
-				continue
-			}
-			if s.arcdps.CheckSum == "" {
-				logrus.Infof("Setting initial version")
-				s.arcdps.CheckSum = check.Checksum
-				s.arcdps.Timestamp = check.LastModified
-				continue
-			}
-			if s.arcdps.CheckSum != check.Checksum {
-				// new version
-				if err := s.SendWebHook(ctx,
-					fmt.Sprintf("`%s`", check.Checksum),
-					fmt.Sprintf("`%s`", check.LastModified.String()),
-				); err != nil {
-					logrus.Errorf("unable to send webhook: (%v)\n", err)
-				}
-				s.arcdps.CheckSum = check.Checksum
-				s.arcdps.Timestamp = check.LastModified
-			}
+		case <-stop:
+			cncl()
 		case <-ctx.Done():
-			ticker.Stop()
-			return
 		}
-	}
-}
+	}()
 
-// Checksum : Used to compare local cache to remote
-type Checksum struct {
-	Checksum     string
-	LastModified time.Time
-}
+	store, arcdps := openStore(cfg)
 
-func (s *Server) GetChecksum(ctx context.Context) (*Checksum, error) {
-	req, err := http.NewRequestWithContext(ctx, "GET", ArcDPSCheckSumURL, nil)
-	if err != nil {
-		return nil, err
+	if cfg.DuplicateNotifiers > 0 {
+		logrus.Warnf("ignoring %d duplicate notifier destinations", cfg.DuplicateNotifiers)
 	}
+	logrus.Infof("announcing to %d unique destinations", cfg.Destinations())
 
-	resp, err := s.http.Do(req)
-	if err != nil {
-		return nil, err
+	client := &http.Client{Transport: newTransport(cfg), Timeout: 5 * time.Second}
+	if cfg.IPVersion != IPVersionAuto {
+		logrus.Infof("restricting connections to IPv%s", cfg.IPVersion)
 	}
-	defer resp.Body.Close()
-
-	body, err := io.ReadAll(resp.Body)
-	if err != nil {
-		return nil, err
+	if cfg.ForceHTTP1 {
+		logrus.Infof("forcing HTTP/1.1 for every connection")
 	}
 
-	if resp.StatusCode > 299 {
-		return nil, fmt.Errorf("bad response from delta: (%s)", string(body))
+	if cfg.SelfTest != SelfTestOff {
+		failed := selfTest(ctx, client, selfTestProbes(cfg))
+		if failed > 0 && cfg.SelfTest == SelfTestStrict && ctx.Err() == nil {
+			logrus.Errorf("self-test failed for %d destinations, exiting", failed)
+			store.Close()
+			return 1
+		}
 	}
 
-	lastModified, err := time.Parse(time.RFC1123, resp.Header.Get("Last-Modified"))
+	s, events, err := newServer(cfg, arcdps, store, client)
 	if err != nil {
-		return nil, fmt.Errorf("unable to parse time: (%v)", err)
+		logrus.Fatalf("%v", err)
 	}
 
-	checkSumSplit := strings.Split(string(body), " ")
-	if len(checkSumSplit) < 2 {
-		return nil, fmt.Errorf("incorrect size of checksum split")
+	var health *http.Server
+	if cfg.HealthAddr != "" {
+		health, err = s.ListenHealth(cfg.HealthAddr)
+		if err != nil {
+			logrus.Fatalf("unable to start health server: (%v)", err)
+		}
+		logrus.Infof("serving health endpoints on: %s%s", cfg.HealthAddr, cfg.PathPrefix)
 	}
 
-	return &Checksum{Checksum: checkSumSplit[0], LastModified: lastModified}, nil
-}
+	tickDone := make(chan struct{})
+	go func() {
+		defer close(tickDone)
+		if ctx.Err() != nil {
+			// stopped before getting this far, don't start checking only to cancel it
+			return
+		}
+		s.Tick(ctx)
+	}()
+	<-ctx.Done()
+	logrus.Infof("shutting down")
+	// whatever ended the wait, the tick must be told to stop before it's waited on
+	cncl()
 
-func (s *Server) SendWebHook(ctx context.Context, checksum, time string) error {
-	payload := bytes.NewBufferString(fmt.Sprintf(PayloadJSON, checksum, time, DefaultTickDuration.String()))
-	req, err := http.NewRequestWithContext(ctx, "POST", s.webhookURL, payload)
-	if err != nil {
-		return err
+	shutdownCtx, shutdownCncl := context.WithTimeout(context.Background(), cfg.ShutdownTimeout)
+	defer shutdownCncl()
+	unfinished, saveErr := shutdownAndSave(shutdownCtx, []shutdownStep{
+		{name: "stop ticker", run: func(ctx context.Context) error {
+			select {
+			case <-tickDone:
+				return nil
+			case <-ctx.Done():
+				return ctx.Err()
+			}
+		}},
+		{name: "stop health server", run: func(ctx context.Context) error {
+			if health == nil {
+				return nil
+			}
+			return health.Shutdown(ctx)
+		}},
+		{name: "close event socket", run: func(ctx context.Context) error {
+			return events.Close()
+		}},
+		{name: "close notifiers", run: s.CloseNotifiers},
+	}, store, arcdps)
+	if len(unfinished) > 0 {
+		logrus.Errorf("shutdown timed out after %s, did not finish: %s", cfg.ShutdownTimeout, strings.Join(unfinished, ", "))
+		return 1
 	}
-
-	req.Header.Set("Content-Type", "application/json")
-
-	resp, err := s.http.Do(req)
-	if err != nil {
-		return err
+	if saveErr != nil {
+		return 1
 	}
-	defer resp.Body.Close()
+	return 0
+}
 
-	if resp.StatusCode > 299 {
-		body, err := io.ReadAll(resp.Body)
+// newServer builds the monitor described by cfg. The event socket is returned
+// too, if one is configured, so that it can be closed on shutdown.
+func newServer(cfg *Config, arcdps *arcmon.ArcDPSVersion, store arcmon.Store, client *http.Client) (*arcmon.Server, *arcmon.EventSocket, error) {
+	opts := []arcmon.Option{
+		arcmon.WithState(arcdps),
+		arcmon.WithInterval(cfg.Interval),
+		arcmon.WithHTTPClient(client),
+		arcmon.WithHashAlgorithm(cfg.HashAlgorithm),
+		arcmon.WithUpstreamHeaders(cfg.UpstreamHeaders),
+		arcmon.WithStore(store),
+		arcmon.WithAnnounceCooldown(cfg.AnnounceCooldown),
+		arcmon.WithClockSkewThreshold(cfg.ClockSkewThreshold),
+		arcmon.WithStartupRetries(cfg.StartupRetries, cfg.StartupRetryDelay),
+		arcmon.WithRetryJitter(cfg.RetryJitter),
+		arcmon.WithHTTPTrace(cfg.HTTPTrace),
+		arcmon.WithOTLPTraces(cfg.OTLPEndpoint, cfg.OTelServiceName),
+		arcmon.WithRetryLimits(cfg.RetryMaxDelay, cfg.RetryMaxElapsed),
+		arcmon.WithRetryableStatus(cfg.RetryableStatus...),
+		arcmon.WithHistorySize(cfg.HistorySize),
+		arcmon.WithHistoryArchive(cfg.HistoryArchive),
+		arcmon.WithThumbnail(cfg.ThumbnailURL),
+		arcmon.WithBranding(cfg.Branding),
+		arcmon.WithNotifyOnSeed(cfg.NotifyOnSeed),
+		arcmon.WithBaseline(cfg.Baseline),
+		arcmon.WithPreviousChecksum(cfg.ShowPrevious),
+		arcmon.WithInlineFields(cfg.InlineFields),
+		arcmon.WithEmbedTimestamp(cfg.EmbedTimestamp),
+		arcmon.WithEmbedContent(cfg.EmbedContent),
+		arcmon.WithAutoDisableDeadWebhooks(cfg.DisableDeadWebhooks),
+		arcmon.WithUnavailableAfter(cfg.UnavailableAfter),
+		arcmon.WithAlertGracePeriod(cfg.AlertGracePeriod),
+		arcmon.WithCircuitBreaker(cfg.BreakerThreshold, cfg.BreakerCooldown),
+		arcmon.WithSSEClientBuffer(cfg.SSEClientBuffer),
+		arcmon.WithStatusWindow(cfg.StatusWindow),
+		arcmon.WithLocales(cfg.Locales...),
+		arcmon.WithDirectoryWatch(cfg.WatchDirectory),
+		arcmon.WithHotfixWindow(cfg.HotfixWindow),
+	}
+	if cfg.StaleAfter > 0 {
+		var onStale func()
+		if cfg.StaleAction == StaleActionExit {
+			onStale = func() {
+				// state is saved as it changes, so there is nothing to lose by exiting here
+				logrus.Errorf("exiting so the monitor can be restarted")
+				os.Exit(1)
+			}
+		}
+		opts = append(opts, arcmon.WithWatchdog(cfg.StaleAfter, cfg.StaleAction == StaleActionAlert, onStale))
+	}
+	if cfg.Forum {
+		opts = append(opts, arcmon.WithForumPosts(cfg.ForumThreadName))
+	}
+	if cfg.NotifySelfUpgrade {
+		opts = append(opts, arcmon.WithSelfUpgradeNotice(version))
+	}
+	if cfg.DigestInterval > 0 {
+		opts = append(opts, arcmon.WithDigest(cfg.DigestInterval))
+	}
+	if cfg.HeartbeatAfter > 0 {
+		opts = append(opts, arcmon.WithHeartbeat(cfg.HeartbeatAfter))
+	}
+	if cfg.PathPrefix != "" {
+		opts = append(opts, arcmon.WithPathPrefix(cfg.PathPrefix))
+	}
+	if cfg.AdminToken != "" {
+		opts = append(opts, arcmon.WithRoute("/loglevel", logLevelHandler(cfg.AdminToken, cfg.LogLevel)))
+		if store != nil {
+			opts = append(opts, arcmon.WithRoute("/save", saveHandler(cfg.AdminToken, store, arcdps)))
+		}
+	}
+	if db, ok := store.(*sqliteStore); ok {
+		opts = append(opts, arcmon.WithRoute("/versions", http.HandlerFunc(db.handleVersions)))
+	}
+	if cfg.VerifyDLL {
+		opts = append(opts, arcmon.WithDLLVerification(int64(cfg.MaxDLLSize)), arcmon.WithSignatureCheck(cfg.VerifySignature))
+	}
+	if cfg.DryRun {
+		logrus.Warnf("dry run, updates are logged instead of announced")
+		opts = append(opts, arcmon.WithFilteredNotifier(arcmon.EventsAll, dryRunNotifier{}))
+	} else {
+		notifiers, err := notifierOptions(cfg, client)
 		if err != nil {
-			return err
+			return nil, nil, err
 		}
-		return fmt.Errorf("bad response from Discord: %d (%s)", resp.StatusCode, string(body))
+		opts = append(opts, notifiers...)
 	}
-	return nil
+	var events *arcmon.EventSocket
+	if cfg.EventSocket != "" {
+		var err error
+		events, err = arcmon.NewEventSocket(cfg.EventSocket)
+		if err != nil {
+			return nil, nil, fmt.Errorf("unable to create event socket: (%v)", err)
+		}
+		logrus.Infof("publishing events to: %s", cfg.EventSocket)
+		opts = append(opts, arcmon.WithEventSocket(events))
+	}
+	return arcmon.NewServer(opts...), events, nil
 }
 
-var (
-	PayloadJSON = `
-{
-  "embeds": [
-    {
-      "title": "ArcDPS has updated!",
-      "color": 12124160,
-      "fields": [
-        {
-          "name": "Checksum",
-          "value": "%s",
-          "inline": true
-        },
-        {
-          "name": "Timestamp Version",
-          "value": "%s",
-          "inline": true
-        },
-        {
-          "name": "Direct Download Link",
-          "value": "https://www.deltaconnected.com/arcdps/x64/d3d9.dll"
-        }
-      ],
-      "author": {
-        "name": "ArcDPS Monitor",
-        "icon_url": "https://wiki.guildwars2.com/images/0/03/Specter_icon_(highres).png"
-      },
-      "footer": {
-        "text": "This bot checks every %s"
-      }
-    }
-  ]
-}`
-)
+// notifierOptions configures every notifier in cfg
+func notifierOptions(cfg *Config, client *http.Client) ([]arcmon.Option, error) {
+	opts := []arcmon.Option{
+		arcmon.WithWebhook(cfg.Webhooks...),
+		arcmon.WithDiscordBot(cfg.DiscordBots...),
+	}
+	for _, ghCfg := range cfg.GitHub {
+		gh, err := arcmon.NewGitHubNotifier(client, ghCfg)
+		if err != nil {
+			return nil, fmt.Errorf("unable to configure GitHub notifier: (%v)", err)
+		}
+		opts = append(opts, arcmon.WithFilteredNotifier(ghCfg.Events, gh))
+	}
+	for _, tgCfg := range cfg.Telegram {
+		tg, err := arcmon.NewTelegramNotifier(client, tgCfg)
+		if err != nil {
+			return nil, fmt.Errorf("unable to configure Telegram notifier: (%v)", err)
+		}
+		opts = append(opts, arcmon.WithFilteredNotifier(tgCfg.Events, tg))
+	}
+	for _, whCfg := range cfg.GenericWebhooks {
+		wh, err := arcmon.NewGenericWebhookNotifier(client, whCfg)
+		if err != nil {
+			return nil, fmt.Errorf("unable to configure webhook notifier: (%v)", err)
+		}
+		opts = append(opts, arcmon.WithFilteredNotifier(whCfg.Events, wh))
+	}
+	for _, natsCfg := range cfg.NATS {
+		nc, err := arcmon.NewNATSNotifier(natsCfg)
+		if err != nil {
+			return nil, fmt.Errorf("unable to configure NATS notifier: (%v)", err)
+		}
+		opts = append(opts, arcmon.WithFilteredNotifier(natsCfg.Events, nc))
+	}
+	for _, sysCfg := range cfg.Syslog {
+		sl, err := arcmon.NewSyslogNotifier(sysCfg)
+		if err != nil {
+			return nil, fmt.Errorf("unable to configure syslog notifier: (%v)", err)
+		}
+		opts = append(opts, arcmon.WithFilteredNotifier(sysCfg.Events, sl))
+	}
+	return opts, nil
+}
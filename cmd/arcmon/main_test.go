@@ -0,0 +1,78 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"syscall"
+	"testing"
+	"time"
+)
+
+// inTempDir runs the test from a temporary directory, where run keeps its state file
+func inTempDir(t *testing.T) string {
+	t.Helper()
+	dir := t.TempDir()
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chdir(dir); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.Chdir(wd) })
+	return dir
+}
+
+// runStopped runs the monitor with stop and waits for it to exit
+func runStopped(t *testing.T, stop <-chan struct{}) int {
+	t.Helper()
+	cfg, err := LoadConfig(env(map[string]string{}))
+	if err != nil {
+		t.Fatalf("LoadConfig() = %v", err)
+	}
+	done := make(chan int, 1)
+	go func() { done <- run(cfg, stop) }()
+	select {
+	case code := <-done:
+		return code
+	case <-time.After(10 * time.Second):
+		t.Fatalf("still running after being stopped")
+		return 0
+	}
+}
+
+func TestRunStoppedDuringStartup(t *testing.T) {
+	dir := inTempDir(t)
+	stop := make(chan struct{})
+	close(stop)
+
+	if code := runStopped(t, stop); code != 0 {
+		t.Fatalf("run() = %d when stopped during startup, want 0", code)
+	}
+	// shut down the usual way, so the state was still saved
+	if _, err := os.Stat(filepath.Join(dir, DefaultStateFile)); err != nil {
+		t.Fatalf("no state file after an early stop: %v", err)
+	}
+}
+
+func TestRunStopsOnEarlySignal(t *testing.T) {
+	p, err := os.FindProcess(os.Getpid())
+	if err != nil {
+		t.Skipf("unable to find this process: %v", err)
+	}
+	inTempDir(t)
+	stop := stopOnSignal()
+	// arrives before run has started
+	if err := p.Signal(syscall.SIGTERM); err != nil {
+		t.Skipf("unable to signal this process: %v", err)
+	}
+	select {
+	case <-stop:
+	case <-time.After(5 * time.Second):
+		t.Fatalf("SIGTERM didn't close the stop channel")
+	}
+
+	if code := runStopped(t, stop); code != 0 {
+		t.Fatalf("run() = %d after an early SIGTERM, want 0", code)
+	}
+}
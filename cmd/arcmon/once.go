@@ -0,0 +1,73 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/mythwright/arc-monitor/arcmon"
+	"github.com/sirupsen/logrus"
+)
+
+// runOnce performs a single check against the configured state and returns
+// the process exit code
+func runOnce(cfg *Config) int {
+	store, arcdps := openStore(cfg)
+	defer store.Close()
+
+	client := &http.Client{Transport: newTransport(cfg), Timeout: 5 * time.Second}
+	s, events, err := newServer(cfg, arcdps, store, client)
+	if err != nil {
+		logrus.Errorf("%v", err)
+		return 1
+	}
+	defer events.Close()
+
+	err = s.CheckOnce(context.Background())
+	// delivers anything a notifier is still holding, such as NATS events
+	closeCtx, cncl := context.WithTimeout(context.Background(), cfg.ShutdownTimeout)
+	defer cncl()
+	if cerr := s.CloseNotifiers(closeCtx); cerr != nil {
+		logrus.Errorf("%v", cerr)
+	}
+	if err != nil {
+		logrus.Errorf("Failed getting checksum: (%v)", err)
+		return 1
+	}
+	return 0
+}
+
+// expectChecksum fetches the checksum file at url and fails unless it matches
+// expected, printing both either way
+func expectChecksum(cfg *Config, url, expected string, out io.Writer) error {
+	client := &http.Client{Transport: newTransport(cfg), Timeout: 5 * time.Second}
+	s := arcmon.NewServer(arcmon.WithHTTPClient(client), arcmon.WithHashAlgorithm(cfg.HashAlgorithm), arcmon.WithUpstreamHeaders(cfg.UpstreamHeaders))
+
+	check, err := s.GetChecksumFrom(context.Background(), url)
+	if err != nil {
+		return err
+	}
+	expected = strings.TrimSpace(expected)
+	fmt.Fprintf(out, "expected:  %s\npublished: %s\n", expected, check.Checksum)
+	if !strings.EqualFold(check.Checksum, expected) {
+		return fmt.Errorf("published checksum %s doesn't match the expected %s", check.Checksum, expected)
+	}
+	return nil
+}
+
+// printChecksum fetches the checksum file at url and prints what the parser
+// makes of it
+func printChecksum(cfg *Config, url string, out io.Writer) error {
+	client := &http.Client{Transport: newTransport(cfg), Timeout: 5 * time.Second}
+	s := arcmon.NewServer(arcmon.WithHTTPClient(client), arcmon.WithHashAlgorithm(cfg.HashAlgorithm), arcmon.WithUpstreamHeaders(cfg.UpstreamHeaders))
+
+	check, err := s.GetChecksumFrom(context.Background(), url)
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(out, "checksum:      %s\nlast-modified: %s\n", check.Checksum, check.LastModified.UTC().Format(time.RFC1123))
+	return nil
+}
@@ -0,0 +1,52 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/mythwright/arc-monitor/arcmon"
+)
+
+// sampleChecksum and samplePrevious stand in for real releases when previewing payloads
+const (
+	sampleChecksum = "0123456789abcdef0123456789abcdef"
+	samplePrevious = "fedcba9876543210fedcba9876543210"
+)
+
+// printSamplePayloads renders a sample update for every configured webhook
+// exactly as it would be posted, pretty printed to out
+func printSamplePayloads(cfg *Config, out io.Writer) error {
+	// nothing is sent, but don't create the event socket either
+	preview := *cfg
+	preview.EventSocket = ""
+	s, _, err := newServer(&preview, &arcmon.ArcDPSVersion{}, nil, http.DefaultClient)
+	if err != nil {
+		return err
+	}
+
+	now := time.Now()
+	u := &arcmon.Update{
+		Checksum:     sampleChecksum,
+		LastModified: now.Add(-time.Minute).UTC().Truncate(time.Second),
+		DetectedAt:   now,
+		Previous:     samplePrevious,
+		DownloadURL:  arcmon.ArcDPSDLLURL,
+	}
+	for i, wh := range cfg.Webhooks {
+		payload, err := s.RenderWebhook(wh, u)
+		if err != nil {
+			return fmt.Errorf("unable to render payload for webhook %d: (%v)", i+1, err)
+		}
+		var pretty bytes.Buffer
+		if err := json.Indent(&pretty, payload, "", "  "); err != nil {
+			return err
+		}
+		// webhook URLs embed their token, keep them out of output that gets pasted around
+		fmt.Fprintf(out, "# webhook %d (%s)\n%s\n", i+1, wh.Format, pretty.String())
+	}
+	return nil
+}
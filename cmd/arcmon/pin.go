@@ -0,0 +1,76 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"crypto/tls"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"net/url"
+	"strings"
+
+	"github.com/mythwright/arc-monitor/arcmon"
+)
+
+// parsePins parses a comma separated list of SPKI SHA-256 hashes, each either
+// hex or base64 encoded as in `openssl ... | openssl dgst -sha256 -binary | base64`
+func parsePins(raw string) ([][]byte, error) {
+	var pins [][]byte
+	for _, p := range strings.Split(raw, ",") {
+		p = strings.TrimSpace(p)
+		if p == "" {
+			continue
+		}
+		pin, err := hex.DecodeString(strings.ReplaceAll(p, ":", ""))
+		if err != nil {
+			pin, err = base64.StdEncoding.DecodeString(p)
+		}
+		if err != nil || len(pin) != sha256.Size {
+			return nil, fmt.Errorf("%q is not a hex or base64 SHA-256 hash", p)
+		}
+		if containsPin(pins, pin) {
+			continue
+		}
+		pins = append(pins, pin)
+	}
+	return pins, nil
+}
+
+func containsPin(pins [][]byte, pin []byte) bool {
+	for _, p := range pins {
+		if bytes.Equal(p, pin) {
+			return true
+		}
+	}
+	return false
+}
+
+// pinnedHost is the only host pins are enforced for, so Discord and the other
+// notifiers sharing the transport are unaffected
+func pinnedHost() string {
+	u, _ := url.Parse(arcmon.ArcDpsURL)
+	return u.Hostname()
+}
+
+// verifyPins rejects connections to host whose leaf certificate's public key
+// doesn't hash to one of pins. It runs after the usual chain verification, so
+// pinning only ever narrows what is trusted.
+func verifyPins(host string, pins [][]byte) func(tls.ConnectionState) error {
+	return func(cs tls.ConnectionState) error {
+		if !strings.EqualFold(cs.ServerName, host) {
+			return nil
+		}
+		if len(cs.PeerCertificates) == 0 {
+			return fmt.Errorf("no certificate presented by %s", host)
+		}
+		sum := sha256.Sum256(cs.PeerCertificates[0].RawSubjectPublicKeyInfo)
+		for _, pin := range pins {
+			if bytes.Equal(sum[:], pin) {
+				return nil
+			}
+		}
+		return fmt.Errorf("certificate for %s doesn't match any pinned key, got %s",
+			host, base64.StdEncoding.EncodeToString(sum[:]))
+	}
+}
@@ -0,0 +1,68 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/mythwright/arc-monitor/arcmon"
+)
+
+// replayToAll is the -replay-to value that replays to every configured webhook
+const replayToAll = "all"
+
+// replayTargets resolves -replay-to. Replaying to every configured webhook has
+// to be asked for with "all", otherwise to is a single webhook, which need not
+// be configured yet, optionally suffixed with |plain like DISCORD_WEBHOOK.
+func replayTargets(cfg *Config, to string) ([]arcmon.Webhook, error) {
+	switch to {
+	case "":
+		return nil, fmt.Errorf("-replay needs -replay-to, a webhook URL or %q for every configured webhook", replayToAll)
+	case replayToAll:
+		if len(cfg.Webhooks) == 0 {
+			return nil, fmt.Errorf("no webhooks configured to replay to")
+		}
+		return cfg.Webhooks, nil
+	}
+	webhooks, err := arcmon.ParseWebhooks(to)
+	if err != nil {
+		return nil, fmt.Errorf("-replay-to: %v", err)
+	}
+	if len(webhooks) != 1 {
+		return nil, fmt.Errorf("-replay-to takes a single webhook, use %q for every configured one", replayToAll)
+	}
+	return webhooks, nil
+}
+
+// replay re-sends the last n versions in the stored history to the webhooks
+// named by to, marked as historical, without changing the state
+func replay(cfg *Config, n int, to string) error {
+	webhooks, err := replayTargets(cfg, to)
+	if err != nil {
+		return err
+	}
+
+	store, arcdps := openStore(cfg)
+	defer store.Close()
+
+	client := &http.Client{Transport: newTransport(cfg), Timeout: 5 * time.Second}
+	opts := []arcmon.Option{
+		arcmon.WithState(arcdps),
+		arcmon.WithHTTPClient(client),
+		arcmon.WithInterval(cfg.Interval),
+		arcmon.WithThumbnail(cfg.ThumbnailURL),
+		arcmon.WithBranding(cfg.Branding),
+		arcmon.WithPreviousChecksum(cfg.ShowPrevious),
+		arcmon.WithInlineFields(cfg.InlineFields),
+		arcmon.WithEmbedTimestamp(cfg.EmbedTimestamp),
+		arcmon.WithEmbedContent(cfg.EmbedContent),
+		arcmon.WithLocales(cfg.Locales...),
+		arcmon.WithHotfixWindow(cfg.HotfixWindow),
+	}
+	if cfg.Forum {
+		opts = append(opts, arcmon.WithForumPosts(cfg.ForumThreadName))
+	}
+	s := arcmon.NewServer(opts...)
+	return s.Replay(context.Background(), n, webhooks)
+}
@@ -0,0 +1,58 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+)
+
+var errResetAborted = errors.New("reset aborted")
+
+// resetState deletes the state file so the next run seeds from scratch. Unless
+// force is set the user has to confirm on in first.
+func resetState(path string, force bool, in io.Reader, out io.Writer) error {
+	if err := ensureUnlocked(path); err != nil {
+		if os.IsNotExist(err) {
+			fmt.Fprintf(out, "%s does not exist, nothing to reset\n", path)
+			return nil
+		}
+		return err
+	}
+
+	if !force {
+		fmt.Fprintf(out, "Delete %s and forget the tracked version? [y/N]: ", path)
+		answer, err := bufio.NewReader(in).ReadString('\n')
+		if err != nil && err != io.EOF {
+			return err
+		}
+		if a := strings.ToLower(strings.TrimSpace(answer)); a != "y" && a != "yes" {
+			return errResetAborted
+		}
+	}
+
+	if err := os.Remove(path); err != nil {
+		return err
+	}
+	fmt.Fprintf(out, "removed %s, the next run will seed the current version\n", path)
+	return nil
+}
+
+// ensureUnlocked fails if path doesn't exist or a running monitor holds its
+// lock file. The lock is released straight away, it's only taken to check.
+func ensureUnlocked(path string) error {
+	if _, err := os.Stat(path); err != nil {
+		return err
+	}
+	lock, err := openLock(path)
+	if err != nil {
+		if err == errLocked {
+			return fmt.Errorf("another instance is running against %s, stop it before resetting", path)
+		}
+		return err
+	}
+	defer lock.Close()
+	return unlockFile(lock)
+}
@@ -0,0 +1,38 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"github.com/mythwright/arc-monitor/arcmon"
+	"github.com/sirupsen/logrus"
+)
+
+// saveHandler saves the state immediately on POST /save, e.g. before a volume
+// snapshot, answering 500 with the error if it couldn't be
+func saveHandler(token string, store arcmon.Store, arcdps *arcmon.ArcDPSVersion) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		if !authorized(r, token) {
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		arcdps.RLock()
+		err := store.Save(arcdps)
+		arcdps.RUnlock()
+		if err != nil {
+			logrus.Errorf("unable to save state on request: (%v)", err)
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		logrus.Infof("state saved on request")
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]string{"saved_at": time.Now().UTC().Format(time.RFC3339)})
+	})
+}
@@ -0,0 +1,119 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/mythwright/arc-monitor/arcmon"
+	"github.com/sirupsen/logrus"
+)
+
+// STARTUP_SELFTEST values
+const (
+	SelfTestOff    = "off"
+	SelfTestOn     = "on"
+	SelfTestStrict = "strict"
+)
+
+// selfTestTimeout bounds the whole self-test so a blackholed host can't hold up startup
+const selfTestTimeout = 30 * time.Second
+
+// probe is a request that shows a destination is reachable without posting anything to it
+type probe struct {
+	name          string
+	method        string
+	url           string
+	authorization string
+	headers       map[string]string
+}
+
+// selfTestProbes lists a probe for deltaconnected and every configured notifier
+func selfTestProbes(cfg *Config) []probe {
+	probes := []probe{{name: "deltaconnected", method: "HEAD", url: arcmon.ChecksumURL(cfg.HashAlgorithm), headers: cfg.UpstreamHeaders}}
+	// Discord answers a GET on a webhook with its metadata
+	for i, wh := range cfg.Webhooks {
+		probes = append(probes, probe{name: fmt.Sprintf("discord webhook %d", i+1), method: "GET", url: wh.URL})
+	}
+	for _, bot := range cfg.DiscordBots {
+		probes = append(probes, probe{
+			name:          "discord channel " + bot.ChannelID,
+			method:        "GET",
+			url:           fmt.Sprintf("%s/channels/%s", arcmon.DiscordAPIURL, bot.ChannelID),
+			authorization: "Bot " + bot.Token,
+		})
+	}
+	for _, gh := range cfg.GitHub {
+		probes = append(probes, probe{
+			name:          "github " + gh.Repo,
+			method:        "GET",
+			url:           fmt.Sprintf("%s/repos/%s", arcmon.GitHubAPIURL, gh.Repo),
+			authorization: "Bearer " + gh.Token,
+		})
+	}
+	for _, tg := range cfg.Telegram {
+		probes = append(probes, probe{
+			name:   "telegram chat " + tg.ChatID,
+			method: "GET",
+			url:    fmt.Sprintf("%s/bot%s/getMe", arcmon.TelegramAPIURL, tg.Token),
+		})
+	}
+	return probes
+}
+
+// selfTest probes every destination and logs the results, returning how many
+// were unreachable or rejected the request
+func selfTest(ctx context.Context, client arcmon.Doer, probes []probe) int {
+	ctx, cncl := context.WithTimeout(ctx, selfTestTimeout)
+	defer cncl()
+
+	failed := 0
+	for _, p := range probes {
+		if err := p.run(ctx, client); err != nil {
+			failed++
+			logrus.Errorf("self-test: %s is unreachable: (%v)", p.name, err)
+			continue
+		}
+		logrus.Infof("self-test: %s is reachable", p.name)
+	}
+	return failed
+}
+
+func (p probe) run(ctx context.Context, client arcmon.Doer) error {
+	req, err := http.NewRequestWithContext(ctx, p.method, p.url, nil)
+	if err != nil {
+		return err
+	}
+	if p.authorization != "" {
+		req.Header.Set("Authorization", p.authorization)
+	}
+	req.Header.Set("User-Agent", "arc-monitor")
+	for name, value := range p.headers {
+		if http.CanonicalHeaderKey(name) == "Host" {
+			req.Host = value
+			continue
+		}
+		req.Header.Set(name, value)
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		// transport errors quote the URL, which holds the token for webhooks and Telegram
+		var uerr *url.Error
+		if errors.As(err, &uerr) {
+			return uerr.Err
+		}
+		return err
+	}
+	io.Copy(io.Discard, resp.Body)
+	resp.Body.Close()
+
+	if resp.StatusCode > 299 {
+		return fmt.Errorf("bad response: %d", resp.StatusCode)
+	}
+	return nil
+}
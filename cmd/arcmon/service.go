@@ -0,0 +1,20 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+const (
+	ServiceName        = "arcmon"
+	ServiceDisplayName = "ArcDPS Monitor"
+)
+
+func chdirToExecutable() error {
+	exe, err := os.Executable()
+	if err != nil {
+		return fmt.Errorf("unable to find executable: (%v)", err)
+	}
+	return os.Chdir(filepath.Dir(exe))
+}
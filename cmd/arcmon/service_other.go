@@ -0,0 +1,15 @@
+//go:build !windows
+
+package main
+
+import "fmt"
+
+func isWindowsService() (bool, error) { return false, nil }
+
+func runService(cfg *Config) error {
+	return fmt.Errorf("running as a service is only supported on Windows")
+}
+
+func controlService(cmd string) error {
+	return fmt.Errorf("-%s is only supported on Windows, use the systemd unit instead", cmd)
+}
@@ -0,0 +1,114 @@
+//go:build windows
+
+package main
+
+import (
+	"fmt"
+	"os"
+	"time"
+
+	"golang.org/x/sys/windows/svc"
+	"golang.org/x/sys/windows/svc/mgr"
+)
+
+func isWindowsService() (bool, error) { return svc.IsWindowsService() }
+
+func runService(cfg *Config) error {
+	return svc.Run(ServiceName, &windowsService{cfg: cfg})
+}
+
+// windowsService adapts run to the service control manager, translating stop
+// and shutdown requests into the same clean shutdown a console SIGTERM gets.
+type windowsService struct {
+	cfg *Config
+}
+
+func (ws *windowsService) Execute(args []string, requests <-chan svc.ChangeRequest, changes chan<- svc.Status) (bool, uint32) {
+	changes <- svc.Status{State: svc.StartPending}
+
+	stop := make(chan struct{})
+	done := make(chan int, 1)
+	go func() { done <- run(ws.cfg, stop) }()
+
+	accepts := svc.AcceptStop | svc.AcceptShutdown
+	changes <- svc.Status{State: svc.Running, Accepts: accepts}
+	for {
+		select {
+		case req := <-requests:
+			switch req.Cmd {
+			case svc.Interrogate:
+				changes <- req.CurrentStatus
+			case svc.Stop, svc.Shutdown:
+				changes <- svc.Status{State: svc.StopPending, WaitHint: uint32((ws.cfg.ShutdownTimeout + time.Second).Milliseconds())}
+				close(stop)
+				return false, uint32(<-done)
+			}
+		case code := <-done:
+			return false, uint32(code)
+		}
+	}
+}
+
+func controlService(cmd string) error {
+	m, err := mgr.Connect()
+	if err != nil {
+		return fmt.Errorf("unable to connect to the service manager: (%v)", err)
+	}
+	defer m.Disconnect()
+
+	if cmd == "install" {
+		return installService(m)
+	}
+
+	s, err := m.OpenService(ServiceName)
+	if err != nil {
+		return fmt.Errorf("service %s is not installed: (%v)", ServiceName, err)
+	}
+	defer s.Close()
+
+	switch cmd {
+	case "uninstall":
+		if err := s.Delete(); err != nil {
+			return fmt.Errorf("unable to remove service: (%v)", err)
+		}
+		fmt.Printf("removed service %s\n", ServiceName)
+	case "start":
+		if err := s.Start(); err != nil {
+			return fmt.Errorf("unable to start service: (%v)", err)
+		}
+		fmt.Printf("started service %s\n", ServiceName)
+	case "stop":
+		if _, err := s.Control(svc.Stop); err != nil {
+			return fmt.Errorf("unable to stop service: (%v)", err)
+		}
+		fmt.Printf("stopping service %s\n", ServiceName)
+	default:
+		return fmt.Errorf("unknown service command %q", cmd)
+	}
+	return nil
+}
+
+func installService(m *mgr.Mgr) error {
+	exe, err := os.Executable()
+	if err != nil {
+		return fmt.Errorf("unable to find executable: (%v)", err)
+	}
+
+	if s, err := m.OpenService(ServiceName); err == nil {
+		s.Close()
+		return fmt.Errorf("service %s is already installed", ServiceName)
+	}
+
+	s, err := m.CreateService(ServiceName, exe, mgr.Config{
+		DisplayName: ServiceDisplayName,
+		Description: "Announces ArcDPS updates to Discord",
+		StartType:   mgr.StartAutomatic,
+	})
+	if err != nil {
+		return fmt.Errorf("unable to install service: (%v)", err)
+	}
+	defer s.Close()
+
+	fmt.Printf("installed service %s for %s\n", ServiceName, exe)
+	return nil
+}
@@ -0,0 +1,79 @@
+package main
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/mythwright/arc-monitor/arcmon"
+	"github.com/sirupsen/logrus"
+)
+
+// DefaultShutdownTimeout bounds how long the shutdown sequence may take before we force exit
+const DefaultShutdownTimeout = 10 * time.Second
+
+// shutdownStep is a named piece of work performed while shutting down
+type shutdownStep struct {
+	name string
+	run  func(ctx context.Context) error
+}
+
+// shutdown runs each step in order until they all finish or ctx expires. Steps
+// that block without honouring ctx are abandoned, and the names of every step
+// that didn't complete are returned so the caller can report them and exit.
+func shutdown(ctx context.Context, steps []shutdownStep) []string {
+	var (
+		mu      sync.Mutex
+		current int
+	)
+	finished := make(chan struct{})
+
+	go func() {
+		defer close(finished)
+		for i, step := range steps {
+			if err := step.run(ctx); err != nil {
+				logrus.Errorf("shutdown: %s failed: (%v)", step.name, err)
+			}
+			mu.Lock()
+			current = i + 1
+			mu.Unlock()
+		}
+	}()
+
+	select {
+	case <-finished:
+		return nil
+	case <-ctx.Done():
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	var unfinished []string
+	for _, step := range steps[current:] {
+		unfinished = append(unfinished, step.name)
+	}
+	return unfinished
+}
+
+// shutdownAndSave runs steps as shutdown does, then saves arcdps to store and
+// releases it. The save isn't one of the steps, so it still happens when one
+// of them uses up the whole timeout, rather than a stuck tick costing what it
+// announced.
+func shutdownAndSave(ctx context.Context, steps []shutdownStep, store stateStore, arcdps *arcmon.ArcDPSVersion) ([]string, error) {
+	unfinished := shutdown(ctx, steps)
+
+	arcdps.RLock()
+	err := store.Save(arcdps)
+	arcdps.RUnlock()
+	if err != nil {
+		logrus.Errorf("unable to save file: (%v)", err)
+	}
+	// released even when saving failed
+	if cerr := store.Close(); cerr != nil {
+		logrus.Errorf("shutdown: releasing the state failed: (%v)", cerr)
+		if err == nil {
+			err = cerr
+		}
+	}
+	return unfinished, err
+}
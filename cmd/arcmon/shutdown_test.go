@@ -0,0 +1,36 @@
+package main
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/mythwright/arc-monitor/arcmon"
+)
+
+func TestShutdownSavesAfterAStuckStep(t *testing.T) {
+	fs := openTestStore(t, false)
+	arcdps := &arcmon.ArcDPSVersion{CheckSum: "0123456789abcdef0123456789abcdef", LastAnnounced: "0123456789abcdef0123456789abcdef"}
+
+	// a tick blocked in a wait that doesn't honour the shutdown deadline
+	stuck := make(chan struct{})
+	defer close(stuck)
+	ctx, cncl := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cncl()
+	unfinished, err := shutdownAndSave(ctx, []shutdownStep{
+		{name: "stop ticker", run: func(ctx context.Context) error {
+			<-stuck
+			return nil
+		}},
+	}, fs, arcdps)
+
+	if len(unfinished) != 1 || unfinished[0] != "stop ticker" {
+		t.Fatalf("unfinished steps %v, want [stop ticker]", unfinished)
+	}
+	if err != nil {
+		t.Fatalf("save after the timeout = %v", err)
+	}
+	if got := readState(t, fs.path, false); got.LastAnnounced != arcdps.LastAnnounced {
+		t.Fatalf("state announced %q, want %q saved despite the stuck step", got.LastAnnounced, arcdps.LastAnnounced)
+	}
+}
@@ -0,0 +1,252 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/mythwright/arc-monitor/arcmon"
+	_ "modernc.org/sqlite"
+)
+
+// DefaultStateDB is where the SQLite backend keeps its database
+const DefaultStateDB = "arcmon.db"
+
+// STATE_BACKEND values
+const (
+	StateBackendFile   = "file"
+	StateBackendSQLite = "sqlite"
+)
+
+const sqliteSchema = `
+CREATE TABLE IF NOT EXISTS state (
+	id                INTEGER PRIMARY KEY CHECK (id = 1),
+	check_sum         TEXT NOT NULL,
+	timestamp         TEXT NOT NULL,
+	last_announced    TEXT NOT NULL,
+	last_announced_at TEXT NOT NULL,
+	etag              TEXT NOT NULL DEFAULT '',
+	monitor_version   TEXT NOT NULL DEFAULT ''
+);
+CREATE TABLE IF NOT EXISTS versions (
+	check_sum     TEXT NOT NULL,
+	last_modified TEXT NOT NULL,
+	first_seen    TEXT NOT NULL,
+	last_seen     TEXT,
+	notified      INTEGER NOT NULL DEFAULT 0,
+	PRIMARY KEY (check_sum, first_seen)
+);`
+
+// sqliteMigrations add the columns introduced since the schema was first
+// released to databases created before them
+var sqliteMigrations = []string{
+	`ALTER TABLE state ADD COLUMN etag TEXT NOT NULL DEFAULT ''`,
+	`ALTER TABLE state ADD COLUMN monitor_version TEXT NOT NULL DEFAULT ''`,
+}
+
+// migrateSQLite applies every migration a database still needs
+func migrateSQLite(db *sql.DB) error {
+	for _, m := range sqliteMigrations {
+		// already applied, or part of the schema the database was created with
+		if _, err := db.Exec(m); err != nil && !strings.Contains(err.Error(), "duplicate column name") {
+			return err
+		}
+	}
+	return nil
+}
+
+// sqliteStore keeps the state and every version ever seen in a SQLite
+// database. Unlike the state file, versions are never trimmed from it.
+type sqliteStore struct {
+	db   *sql.DB
+	lock *os.File
+}
+
+// openSQLiteStore opens the database at path, creating it if needed, and
+// locks it against other instances with the same lock file as the state file
+func openSQLiteStore(path string) (*sqliteStore, error) {
+	lock, err := openLock(path)
+	if err != nil {
+		return nil, err
+	}
+
+	db, err := sql.Open("sqlite", path)
+	if err == nil {
+		// a single connection serialises writers, SQLite allows only one anyway
+		db.SetMaxOpenConns(1)
+		_, err = db.Exec(sqliteSchema)
+	}
+	if err == nil {
+		err = migrateSQLite(db)
+	}
+	if err != nil {
+		unlockFile(lock)
+		lock.Close()
+		return nil, err
+	}
+	return &sqliteStore{db: db, lock: lock}, nil
+}
+
+// Load reads the tracked state, along with the most recent limit versions as its history
+func (st *sqliteStore) Load(limit int) (*arcmon.ArcDPSVersion, error) {
+	arcdps := &arcmon.ArcDPSVersion{}
+
+	var timestamp, announcedAt string
+	err := st.db.QueryRow(`SELECT check_sum, timestamp, last_announced, last_announced_at, etag, monitor_version FROM state WHERE id = 1`).
+		Scan(&arcdps.CheckSum, &timestamp, &arcdps.LastAnnounced, &announcedAt, &arcdps.ETag, &arcdps.MonitorVersion)
+	if err == sql.ErrNoRows {
+		return arcdps, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	arcdps.Timestamp = parseDBTime(timestamp)
+	arcdps.LastAnnouncedAt = parseDBTime(announcedAt)
+
+	versions, err := st.versions(limit, time.Time{})
+	if err != nil {
+		return nil, err
+	}
+	for i := len(versions) - 1; i >= 0; i-- {
+		arcdps.History = append(arcdps.History, versions[i].HistoryEntry)
+	}
+	return arcdps, nil
+}
+
+// Save writes the state and merges its history into the versions table. A
+// version stays marked as notified once it has been announced.
+func (st *sqliteStore) Save(arcdps *arcmon.ArcDPSVersion) error {
+	tx, err := st.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	_, err = tx.Exec(`INSERT INTO state (id, check_sum, timestamp, last_announced, last_announced_at, etag, monitor_version) VALUES (1, ?, ?, ?, ?, ?, ?)
+		ON CONFLICT (id) DO UPDATE SET check_sum = excluded.check_sum, timestamp = excluded.timestamp,
+			last_announced = excluded.last_announced, last_announced_at = excluded.last_announced_at, etag = excluded.etag,
+			monitor_version = excluded.monitor_version`,
+		arcdps.CheckSum, formatDBTime(arcdps.Timestamp), arcdps.LastAnnounced, formatDBTime(arcdps.LastAnnouncedAt), arcdps.ETag, arcdps.MonitorVersion)
+	if err != nil {
+		return err
+	}
+
+	for _, e := range arcdps.History {
+		var lastSeen interface{}
+		if e.LastSeen != nil {
+			lastSeen = formatDBTime(*e.LastSeen)
+		}
+		_, err = tx.Exec(`INSERT INTO versions (check_sum, last_modified, first_seen, last_seen, notified) VALUES (?, ?, ?, ?, ?)
+			ON CONFLICT (check_sum, first_seen) DO UPDATE SET last_seen = excluded.last_seen,
+				notified = max(notified, excluded.notified)`,
+			e.CheckSum, formatDBTime(e.LastModified), formatDBTime(e.FirstSeen), lastSeen, e.CheckSum == arcdps.LastAnnounced)
+		if err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+func (st *sqliteStore) Close() error {
+	err := st.db.Close()
+	unlockFile(st.lock)
+	if cerr := st.lock.Close(); err == nil {
+		err = cerr
+	}
+	return err
+}
+
+// storedVersion : A row of the versions table
+type storedVersion struct {
+	arcmon.HistoryEntry
+	Notified bool `json:"notified"`
+}
+
+// versions returns up to limit versions first seen after since, newest first
+func (st *sqliteStore) versions(limit int, since time.Time) ([]storedVersion, error) {
+	rows, err := st.db.Query(`SELECT check_sum, last_modified, first_seen, last_seen, notified FROM versions
+		WHERE first_seen > ? ORDER BY first_seen DESC LIMIT ?`, formatDBTime(since), limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var versions []storedVersion
+	for rows.Next() {
+		var (
+			v                       storedVersion
+			lastModified, firstSeen string
+			lastSeen                sql.NullString
+		)
+		if err := rows.Scan(&v.CheckSum, &lastModified, &firstSeen, &lastSeen, &v.Notified); err != nil {
+			return nil, err
+		}
+		v.LastModified = parseDBTime(lastModified)
+		v.FirstSeen = parseDBTime(firstSeen)
+		if lastSeen.Valid {
+			t := parseDBTime(lastSeen.String)
+			v.LastSeen = &t
+		}
+		versions = append(versions, v)
+	}
+	return versions, rows.Err()
+}
+
+// maxVersionsQuery caps how many rows /versions returns in one response
+const maxVersionsQuery = 1000
+
+// handleVersions serves the stored versions, newest first, optionally limited
+// with ?limit=N and ?since=<RFC 3339 time>
+func (st *sqliteStore) handleVersions(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	limit := 100
+	if v := r.URL.Query().Get("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 {
+			http.Error(w, "limit must be a positive number", http.StatusBadRequest)
+			return
+		}
+		if n > maxVersionsQuery {
+			n = maxVersionsQuery
+		}
+		limit = n
+	}
+	var since time.Time
+	if v := r.URL.Query().Get("since"); v != "" {
+		t, err := time.Parse(time.RFC3339, v)
+		if err != nil {
+			http.Error(w, "since must be an RFC 3339 time", http.StatusBadRequest)
+			return
+		}
+		since = t
+	}
+
+	versions, err := st.versions(limit, since)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if versions == nil {
+		versions = []storedVersion{}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(versions)
+}
+
+// times are stored as fixed width UTC text so they sort chronologically as strings
+const dbTimeFormat = "2006-01-02T15:04:05.000000000Z"
+
+func formatDBTime(t time.Time) string { return t.UTC().Format(dbTimeFormat) }
+
+func parseDBTime(s string) time.Time {
+	t, _ := time.Parse(dbTimeFormat, s)
+	return t
+}
@@ -0,0 +1,205 @@
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"github.com/mythwright/arc-monitor/arcmon"
+	"github.com/sirupsen/logrus"
+	"gopkg.in/yaml.v2"
+)
+
+// loadState decodes the tracked version from f, transparently decompressing it
+// when the state file is gzipped. An empty file yields an empty state. Fields
+// this build doesn't know are ignored, and missing ones left at their zero
+// values, so files written by older and newer versions both load.
+func loadState(f *os.File, compressed bool) (*arcmon.ArcDPSVersion, error) {
+	arcdps := &arcmon.ArcDPSVersion{}
+
+	var r io.Reader = f
+	if compressed {
+		gz, err := gzip.NewReader(f)
+		if err == io.EOF {
+			return arcdps, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		defer gz.Close()
+		r = gz
+	}
+
+	if err := yaml.NewDecoder(r).Decode(arcdps); err != nil && err != io.EOF {
+		return nil, err
+	}
+	if arcdps.Version > arcmon.StateVersion {
+		logrus.Warnf("%s was written by a newer version of arcmon, anything this one doesn't know will be lost when it saves", f.Name())
+	}
+	arcdps.Version = arcmon.StateVersion
+	return arcdps, nil
+}
+
+// rename replaces the state file with the one just written, a variable so
+// tests can fail a save at the last step
+var rename = os.Rename
+
+// saveState replaces the state file at path with arcdps. It is written and
+// synced to a temporary file in the same directory, which is then renamed
+// over path, so a crash or full disk part way through leaves the previous
+// state in place rather than a truncated file, which for a gzipped state
+// wouldn't load at all.
+func saveState(path string, arcdps *arcmon.ArcDPSVersion, compressed bool) error {
+	var buf bytes.Buffer
+	if compressed {
+		gz := gzip.NewWriter(&buf)
+		if err := yaml.NewEncoder(gz).Encode(arcdps); err != nil {
+			return fmt.Errorf("unable to encode state: (%v)", err)
+		}
+		if err := gz.Close(); err != nil {
+			return fmt.Errorf("unable to compress state: (%v)", err)
+		}
+	} else if err := yaml.NewEncoder(&buf).Encode(arcdps); err != nil {
+		return fmt.Errorf("unable to encode state: (%v)", err)
+	}
+
+	dir, base := filepath.Split(path)
+	if dir == "" {
+		dir = "."
+	}
+	tmp, err := os.CreateTemp(dir, "."+base+".*.tmp")
+	if err != nil {
+		return fmt.Errorf("unable to create a temporary file for %s: (%v)", path, err)
+	}
+	// a no-op once the rename has happened
+	defer os.Remove(tmp.Name())
+
+	mode := os.FileMode(0644)
+	if fi, err := os.Stat(path); err == nil {
+		mode = fi.Mode().Perm()
+	}
+	if err := tmp.Chmod(mode); err != nil {
+		tmp.Close()
+		return fmt.Errorf("unable to set the mode of %s: (%v)", tmp.Name(), err)
+	}
+	if _, err := tmp.Write(buf.Bytes()); err != nil {
+		tmp.Close()
+		return fmt.Errorf("unable to write %s: (%v)", tmp.Name(), err)
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return fmt.Errorf("unable to sync %s: (%v)", tmp.Name(), err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("unable to write %s: (%v)", tmp.Name(), err)
+	}
+	if err := rename(tmp.Name(), path); err != nil {
+		return fmt.Errorf("unable to replace %s: (%v)", path, err)
+	}
+	// the rename itself only survives a crash once the directory is synced
+	return syncDir(dir)
+}
+
+// lockPath is the file locked while an instance runs against the state file
+// at path. The state file itself can't hold the lock, every save replaces it.
+func lockPath(path string) string {
+	return path + ".lock"
+}
+
+// openLock creates and locks the lock file for the state file at path
+func openLock(path string) (*os.File, error) {
+	lock, err := os.OpenFile(lockPath(path), os.O_RDWR|os.O_CREATE, 0644)
+	if err != nil {
+		return nil, err
+	}
+	if err := lockFile(lock); err != nil {
+		lock.Close()
+		return nil, err
+	}
+	return lock, nil
+}
+
+// stateStore is an arcmon.Store that holds the state's lock until it's closed
+type stateStore interface {
+	arcmon.Store
+	Close() error
+}
+
+// openStore opens and locks the configured state backend, loading the tracked version from it
+func openStore(cfg *Config) (stateStore, *arcmon.ArcDPSVersion) {
+	if cfg.StateBackend == StateBackendSQLite {
+		db, err := openSQLiteStore(cfg.StateDB)
+		if err != nil {
+			if err == errLocked {
+				logrus.Fatalf("another instance is running against %s", cfg.StateDB)
+			}
+			logrus.Fatalf("unable to open %s: (%v)", cfg.StateDB, err)
+		}
+		logrus.Infof("using: %s", cfg.StateDB)
+
+		arcdps, err := db.Load(cfg.HistorySize)
+		if err != nil {
+			logrus.Fatalf("unable to load state from %s: (%v)", cfg.StateDB, err)
+		}
+		return db, arcdps
+	}
+
+	path := filepath.Join(".", cfg.StateFile)
+	lock, err := openLock(path)
+	if err != nil {
+		if err == errLocked {
+			logrus.Fatalf("another instance is running against %s", path)
+		}
+		logrus.Fatalf("unable to lock tracking file: (%v)", err)
+	}
+
+	f, err := openStateFile(path)
+	if err != nil {
+		logrus.Fatalf("err opening tracking file: %v\n", err)
+	}
+	logrus.Infof("using: %s", f.Name())
+
+	arcdps, err := loadState(f, cfg.CompressState)
+	f.Close()
+	if err != nil {
+		logrus.Fatalf("unable to decode %s: %v", cfg.StateFile, err)
+	}
+	return &fileStore{lock: lock, path: path, compressed: cfg.CompressState}, arcdps
+}
+
+// openStateFile opens the state file at path, creating it on the first run.
+// Only a missing file is created, any other error, such as not being allowed
+// to read it, is returned rather than starting over with an empty state.
+func openStateFile(path string) (*os.File, error) {
+	f, err := os.OpenFile(path, os.O_RDWR, 0755)
+	if errors.Is(err, os.ErrNotExist) {
+		return os.OpenFile(path, os.O_RDWR|os.O_CREATE, 0755)
+	}
+	return f, err
+}
+
+// fileStore saves the tracked state to the state file, holding its lock file
+// until it's closed
+type fileStore struct {
+	// mu serialises saves, which can come from the checker and POST /save at once
+	mu         sync.Mutex
+	lock       *os.File
+	path       string
+	compressed bool
+}
+
+func (fs *fileStore) Save(arcdps *arcmon.ArcDPSVersion) error {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+	return saveState(fs.path, arcdps, fs.compressed)
+}
+
+func (fs *fileStore) Close() error {
+	unlockFile(fs.lock)
+	return fs.lock.Close()
+}
@@ -0,0 +1,224 @@
+package main
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+	"time"
+
+	"github.com/mythwright/arc-monitor/arcmon"
+)
+
+// openTestStore locks a state file in a temporary directory, the way openStore does
+func openTestStore(t *testing.T, compressed bool) *fileStore {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), DefaultStateFile)
+	lock, err := openLock(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	fs := &fileStore{lock: lock, path: path, compressed: compressed}
+	t.Cleanup(func() { fs.Close() })
+	return fs
+}
+
+// readState decodes the state file at path
+func readState(t *testing.T, path string, compressed bool) *arcmon.ArcDPSVersion {
+	t.Helper()
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	arcdps, err := loadState(f, compressed)
+	if err != nil {
+		t.Fatalf("loadState() = %v", err)
+	}
+	return arcdps
+}
+
+func TestSaveRecreatesRemovedStateFile(t *testing.T) {
+	fs := openTestStore(t, false)
+	arcdps := &arcmon.ArcDPSVersion{CheckSum: "0123456789abcdef0123456789abcdef", Timestamp: time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)}
+	if err := fs.Save(arcdps); err != nil {
+		t.Fatalf("Save() = %v", err)
+	}
+
+	// an operator cleaning up while the monitor runs
+	if err := os.Remove(fs.path); err != nil {
+		t.Fatal(err)
+	}
+	arcdps.CheckSum = "fedcba9876543210fedcba9876543210"
+	if err := fs.Save(arcdps); err != nil {
+		t.Fatalf("Save() after the file was removed = %v", err)
+	}
+	if got := readState(t, fs.path, false); got.CheckSum != arcdps.CheckSum {
+		t.Fatalf("recreated file holds %q, want %q", got.CheckSum, arcdps.CheckSum)
+	}
+}
+
+func TestFailedSaveKeepsPreviousState(t *testing.T) {
+	for _, compressed := range []bool{false, true} {
+		fs := openTestStore(t, compressed)
+		arcdps := &arcmon.ArcDPSVersion{CheckSum: "0123456789abcdef0123456789abcdef", Timestamp: time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)}
+		if err := fs.Save(arcdps); err != nil {
+			t.Fatalf("Save() = %v", err)
+		}
+
+		// the disk fills up, or the process dies, before the new state is in place
+		rename = func(string, string) error { return errors.New("no space left on device") }
+		arcdps.CheckSum = "fedcba9876543210fedcba9876543210"
+		err := fs.Save(arcdps)
+		rename = os.Rename
+		if err == nil {
+			t.Fatalf("Save() succeeded though replacing the file failed")
+		}
+
+		if got := readState(t, fs.path, compressed); got.CheckSum != "0123456789abcdef0123456789abcdef" {
+			t.Fatalf("state holds %q after a failed save, want the previous version, compressed %t", got.CheckSum, compressed)
+		}
+		entries, err := os.ReadDir(filepath.Dir(fs.path))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(entries) != 2 {
+			t.Fatalf("%d files next to the state after a failed save, want only it and its lock file", len(entries))
+		}
+	}
+}
+
+func TestSecondStoreIsLockedOut(t *testing.T) {
+	fs := openTestStore(t, false)
+	if lock, err := openLock(fs.path); err != errLocked {
+		if lock != nil {
+			lock.Close()
+		}
+		t.Fatalf("openLock() = %v while another store holds it, want errLocked", err)
+	}
+	// and saving, which replaces the state file, doesn't release the lock
+	if err := fs.Save(&arcmon.ArcDPSVersion{}); err != nil {
+		t.Fatalf("Save() = %v", err)
+	}
+	if lock, err := openLock(fs.path); err != errLocked {
+		if lock != nil {
+			lock.Close()
+		}
+		t.Fatalf("openLock() = %v after a save, want errLocked", err)
+	}
+}
+
+// writeState writes contents to a state file and opens it as openStore would
+func writeState(t *testing.T, contents string) *os.File {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), DefaultStateFile)
+	if err := os.WriteFile(path, []byte(contents), 0644); err != nil {
+		t.Fatal(err)
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { f.Close() })
+	return f
+}
+
+func TestLoadLegacyState(t *testing.T) {
+	// all a state file held before history, ETags and announcements were tracked
+	f := writeState(t, "timestamp: 2024-03-01T12:00:00Z\ncheck_sum: 0123456789abcdef0123456789abcdef\n")
+
+	arcdps, err := loadState(f, false)
+	if err != nil {
+		t.Fatalf("loadState() = %v", err)
+	}
+	if arcdps.CheckSum != "0123456789abcdef0123456789abcdef" || !arcdps.Timestamp.Equal(time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)) {
+		t.Fatalf("loaded %q released %s", arcdps.CheckSum, arcdps.Timestamp)
+	}
+	if arcdps.LastAnnounced != "" || arcdps.ETag != "" || len(arcdps.History) != 0 {
+		t.Fatalf("fields missing from the file weren't left empty: %+v", arcdps)
+	}
+	if arcdps.Version != arcmon.StateVersion {
+		t.Fatalf("version %d, want it upgraded to %d", arcdps.Version, arcmon.StateVersion)
+	}
+}
+
+func TestLoadFutureState(t *testing.T) {
+	f := writeState(t, `version: 99
+timestamp: 2024-03-01T12:00:00Z
+check_sum: 0123456789abcdef0123456789abcdef
+last_announced: 0123456789abcdef0123456789abcdef
+announced_to:
+  - discord
+  - telegram
+schedule:
+  quiet_hours: 22-06
+`)
+
+	arcdps, err := loadState(f, false)
+	if err != nil {
+		t.Fatalf("loadState() = %v, unknown fields should be ignored", err)
+	}
+	if arcdps.CheckSum != "0123456789abcdef0123456789abcdef" || arcdps.LastAnnounced != arcdps.CheckSum {
+		t.Fatalf("known fields lost alongside unknown ones: %+v", arcdps)
+	}
+}
+
+func TestLoadEmptyState(t *testing.T) {
+	for _, compressed := range []bool{false, true} {
+		arcdps, err := loadState(writeState(t, ""), compressed)
+		if err != nil {
+			t.Fatalf("loadState() = %v for an empty file, compressed %t", err, compressed)
+		}
+		if arcdps.CheckSum != "" {
+			t.Fatalf("empty file loaded as %q", arcdps.CheckSum)
+		}
+	}
+}
+
+func TestOpenStateFileCreatesMissingFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), DefaultStateFile)
+	f, err := openStateFile(path)
+	if err != nil {
+		t.Fatalf("openStateFile() = %v for a missing file, want it created", err)
+	}
+	defer f.Close()
+	arcdps, err := loadState(f, false)
+	if err != nil {
+		t.Fatalf("loadState() = %v", err)
+	}
+	if arcdps.CheckSum != "" {
+		t.Fatalf("new state file tracks %q, want nothing", arcdps.CheckSum)
+	}
+}
+
+func TestOpenStateFilePermissionDenied(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("Windows doesn't enforce Unix permission bits")
+	}
+	if os.Geteuid() == 0 {
+		t.Skip("root can open any file")
+	}
+	path := filepath.Join(t.TempDir(), DefaultStateFile)
+	if err := os.WriteFile(path, []byte("checksum: 0123456789abcdef0123456789abcdef\n"), 0); err != nil {
+		t.Fatal(err)
+	}
+
+	if f, err := openStateFile(path); err == nil {
+		f.Close()
+		t.Fatalf("opened a state file it isn't allowed to read")
+	} else if !errors.Is(err, os.ErrPermission) {
+		t.Fatalf("openStateFile() = %v, want a permission error", err)
+	}
+}
+
+func TestOpenStateFileUnderAFile(t *testing.T) {
+	parent := filepath.Join(t.TempDir(), "notadir")
+	if err := os.WriteFile(parent, nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+	if f, err := openStateFile(filepath.Join(parent, DefaultStateFile)); err == nil {
+		f.Close()
+		t.Fatalf("opened a state file under a regular file")
+	}
+}
@@ -0,0 +1,15 @@
+//go:build !windows
+
+package main
+
+import "os"
+
+// syncDir flushes dir, so a file just renamed into it is still there after a crash
+func syncDir(dir string) error {
+	d, err := os.Open(dir)
+	if err != nil {
+		return err
+	}
+	defer d.Close()
+	return d.Sync()
+}
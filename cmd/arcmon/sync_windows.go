@@ -0,0 +1,9 @@
+//go:build windows
+
+package main
+
+// syncDir does nothing, Windows can't open a directory to flush it and NTFS
+// journals the rename itself
+func syncDir(dir string) error {
+	return nil
+}
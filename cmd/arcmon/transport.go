@@ -0,0 +1,75 @@
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"time"
+)
+
+// IP_VERSION values
+const (
+	IPVersionAuto = "auto"
+	IPVersion4    = "4"
+	IPVersion6    = "6"
+)
+
+// newTransport builds the transport used for every outgoing request. With an
+// IPVersion of 4 or 6 all dials are pinned to that stack, which helps on
+// networks where the other one is broken. Pinned certificates are checked
+// for connections to deltaconnected, and CA_BUNDLE_FILE is trusted alongside
+// the system roots. FORCE_HTTP1 keeps every connection on HTTP/1.1.
+func newTransport(cfg *Config) *http.Transport {
+	ipVersion := cfg.IPVersion
+	dialer := &net.Dialer{Timeout: 5 * time.Second}
+	// a custom dialer or TLS config turns HTTP/2 off unless it's asked for
+	t := &http.Transport{DialContext: dialer.DialContext, ForceAttemptHTTP2: true}
+
+	if len(cfg.PinnedCerts) > 0 || cfg.RootCAs != nil {
+		t.TLSClientConfig = &tls.Config{RootCAs: cfg.RootCAs}
+	}
+	if len(cfg.PinnedCerts) > 0 {
+		t.TLSClientConfig.VerifyConnection = verifyPins(pinnedHost(), cfg.PinnedCerts)
+	}
+
+	// a non-nil, empty TLSNextProto is what turns HTTP/2 off
+	if cfg.ForceHTTP1 {
+		t.ForceAttemptHTTP2 = false
+		t.TLSNextProto = make(map[string]func(string, *tls.Conn) http.RoundTripper)
+		if t.TLSClientConfig == nil {
+			t.TLSClientConfig = &tls.Config{}
+		}
+		t.TLSClientConfig.NextProtos = []string{"http/1.1"}
+	}
+
+	if ipVersion == IPVersion4 || ipVersion == IPVersion6 {
+		t.DialContext = func(ctx context.Context, network, addr string) (net.Conn, error) {
+			if network == "tcp" {
+				network += ipVersion
+			}
+			return dialer.DialContext(ctx, network, addr)
+		}
+	}
+	return t
+}
+
+// loadCABundle returns the system roots plus every certificate in the PEM file
+// at path, for networks behind a TLS intercepting proxy
+func loadCABundle(path string) (*x509.CertPool, error) {
+	pem, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	pool, err := x509.SystemCertPool()
+	if err != nil || pool == nil {
+		pool = x509.NewCertPool()
+	}
+	if !pool.AppendCertsFromPEM(pem) {
+		return nil, fmt.Errorf("no PEM certificates found in %s", path)
+	}
+	return pool, nil
+}
@@ -0,0 +1,39 @@
+package main
+
+import (
+	"crypto/x509"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestTransportNegotiatesHTTP2UnlessForcedOff(t *testing.T) {
+	var proto int
+	srv := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		proto = r.ProtoMajor
+	}))
+	srv.EnableHTTP2 = true
+	srv.StartTLS()
+	defer srv.Close()
+	roots := x509.NewCertPool()
+	roots.AddCert(srv.Certificate())
+
+	for _, tc := range []struct {
+		forceHTTP1 bool
+		want       int
+	}{
+		{false, 2},
+		{true, 1},
+	} {
+		cfg := &Config{IPVersion: IPVersionAuto, RootCAs: roots, ForceHTTP1: tc.forceHTTP1}
+		client := &http.Client{Transport: newTransport(cfg)}
+		resp, err := client.Get(srv.URL)
+		if err != nil {
+			t.Fatalf("FORCE_HTTP1=%t: %v", tc.forceHTTP1, err)
+		}
+		resp.Body.Close()
+		if proto != tc.want {
+			t.Errorf("FORCE_HTTP1=%t: request made over HTTP/%d, want HTTP/%d", tc.forceHTTP1, proto, tc.want)
+		}
+	}
+}